@@ -0,0 +1,56 @@
+// Package audit names the actions recorded in the audit log and carries the
+// request ID that ties audit entries to the request that caused them.
+package audit
+
+import "context"
+
+// Actions recorded in the audit log for changes to collections and the
+// copies they hold.
+const (
+	CollectionCreate  = "collection.create"
+	CollectionDelete  = "collection.delete"
+	CollectionRename  = "collection.rename"
+	CollectionMerge   = "collection.merge"
+	CollectionRestore = "collection.restore"
+	CollectionShare   = "collection.share"
+	CopyAdd           = "copy.add"
+	CopyUpdate        = "copy.update"
+	CopyRemove        = "copy.remove"
+	CopyTransfer      = "copy.transfer"
+	CopyRestore       = "copy.restore"
+	CopyGrade         = "copy.grade"
+	CopyDispose       = "copy.dispose"
+	TrashPurge        = "trash.purge"
+)
+
+// Actions recorded in the audit log for changes to accounts. Passwords are
+// never logged, only that one was changed.
+const (
+	UserUpdate        = "user.update"
+	UserActivate      = "user.activate"
+	UserDeactivate    = "user.deactivate"
+	UserRole          = "user.role"
+	UserPassword      = "user.password"
+	UserPasswordReset = "user.password_reset"
+)
+
+// Kinds of thing an audit entry is about.
+const (
+	TargetCollection = "collection"
+	TargetCopy       = "copy"
+	TargetUser       = "user"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying a request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID stored by WithRequestID, or "" outside a
+// request.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+)
+
+// APIKeyPrefix starts every personal API key, telling keys apart from access
+// tokens and making leaked keys easy to spot.
+const APIKeyPrefix = "pcol_"
+
+// API key scopes.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// ValidScope reports whether scope is one of the API key scopes.
+func ValidScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeWrite
+}
+
+// ScopeAllows reports whether claims permit a request method. Read-only API
+// keys may only make safe requests.
+func (c *Claims) ScopeAllows(method string) bool {
+	if c.Scope != ScopeRead {
+		return true
+	}
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// NewAPIKey generates an API key. The prefix is the start of the key, kept
+// in the clear so users can tell their keys apart.
+func NewAPIKey() (key string, prefix string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	return key, key[:len(APIKeyPrefix)+8], nil
+}
@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseKeys reads verification keys written as "kid:secret" pairs separated
+// by commas, as in JWT_PREVIOUS_KEYS.
+func ParseKeys(value string) ([]Key, error) {
+	var keys []Key
+	for i, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("invalid key %d: expected kid:secret", i+1)
+		}
+		keys = append(keys, Key{ID: id, Secret: []byte(secret)})
+	}
+	return keys, nil
+}
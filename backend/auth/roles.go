@@ -0,0 +1,40 @@
+package auth
+
+// Roles a user can have. Every account starts as RoleUser.
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleUser      = "user"
+)
+
+// Permission names an operation guarded by role.
+type Permission string
+
+const (
+	PermViewUsers       Permission = "users:read"
+	PermManageUsers     Permission = "users:write"
+	PermManageRoles     Permission = "roles:write"
+	PermViewCollections Permission = "collections:read_any"
+	PermRefreshMarket   Permission = "market:refresh"
+	PermViewAudit       Permission = "audit:read"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleAdmin:     {PermViewUsers, PermManageUsers, PermManageRoles, PermViewCollections, PermRefreshMarket, PermViewAudit},
+	RoleModerator: {PermViewUsers, PermViewCollections, PermViewAudit},
+}
+
+// ValidRole reports whether role is one of the defined roles.
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleModerator || role == RoleUser
+}
+
+// Can reports whether a role grants a permission.
+func Can(role string, permission Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+// Package auth issues and verifies the API's access tokens.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, badly signed,
+// expired or meant for another issuer or audience.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims are the claims carried by an access token. Requests authenticated
+// with an API key get the same claims, with Scope set to the key's scope;
+// access tokens leave it empty and carry the user's full access.
+type Claims struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Scope    string `json:"-"`
+	jwt.RegisteredClaims
+}
+
+// TokenService issues access tokens and verifies them.
+type TokenService interface {
+	Issue(userID int, username string) (token string, expiresAt time.Time, err error)
+	Parse(token string) (*Claims, error)
+}
+
+// Key is an HMAC secret identified by the kid header of the tokens it signs.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// HMACTokenService signs HS256 tokens with one key and accepts tokens signed
+// by any of its verification keys. To rotate, sign with a new key and keep
+// the old one for verification until its tokens have expired.
+type HMACTokenService struct {
+	issuer     string
+	audience   string
+	ttl        time.Duration
+	signingKey Key
+	keys       map[string][]byte
+	parser     *jwt.Parser
+}
+
+// NewHMACTokenService creates a token service. The signing key is always
+// accepted for verification as well.
+func NewHMACTokenService(issuer string, audience string, ttl time.Duration, signingKey Key, verificationKeys ...Key) (*HMACTokenService, error) {
+	if signingKey.ID == "" || len(signingKey.Secret) == 0 {
+		return nil, errors.New("signing key needs an ID and a secret")
+	}
+	keys := map[string][]byte{signingKey.ID: signingKey.Secret}
+	for _, key := range verificationKeys {
+		if key.ID == "" || len(key.Secret) == 0 {
+			return nil, errors.New("verification keys need an ID and a secret")
+		}
+		if _, exists := keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key ID %q", key.ID)
+		}
+		keys[key.ID] = key.Secret
+	}
+
+	return &HMACTokenService{
+		issuer:     issuer,
+		audience:   audience,
+		ttl:        ttl,
+		signingKey: signingKey,
+		keys:       keys,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+			jwt.WithIssuer(issuer),
+			jwt.WithAudience(audience),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+			jwt.WithLeeway(30*time.Second),
+		),
+	}, nil
+}
+
+func (s *HMACTokenService) Issue(userID int, username string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.ttl)
+	claims := &Claims{
+		UserID:   userID,
+		Username: username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   strconv.Itoa(userID),
+			Audience:  jwt.ClaimStrings{s.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = s.signingKey.ID
+	signed, err := token.SignedString(s.signingKey.Secret)
+	return signed, expiresAt, err
+}
+
+func (s *HMACTokenService) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := s.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		secret, ok := s.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID %q", kid)
+		}
+		return secret, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.UserID == 0 || claims.Subject != strconv.Itoa(claims.UserID) {
+		return nil, fmt.Errorf("%w: subject doesn't match user", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+type claimsContextKey struct{}
+
+// ContextWithClaims returns a copy of ctx carrying the caller's claims.
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by ContextWithClaims, or nil
+// for unauthenticated requests.
+func ClaimsFromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims
+}
@@ -0,0 +1,48 @@
+// Command mockoidc runs the ssotest OpenID Connect provider so the sign-in
+// flow can be tried locally without a real identity provider. Configure the
+// API with, for example:
+//
+//	OIDC_PROVIDERS=local
+//	OIDC_LOCAL_ISSUER=http://localhost:9000
+//	OIDC_LOCAL_CLIENT_ID=pokemon-collection
+//	OIDC_LOCAL_CLIENT_SECRET=local-secret
+//
+// then open http://localhost:8000/api/oidc/local/login. Add login_hint to the
+// provider URL to sign in as a different email.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/CatsMeow492/PokemonCollection/sso/ssotest"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "address to listen on")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL the API reaches this server at")
+	clientID := flag.String("client-id", "pokemon-collection", "client ID to accept")
+	clientSecret := flag.String("client-secret", "local-secret", "client secret to accept")
+	email := flag.String("email", "ash@example.com", "email of the signed-in user")
+	subject := flag.String("subject", "", "subject of the signed-in user (defaults to the email)")
+	name := flag.String("name", "Ash Ketchum", "name of the signed-in user")
+	emailVerified := flag.Bool("email-verified", true, "whether the email is reported as verified")
+	flag.Parse()
+
+	if *subject == "" {
+		*subject = *email
+	}
+	provider, err := ssotest.NewProvider(*issuer, *clientID, *clientSecret, ssotest.User{
+		Subject:       *subject,
+		Email:         *email,
+		EmailVerified: *emailVerified,
+		Name:          *name,
+	})
+	if err != nil {
+		log.Fatalf("Error creating provider: %v", err)
+	}
+
+	log.Printf("Mock OIDC provider %s listening on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, provider))
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/CatsMeow492/PokemonCollection/services"
+)
+
+func accountErrorStatus(err error) int {
+	if errors.Is(err, services.ErrInvalidToken) {
+		return http.StatusBadRequest
+	}
+	return profileErrorStatus(err)
+}
+
+// RequestPasswordReset emails a reset link. It answers 202 whether or not
+// the address belongs to an account.
+func RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Email == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.RequestPasswordReset(requestBody.Email); err != nil {
+		log.Printf("RequestPasswordReset: Error requesting password reset: %v", err)
+		http.Error(w, "Error requesting password reset", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.ResetPassword(r.Context(), requestBody.Token, requestBody.NewPassword); err != nil {
+		log.Printf("ConfirmPasswordReset: Error resetting password: %v", err)
+		http.Error(w, err.Error(), accountErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.VerifyEmail(requestBody.Token); err != nil {
+		log.Printf("VerifyEmail: Error verifying email: %v", err)
+		http.Error(w, err.Error(), accountErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerificationEmail sends a new verification link. Like password
+// resets it answers 202 for unknown addresses too.
+func ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Email == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.ResendVerificationEmail(requestBody.Email); err != nil {
+		log.Printf("ResendVerificationEmail: Error sending verification email: %v", err)
+		http.Error(w, "Error sending verification email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
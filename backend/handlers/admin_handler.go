@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/auth"
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/gorilla/mux"
+)
+
+// The admin endpoints sit behind middleware.Auth and middleware.Require, which
+// check the caller's role.
+
+func adminErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidRole):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrRefreshRunning):
+		return http.StatusConflict
+	}
+	return profileErrorStatus(err)
+}
+
+// AdminListUsers lists users, filtered by q (username, email or name), role
+// and active, and paged with limit and offset.
+func AdminListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	search := models.UserSearch{Query: query.Get("q"), Role: query.Get("role")}
+	if raw := query.Get("active"); raw != "" {
+		active, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, "active must be true or false", http.StatusBadRequest)
+			return
+		}
+		search.Active = &active
+	}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		search.Limit = limit
+	}
+	if raw := query.Get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		search.Offset = offset
+	}
+
+	users, err := services.SearchUsers(search)
+	if err != nil {
+		http.Error(w, "Error searching users", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+func AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	user, err := services.GetAdminUser(userID)
+	if err != nil {
+		log.Printf("AdminGetUser: Error fetching user ID %s: %v", userID, err)
+		http.Error(w, "Error fetching user", adminErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// AdminSetUserActive deactivates or reactivates an account.
+func AdminSetUserActive(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	var requestBody struct {
+		Active *bool `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Active == nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if claims := auth.ClaimsFromContext(r.Context()); claims != nil && strconv.Itoa(claims.UserID) == userID && !*requestBody.Active {
+		http.Error(w, "You can't deactivate your own account", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.SetUserActive(r.Context(), userID, *requestBody.Active); err != nil {
+		log.Printf("AdminSetUserActive: Error updating user ID %s: %v", userID, err)
+		http.Error(w, "Error updating user", adminErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func AdminSetUserRole(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	var requestBody struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if claims := auth.ClaimsFromContext(r.Context()); claims != nil && strconv.Itoa(claims.UserID) == userID && requestBody.Role != auth.RoleAdmin {
+		http.Error(w, "You can't remove your own admin role", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.SetUserRole(r.Context(), userID, requestBody.Role); err != nil {
+		log.Printf("AdminSetUserRole: Error updating user ID %s: %v", userID, err)
+		http.Error(w, err.Error(), adminErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminForcePasswordReset locks a user out of their current password and
+// emails them a reset link.
+func AdminForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	if err := services.ForcePasswordReset(r.Context(), userID); err != nil {
+		log.Printf("AdminForcePasswordReset: Error resetting password for user ID %s: %v", userID, err)
+		http.Error(w, "Error forcing password reset", adminErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// AdminGetCollections lists any user's collections, read-only.
+func AdminGetCollections(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	collections, err := services.GetCollectionsByUserID(userID)
+	if err != nil {
+		log.Printf("AdminGetCollections: Error fetching collections for user ID %s: %v", userID, err)
+		http.Error(w, "Error fetching collections", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collections)
+}
+
+// AdminGetCollection shows one of any user's collections, read-only.
+func AdminGetCollection(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	collection, err := services.GetCollectionByID(userID, collectionID)
+	if err != nil {
+		log.Printf("AdminGetCollection: Error fetching collection %d: %v", collectionID, err)
+		http.Error(w, "Collection not found", collectionErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+// AdminRefreshMarket starts a background refresh of stale market prices for
+// every owned or wanted card.
+func AdminRefreshMarket(w http.ResponseWriter, r *http.Request) {
+	if err := services.RefreshMarketPrices(); err != nil {
+		log.Printf("AdminRefreshMarket: Error starting refresh: %v", err)
+		http.Error(w, err.Error(), adminErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// AdminGetAudit lists audit log entries, newest first, filtered by user_id,
+// actor_id, action, target_type, target_id, collection_id, request_id and a
+// since/until time range (RFC 3339), and paged with limit and offset.
+func AdminGetAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	search := models.AuditSearch{
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+		RequestID:  query.Get("request_id"),
+	}
+	for name, dest := range map[string]*int{
+		"user_id":       &search.UserID,
+		"actor_id":      &search.ActorID,
+		"collection_id": &search.CollectionID,
+		"limit":         &search.Limit,
+		"offset":        &search.Offset,
+	} {
+		if raw := query.Get(name); raw != "" {
+			value, err := strconv.Atoi(raw)
+			if err != nil {
+				http.Error(w, "Invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*dest = value
+		}
+	}
+	for name, dest := range map[string]**time.Time{"since": &search.Since, "until": &search.Until} {
+		if raw := query.Get(name); raw != "" {
+			value, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				http.Error(w, name+" must be an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			*dest = &value
+		}
+	}
+
+	entries, err := services.SearchAudit(search)
+	if err != nil {
+		http.Error(w, "Error searching audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
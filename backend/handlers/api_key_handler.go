@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/CatsMeow492/PokemonCollection/auth"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/gorilla/mux"
+)
+
+// apiKeyErrorStatus maps API key service errors to HTTP status codes.
+func apiKeyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidAPIKey):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrAPIKeyNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// API key routes only act for the signed-in user named in the route.
+
+func GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := services.GetAPIKeysByUserID(mux.Vars(r)["user_id"])
+	if err != nil {
+		http.Error(w, "Error fetching API keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// CreateAPIKey issues a new key. The response is the only time the key
+// itself is returned. Keys can only be created from a signed-in session, not
+// with another API key.
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if auth.ClaimsFromContext(r.Context()).Scope != "" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Name  string `json:"name"`
+		Scope string `json:"scope"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	created, err := services.CreateAPIKey(mux.Vars(r)["user_id"], req.Name, req.Scope)
+	if err != nil {
+		log.Printf("CreateAPIKey: Error creating API key: %v", err)
+		http.Error(w, err.Error(), apiKeyErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := strconv.Atoi(mux.Vars(r)["key_id"])
+	if err != nil {
+		http.Error(w, "Invalid key ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.RevokeAPIKey(mux.Vars(r)["user_id"], keyID); err != nil {
+		http.Error(w, err.Error(), apiKeyErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
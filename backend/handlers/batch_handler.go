@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/services"
+)
+
+// batchErrorStatus maps errors that fail a whole batch to HTTP status codes.
+// Row-level failures are reported in the results instead.
+func batchErrorStatus(err error) int {
+	if errors.Is(err, services.ErrBatchTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return collectionErrorStatus(err)
+}
+
+func writeBatchResults(w http.ResponseWriter, results []models.BatchResult) {
+	failed := 0
+	for _, result := range results {
+		if !result.Success {
+			failed++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results":   results,
+		"succeeded": len(results) - failed,
+		"failed":    failed,
+	})
+}
+
+func BatchAddCards(w http.ResponseWriter, r *http.Request) {
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		Cards []models.Card `json:"cards"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || len(requestBody.Cards) == 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	results, err := services.BatchAddCards(r.Context(), os.Getenv("POKEMON_TCG_API_KEY"), requestUserID(r), collectionID, requestBody.Cards)
+	if err != nil {
+		log.Printf("Error adding cards to collection %d: %v", collectionID, err)
+		http.Error(w, err.Error(), batchErrorStatus(err))
+		return
+	}
+
+	writeBatchResults(w, results)
+}
+
+func BatchUpdateCards(w http.ResponseWriter, r *http.Request) {
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		Updates []models.CardUpdate `json:"updates"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || len(requestBody.Updates) == 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	results, err := services.BatchUpdateCards(r.Context(), requestUserID(r), collectionID, requestBody.Updates)
+	if err != nil {
+		log.Printf("Error updating cards in collection %d: %v", collectionID, err)
+		http.Error(w, err.Error(), batchErrorStatus(err))
+		return
+	}
+
+	writeBatchResults(w, results)
+}
+
+func BatchRemoveCards(w http.ResponseWriter, r *http.Request) {
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		Cards []models.CardRef `json:"cards"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || len(requestBody.Cards) == 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	results, err := services.BatchRemoveCards(r.Context(), requestUserID(r), collectionID, requestBody.Cards)
+	if err != nil {
+		log.Printf("Error removing cards from collection %d: %v", collectionID, err)
+		http.Error(w, err.Error(), batchErrorStatus(err))
+		return
+	}
+
+	writeBatchResults(w, results)
+}
@@ -2,14 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 
+	"github.com/CatsMeow492/PokemonCollection/auth"
 	"github.com/CatsMeow492/PokemonCollection/models"
 	"github.com/CatsMeow492/PokemonCollection/services"
 )
@@ -39,11 +43,54 @@ func GetCardsByUserIDAndCollectionName(w http.ResponseWriter, r *http.Request, u
 	log.Println("Successfully sent cards to client")
 }
 
+// cardErrorStatus maps card service errors to HTTP status codes.
+func cardErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCardNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrMultipleCopies):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// bodyOwner checks that the user_id sent in a request body is the signed-in
+// user, writing a 403 response when it isn't. Routes taking user_id from the
+// path or query are checked by middleware.Owner instead.
+func bodyOwner(w http.ResponseWriter, r *http.Request, userID string) bool {
+	claims := auth.ClaimsFromContext(r.Context())
+	if claims == nil || strconv.Itoa(claims.UserID) != userID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func GetCardSummariesByUserIDAndCollectionName(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	collectionName := r.URL.Query().Get("collection_name")
+	if userID == "" || collectionName == "" {
+		http.Error(w, "user_id and collection_name are required", http.StatusBadRequest)
+		return
+	}
+
+	cards, err := services.GetCardsByUserIDAndCollectionName(userID, collectionName)
+	if err != nil {
+		log.Printf("Error fetching cards: %v", err)
+		http.Error(w, "Error fetching cards", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(services.SummarizeCards(cards))
+}
+
 func UpdateCardQuantity(w http.ResponseWriter, r *http.Request) {
 	var requestBody struct {
 		UserID         string `json:"user_id"`
 		CollectionName string `json:"collection_name"`
 		CardID         string `json:"card_id"`
+		UserItemID     int    `json:"user_item_id"`
 		Quantity       int    `json:"quantity"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
@@ -52,12 +99,65 @@ func UpdateCardQuantity(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !bodyOwner(w, r, requestBody.UserID) {
+		return
+	}
+
 	log.Printf("Received request to update card quantity: %+v", requestBody)
 
-	updatedCard, err := services.UpdateCardQuantity(requestBody.UserID, requestBody.CollectionName, requestBody.CardID, requestBody.Quantity)
+	updatedCard, err := services.UpdateCardQuantity(r.Context(), requestBody.UserID, requestBody.CollectionName, requestBody.CardID, requestBody.UserItemID, requestBody.Quantity)
 	if err != nil {
 		log.Printf("Error updating card quantity: %v", err)
-		http.Error(w, fmt.Sprintf("Error updating card quantity: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error updating card quantity: %v", err), cardErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updatedCard)
+}
+
+func UpdateCardAttributes(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		UserID         string      `json:"user_id"`
+		CollectionName string      `json:"collection_name"`
+		CardID         string      `json:"card_id"`
+		UserItemID     int         `json:"user_item_id"`
+		Grade          interface{} `json:"grade"`
+		Condition      string      `json:"condition"`
+		Language       string      `json:"language"`
+		Finish         string      `json:"finish"`
+		AcquiredAt     *time.Time  `json:"acquired_at"`
+		Notes          string      `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !bodyOwner(w, r, requestBody.UserID) {
+		return
+	}
+
+	log.Printf("Received request to update card attributes: %+v", requestBody)
+
+	if _, _, _, err := models.NormalizeRawAttributes(requestBody.Condition, requestBody.Language, requestBody.Finish); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	attributes := models.Card{
+		Grade:      requestBody.Grade,
+		Condition:  requestBody.Condition,
+		Language:   requestBody.Language,
+		Finish:     requestBody.Finish,
+		AcquiredAt: requestBody.AcquiredAt,
+		Notes:      requestBody.Notes,
+	}
+	updatedCard, err := services.UpdateCardAttributes(r.Context(), requestBody.UserID, requestBody.CollectionName, requestBody.CardID, requestBody.UserItemID, attributes)
+	if err != nil {
+		log.Printf("Error updating card attributes: %v", err)
+		http.Error(w, fmt.Sprintf("Error updating card attributes: %v", err), cardErrorStatus(err))
 		return
 	}
 
@@ -103,6 +203,9 @@ func AddCardWithUserID(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !bodyOwner(w, r, newCard.UserID) {
+		return
+	}
 
 	// Fetch the card from the API to ensure we have the correct ID
 	apiKey := os.Getenv("POKEMON_TCG_API_KEY")
@@ -117,7 +220,7 @@ func AddCardWithUserID(w http.ResponseWriter, r *http.Request) {
 	newCard.Card.Image = fetchedCard.Image
 	// Add any other fields you want to update from the API response
 
-	err = services.AddCardToCollection(newCard.UserID, "Default", newCard.Card)
+	newCard.Card.UserItemID, err = services.AddCardToCollection(r.Context(), newCard.UserID, "Default", newCard.Card)
 	if err != nil {
 		http.Error(w, "Error adding card to collection", http.StatusInternalServerError)
 		return
@@ -161,33 +264,32 @@ func AddCardWithUserIDAndCollection(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid or incomplete data provided", http.StatusBadRequest)
 		return
 	}
+	if !bodyOwner(w, r, newCard.UserID) {
+		return
+	}
+
+	condition, language, finish, err := models.NormalizeRawAttributes(newCard.Card.Condition, newCard.Card.Language, newCard.Card.Finish)
+	if err != nil {
+		log.Printf("Invalid card attributes: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newCard.Card.Condition, newCard.Card.Language, newCard.Card.Finish = condition, language, finish
 
-	// Fetch the card from the API
+	// Fetch the card from the API and merge it with user-provided data
 	apiKey := os.Getenv("POKEMON_TCG_API_KEY")
-	fetchedCard, err := services.FetchCardFromAPI(apiKey, fmt.Sprintf("%s-%s", newCard.Card.Set, newCard.Card.Name))
+	mergedCard, err := services.ResolveCard(apiKey, newCard.Card)
 	if err != nil {
 		log.Printf("Error fetching card details: %v", err)
 		http.Error(w, fmt.Sprintf("Error fetching card details: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Merge fetched card data with user-provided data
-	mergedCard := models.Card{
-		ID:            fetchedCard.ID,
-		Name:          newCard.Card.Name,
-		Edition:       newCard.Card.Edition,
-		Set:           newCard.Card.Set,
-		Image:         fetchedCard.Image,
-		Grade:         newCard.Card.Grade,
-		PurchasePrice: newCard.Card.PurchasePrice,
-		Quantity:      newCard.Card.Quantity,
-		Type:          "Pokemon Card",
-	}
-
 	log.Printf("Merged card data: %+v", mergedCard)
 
-	// Add the card to the collection
-	err = services.AddCardToCollection(newCard.UserID, newCard.CollectionName, mergedCard)
+	// Add the card to the collection as a new copy
+	mergedCard.UserItemID, err = services.AddCardToCollection(r.Context(), newCard.UserID, newCard.CollectionName, mergedCard)
 	if err != nil {
 		log.Printf("Error adding card to collection: %v", err)
 		http.Error(w, fmt.Sprintf("Error adding card to collection: %v", err), http.StatusInternalServerError)
@@ -207,7 +309,7 @@ func RemoveCardFromCollectionWithUserIDAndCollection(w http.ResponseWriter, r *h
 
 	log.Printf("RemoveCardFromCollectionWithUserIDAndCollection: Received request to remove card with ID: %s from collection: %s for user ID: %s", cardID, collectionName, userID)
 
-	err := services.RemoveCardFromCollection(userID, collectionName, cardID)
+	err := services.RemoveCardFromCollection(r.Context(), userID, collectionName, cardID)
 	if err != nil {
 		log.Printf("RemoveCardFromCollectionWithUserIDAndCollection: Error removing card: %v", err)
 		http.Error(w, "Error removing card from collection", http.StatusInternalServerError)
@@ -217,3 +319,25 @@ func RemoveCardFromCollectionWithUserIDAndCollection(w http.ResponseWriter, r *h
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]bool{"success": true})
 }
+
+func RemoveCardCopy(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	userItemID, err := strconv.Atoi(vars["user_item_id"])
+	if err != nil {
+		http.Error(w, "Invalid user item ID", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("RemoveCardCopy: Received request to remove copy %d for user ID: %s", userItemID, userID)
+
+	err = services.RemoveCardCopy(r.Context(), userID, userItemID)
+	if err != nil {
+		log.Printf("RemoveCardCopy: Error removing copy: %v", err)
+		http.Error(w, "Error removing card copy", cardErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
@@ -2,25 +2,96 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
 
 	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/services"
 	"github.com/gorilla/mux"
 )
 
-var userCarts = make(map[string]models.Cart)
+// userCarts holds each user's cart in memory, guarded by cartsMu. Carts are
+// copied in and out so handlers never share item slices.
+var (
+	cartsMu   sync.Mutex
+	userCarts = make(map[string]models.Cart)
+)
+
+var (
+	errCartNotFound     = errors.New("cart not found")
+	errCartItemNotFound = errors.New("item not found in cart")
+)
+
+func copyCart(cart models.Cart) models.Cart {
+	cart.Items = append([]models.CartItem{}, cart.Items...)
+	return cart
+}
+
+// loadCart returns a copy of a user's cart.
+func loadCart(userID string) (models.Cart, bool) {
+	cartsMu.Lock()
+	defer cartsMu.Unlock()
+	cart, exists := userCarts[userID]
+	return copyCart(cart), exists
+}
+
+// updateCart applies change to a user's cart and stores the result, unless
+// change fails. A missing cart is created when create is set and is
+// errCartNotFound otherwise.
+func updateCart(userID string, create bool, change func(cart *models.Cart) error) (models.Cart, error) {
+	cartsMu.Lock()
+	defer cartsMu.Unlock()
+
+	cart, exists := userCarts[userID]
+	if !exists {
+		if !create {
+			return models.Cart{}, errCartNotFound
+		}
+		log.Printf("Cart not found for user_id: %s. Creating new cart.", userID)
+		cart = models.Cart{UserID: userID}
+	}
+	cart = copyCart(cart)
+	if err := change(&cart); err != nil {
+		return models.Cart{}, err
+	}
+	userCarts[userID] = cart
+	return copyCart(cart), nil
+}
+
+// takeCart empties a user's cart and returns what was in it, so two
+// checkouts can't both buy the same cart.
+func takeCart(userID string) models.Cart {
+	cartsMu.Lock()
+	defer cartsMu.Unlock()
+	cart := userCarts[userID]
+	delete(userCarts, userID)
+	return cart
+}
+
+// restoreCart puts back a cart taken for a checkout that failed, ahead of
+// anything added since.
+func restoreCart(userID string, cart models.Cart) {
+	cartsMu.Lock()
+	defer cartsMu.Unlock()
+	if added, exists := userCarts[userID]; exists {
+		cart.Items = append(cart.Items, added.Items...)
+	}
+	cart.UserID = userID
+	userCarts[userID] = cart
+}
 
 func GetCart(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["user_id"]
 	log.Printf("GetCart called for user_id: %s", userID)
 
-	cart, exists := userCarts[userID]
+	cart, exists := loadCart(userID)
 	if !exists {
-		log.Printf("Cart not found for user_id: %s. Creating new cart.", userID)
-		cart = models.Cart{UserID: userID, Items: []models.CartItem{}}
+		log.Printf("Cart not found for user_id: %s. Returning an empty cart.", userID)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -34,8 +105,10 @@ func AddToCart(w http.ResponseWriter, r *http.Request) {
 	log.Printf("AddToCart called for user_id: %s", userID)
 
 	var item struct {
-		ProductID int `json:"ProductID"`
-		Quantity  int `json:"Quantity"`
+		ProductID        int `json:"ProductID"`
+		ListingID        int `json:"ListingID"`
+		ShippingOptionID int `json:"ShippingOptionID"`
+		Quantity         int `json:"Quantity"`
 	}
 	err := json.NewDecoder(r.Body).Decode(&item)
 	if err != nil {
@@ -45,49 +118,78 @@ func AddToCart(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("Received item to add: %+v", item)
 
-	// Fetch product details
-	product, err := getProductById(item.ProductID)
-	if err != nil {
-		log.Printf("Error fetching product details: %v", err)
-		http.Error(w, "Product not found", http.StatusNotFound)
-		return
-	}
-
-	// Create a new CartItem with all details
-	newItem := models.CartItem{
-		ProductID: item.ProductID,
-		Quantity:  item.Quantity,
-		Name:      product.Name,
-		Price:     product.Price,
-		Image:     product.Image,
-	}
+	var newItem models.CartItem
+	if item.ListingID != 0 {
+		// A listing is bought whole, so it is in the cart at most once
+		listing, err := services.GetListing(item.ListingID)
+		if err != nil {
+			log.Printf("Error fetching listing %d: %v", item.ListingID, err)
+			http.Error(w, err.Error(), listingErrorStatus(err))
+			return
+		}
+		if !listing.Available {
+			http.Error(w, services.ErrListingUnavailable.Error(), http.StatusConflict)
+			return
+		}
+		if strconv.Itoa(listing.SellerID) == userID {
+			http.Error(w, "You can't buy your own listing", http.StatusBadRequest)
+			return
+		}
+		newItem = models.CartItem{
+			ListingID:        listing.ListingID,
+			ShippingOptionID: item.ShippingOptionID,
+			Quantity:         1,
+			Name:             listing.Name,
+			Price:            fmt.Sprintf("$%.2f", listing.Price),
+			Image:            listing.Image,
+		}
+	} else {
+		// Fetch product details
+		product, err := getProductById(item.ProductID)
+		if err != nil {
+			log.Printf("Error fetching product details: %v", err)
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
 
-	// Check if the item already exists in the cart
-	cart, exists := userCarts[userID]
-	if !exists {
-		log.Printf("Cart not found for user_id: %s. Creating new cart.", userID)
-		cart = models.Cart{UserID: userID, Items: []models.CartItem{}}
+		// Create a new CartItem with all details
+		newItem = models.CartItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Name:      product.Name,
+			Price:     product.Price,
+			Image:     product.Image,
+		}
 	}
 
-	for i, cartItem := range cart.Items {
-		if cartItem.ProductID == newItem.ProductID {
-			log.Printf("Item %d already exists in cart. Updating quantity.", newItem.ProductID)
-			cart.Items[i].Quantity += newItem.Quantity
-			userCarts[userID] = cart
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(cart)
-			log.Printf("Updated cart for user_id: %s - Cart: %+v", userID, cart)
-			return
+	cart, err := updateCart(userID, true, func(cart *models.Cart) error {
+		// Check if the item already exists in the cart
+		for i, cartItem := range cart.Items {
+			if cartItem.ProductID == newItem.ProductID && cartItem.ListingID == newItem.ListingID {
+				if newItem.ListingID != 0 {
+					log.Printf("Listing %d already exists in cart. Updating shipping option.", newItem.ListingID)
+					cart.Items[i].ShippingOptionID = newItem.ShippingOptionID
+				} else {
+					log.Printf("Item %d already exists in cart. Updating quantity.", newItem.ProductID)
+					cart.Items[i].Quantity += newItem.Quantity
+				}
+				return nil
+			}
 		}
-	}
 
-	// If the item doesn't exist, add it to the cart
-	log.Printf("Adding new item to cart for user_id: %s", userID)
-	cart.Items = append(cart.Items, newItem)
-	userCarts[userID] = cart
+		// If the item doesn't exist, add it to the cart
+		log.Printf("Adding new item to cart for user_id: %s", userID)
+		cart.Items = append(cart.Items, newItem)
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(cart)
+	log.Printf("Updated cart for user_id: %s - Cart: %+v", userID, cart)
 }
 
 func UpdateCartItem(w http.ResponseWriter, r *http.Request) {
@@ -95,8 +197,10 @@ func UpdateCartItem(w http.ResponseWriter, r *http.Request) {
 	userID := vars["user_id"]
 
 	var updateRequest struct {
-		ProductID int `json:"ProductID"`
-		Quantity  int `json:"Quantity"`
+		ProductID        int `json:"ProductID"`
+		ListingID        int `json:"ListingID"`
+		ShippingOptionID int `json:"ShippingOptionID"`
+		Quantity         int `json:"Quantity"`
 	}
 	err := json.NewDecoder(r.Body).Decode(&updateRequest)
 	if err != nil {
@@ -104,23 +208,27 @@ func UpdateCartItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cart, exists := userCarts[userID]
-	if !exists {
-		http.Error(w, "Cart not found", http.StatusNotFound)
-		return
-	}
-
-	for i, cartItem := range cart.Items {
-		if cartItem.ProductID == updateRequest.ProductID {
-			cart.Items[i].Quantity = updateRequest.Quantity
-			userCarts[userID] = cart
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(cart.Items)
-			return
+	cart, err := updateCart(userID, false, func(cart *models.Cart) error {
+		for i, cartItem := range cart.Items {
+			if cartItem.ProductID == updateRequest.ProductID && cartItem.ListingID == updateRequest.ListingID {
+				// Listings are bought whole; only their shipping option changes
+				if cartItem.ListingID != 0 {
+					cart.Items[i].ShippingOptionID = updateRequest.ShippingOptionID
+				} else {
+					cart.Items[i].Quantity = updateRequest.Quantity
+				}
+				return nil
+			}
 		}
+		return errCartItemNotFound
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
 	}
 
-	http.Error(w, "Item not found in cart", http.StatusNotFound)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cart.Items)
 }
 
 func RemoveFromCart(w http.ResponseWriter, r *http.Request) {
@@ -129,6 +237,7 @@ func RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 
 	var request struct {
 		ProductID int `json:"ProductID"`
+		ListingID int `json:"ListingID"`
 	}
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
@@ -136,23 +245,22 @@ func RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cart, exists := userCarts[userID]
-	if !exists {
-		http.Error(w, "Cart not found", http.StatusNotFound)
-		return
-	}
-
-	for i, cartItem := range cart.Items {
-		if cartItem.ProductID == request.ProductID {
-			cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
-			userCarts[userID] = cart
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(cart.Items)
-			return
+	cart, err := updateCart(userID, false, func(cart *models.Cart) error {
+		for i, cartItem := range cart.Items {
+			if cartItem.ProductID == request.ProductID && cartItem.ListingID == request.ListingID {
+				cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
+				return nil
+			}
 		}
+		return errCartItemNotFound
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
 	}
 
-	http.Error(w, "Item not found in cart", http.StatusNotFound)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cart.Items)
 }
 
 // Add this function to fetch product details
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 
@@ -35,7 +37,7 @@ func CreateCollectionByUserIDandCollectionName(w http.ResponseWriter, r *http.Re
 	userID := vars["user_id"]
 	collectionName := vars["collection_name"]
 
-	err := services.CreateCollection(userID, collectionName)
+	_, err := services.CreateCollection(r.Context(), userID, collectionName)
 	if err != nil {
 		http.Error(w, "Error creating collection", http.StatusInternalServerError)
 		return
@@ -50,7 +52,7 @@ func DeleteCollectionByUserIDandCollectionName(w http.ResponseWriter, r *http.Re
 	userID := vars["user_id"]
 	collectionName := vars["collection_name"]
 
-	err := services.DeleteCollection(userID, collectionName)
+	err := services.DeleteCollection(r.Context(), userID, collectionName)
 	if err != nil {
 		http.Error(w, "Error deleting collection", http.StatusInternalServerError)
 		return
@@ -58,3 +60,143 @@ func DeleteCollectionByUserIDandCollectionName(w http.ResponseWriter, r *http.Re
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// collectionErrorStatus maps collection service errors to HTTP status codes.
+func collectionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCollectionNotFound), errors.Is(err, services.ErrCardNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCollectionExists):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidVisibility), errors.Is(err, services.ErrInvalidTransfer):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func RenameCollection(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	collectionName := vars["collection_name"]
+
+	var requestBody struct {
+		NewName string `json:"new_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.NewName == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("RenameCollection: Renaming %s to %s for user ID: %s", collectionName, requestBody.NewName, userID)
+
+	if err := services.RenameCollection(r.Context(), userID, collectionName, requestBody.NewName); err != nil {
+		log.Printf("RenameCollection: Error renaming collection: %v", err)
+		http.Error(w, fmt.Sprintf("Error renaming collection: %v", err), collectionErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// visibilityRequest is the body of the collection visibility routes.
+type visibilityRequest struct {
+	Visibility string `json:"visibility"`
+	RotateSlug bool   `json:"rotate_slug"`
+}
+
+// SetCollectionVisibility makes a collection private, unlisted or public and
+// returns it with its share slug.
+func SetCollectionVisibility(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	collectionName := vars["collection_name"]
+
+	var requestBody visibilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	collectionID, err := services.GetCollectionID(userID, collectionName)
+	if err != nil {
+		http.Error(w, "Collection not found", collectionErrorStatus(err))
+		return
+	}
+
+	collection, err := services.SetCollectionVisibility(r.Context(), userID, collectionID, requestBody.Visibility, requestBody.RotateSlug)
+	if err != nil {
+		log.Printf("SetCollectionVisibility: Error sharing collection %s: %v", collectionName, err)
+		http.Error(w, err.Error(), collectionErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+func TransferCopies(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	collectionName := vars["collection_name"]
+
+	var requestBody struct {
+		TargetCollection string `json:"target_collection"`
+		UserItemIDs      []int  `json:"user_item_ids"`
+		Mode             string `json:"mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if requestBody.TargetCollection == "" || len(requestBody.UserItemIDs) == 0 {
+		http.Error(w, "target_collection and user_item_ids are required", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Mode != "" && requestBody.Mode != services.TransferMove && requestBody.Mode != services.TransferCopy {
+		http.Error(w, "mode must be move or copy", http.StatusBadRequest)
+		return
+	}
+
+	transferred, err := services.TransferCopies(r.Context(), userID, collectionName, requestBody.TargetCollection, requestBody.UserItemIDs, requestBody.Mode)
+	if err != nil {
+		log.Printf("TransferCopies: Error transferring copies: %v", err)
+		http.Error(w, fmt.Sprintf("Error transferring copies: %v", err), collectionErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]int{"user_item_ids": transferred})
+}
+
+func MergeCollections(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	collectionName := vars["collection_name"]
+
+	var requestBody struct {
+		TargetCollection string `json:"target_collection"`
+		Policy           string `json:"policy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.TargetCollection == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Policy != "" && requestBody.Policy != services.MergeCombine && requestBody.Policy != services.MergeKeepSeparate {
+		http.Error(w, "policy must be combine or keep_separate", http.StatusBadRequest)
+		return
+	}
+	if requestBody.TargetCollection == collectionName {
+		http.Error(w, "Cannot merge a collection into itself", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.MergeCollections(r.Context(), userID, collectionName, requestBody.TargetCollection, requestBody.Policy); err != nil {
+		log.Printf("MergeCollections: Error merging collections: %v", err)
+		http.Error(w, fmt.Sprintf("Error merging collections: %v", err), collectionErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/gorilla/mux"
+)
+
+// The v2 collection API addresses collections by collection_id instead of by
+// name, so names may contain any character and can change without breaking
+// links. The name-based routes remain as shims over the same services.
+
+// requestUserID returns the user a v2 request acts for, named by the user_id
+// query parameter and checked against the signed-in user by middleware.Owner.
+func requestUserID(r *http.Request) string {
+	return r.URL.Query().Get("user_id")
+}
+
+// collectionIDFromPath parses the {collection_id} route variable, writing a
+// 400 response and returning false when it is not a number.
+func collectionIDFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	collectionID, err := strconv.Atoi(mux.Vars(r)["collection_id"])
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return collectionID, true
+}
+
+func ListCollectionsV2(w http.ResponseWriter, r *http.Request) {
+	collections, err := services.GetCollectionsByUserID(requestUserID(r))
+	if err != nil {
+		log.Printf("Error fetching collections: %v", err)
+		http.Error(w, "Error fetching collections", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collections)
+}
+
+func CreateCollectionV2(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		CollectionName string `json:"collection_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.CollectionName == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	collectionID, err := services.CreateCollection(r.Context(), requestUserID(r), requestBody.CollectionName)
+	if err != nil {
+		log.Printf("Error creating collection: %v", err)
+		http.Error(w, "Error creating collection", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.Collection{CollectionID: collectionID, CollectionName: requestBody.CollectionName})
+}
+
+func GetCollectionV2(w http.ResponseWriter, r *http.Request) {
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	collection, err := services.GetCollectionByID(requestUserID(r), collectionID)
+	if err != nil {
+		log.Printf("Error fetching collection %d: %v", collectionID, err)
+		http.Error(w, "Collection not found", collectionErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+func RenameCollectionV2(w http.ResponseWriter, r *http.Request) {
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		CollectionName string `json:"collection_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.CollectionName == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.RenameCollectionByID(r.Context(), requestUserID(r), collectionID, requestBody.CollectionName); err != nil {
+		log.Printf("Error renaming collection %d: %v", collectionID, err)
+		http.Error(w, fmt.Sprintf("Error renaming collection: %v", err), collectionErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.Collection{CollectionID: collectionID, CollectionName: requestBody.CollectionName})
+}
+
+func SetCollectionVisibilityV2(w http.ResponseWriter, r *http.Request) {
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var requestBody visibilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	collection, err := services.SetCollectionVisibility(r.Context(), requestUserID(r), collectionID, requestBody.Visibility, requestBody.RotateSlug)
+	if err != nil {
+		log.Printf("Error sharing collection %d: %v", collectionID, err)
+		http.Error(w, err.Error(), collectionErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+func DeleteCollectionV2(w http.ResponseWriter, r *http.Request) {
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := services.DeleteCollectionByID(r.Context(), requestUserID(r), collectionID); err != nil {
+		log.Printf("Error deleting collection %d: %v", collectionID, err)
+		http.Error(w, "Error deleting collection", collectionErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetCollectionCardsV2(w http.ResponseWriter, r *http.Request) {
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	cards, err := services.GetCardsByCollectionID(requestUserID(r), collectionID)
+	if err != nil {
+		log.Printf("Error fetching cards for collection %d: %v", collectionID, err)
+		http.Error(w, "Error fetching cards", http.StatusInternalServerError)
+		return
+	}
+	if cards == nil {
+		cards = []models.Card{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cards)
+}
+
+func AddCardToCollectionV2(w http.ResponseWriter, r *http.Request) {
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var card models.Card
+	if err := json.NewDecoder(r.Body).Decode(&card); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	if card.Name == "" || card.Set == "" {
+		http.Error(w, "Invalid or incomplete data provided", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	card.Condition, card.Language, card.Finish, err = models.NormalizeRawAttributes(card.Condition, card.Language, card.Finish)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	card, err = services.ResolveCard(os.Getenv("POKEMON_TCG_API_KEY"), card)
+	if err != nil {
+		log.Printf("Error fetching card details: %v", err)
+		http.Error(w, fmt.Sprintf("Error fetching card details: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	card.UserItemID, err = services.AddCardToCollectionByID(r.Context(), requestUserID(r), collectionID, card)
+	if err != nil {
+		log.Printf("Error adding card to collection %d: %v", collectionID, err)
+		http.Error(w, fmt.Sprintf("Error adding card to collection: %v", err), collectionErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(card)
+}
+
+func UpdateCardQuantityV2(w http.ResponseWriter, r *http.Request) {
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		UserItemID int `json:"user_item_id"`
+		Quantity   int `json:"quantity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	card, err := services.UpdateCardQuantityByCollectionID(r.Context(), requestUserID(r), collectionID, mux.Vars(r)["card_id"], requestBody.UserItemID, requestBody.Quantity)
+	if err != nil {
+		log.Printf("Error updating card quantity: %v", err)
+		http.Error(w, fmt.Sprintf("Error updating card quantity: %v", err), cardErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(card)
+}
+
+func UpdateCardAttributesV2(w http.ResponseWriter, r *http.Request) {
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		UserItemID int         `json:"user_item_id"`
+		Grade      interface{} `json:"grade"`
+		Condition  string      `json:"condition"`
+		Language   string      `json:"language"`
+		Finish     string      `json:"finish"`
+		AcquiredAt *time.Time  `json:"acquired_at"`
+		Notes      string      `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if _, _, _, err := models.NormalizeRawAttributes(requestBody.Condition, requestBody.Language, requestBody.Finish); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	attributes := models.Card{
+		Grade:      requestBody.Grade,
+		Condition:  requestBody.Condition,
+		Language:   requestBody.Language,
+		Finish:     requestBody.Finish,
+		AcquiredAt: requestBody.AcquiredAt,
+		Notes:      requestBody.Notes,
+	}
+	card, err := services.UpdateCardAttributesByCollectionID(r.Context(), requestUserID(r), collectionID, mux.Vars(r)["card_id"], requestBody.UserItemID, attributes)
+	if err != nil {
+		log.Printf("Error updating card attributes: %v", err)
+		http.Error(w, fmt.Sprintf("Error updating card attributes: %v", err), cardErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(card)
+}
+
+func RemoveCardFromCollectionV2(w http.ResponseWriter, r *http.Request) {
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := services.RemoveCardFromCollectionByID(r.Context(), requestUserID(r), collectionID, mux.Vars(r)["card_id"]); err != nil {
+		log.Printf("Error removing card from collection %d: %v", collectionID, err)
+		http.Error(w, "Error removing card from collection", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TransferCopiesV2(w http.ResponseWriter, r *http.Request) {
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		TargetCollectionID int    `json:"target_collection_id"`
+		UserItemIDs        []int  `json:"user_item_ids"`
+		Mode               string `json:"mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if requestBody.TargetCollectionID == 0 || len(requestBody.UserItemIDs) == 0 {
+		http.Error(w, "target_collection_id and user_item_ids are required", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Mode != "" && requestBody.Mode != services.TransferMove && requestBody.Mode != services.TransferCopy {
+		http.Error(w, "mode must be move or copy", http.StatusBadRequest)
+		return
+	}
+
+	transferred, err := services.TransferCopiesByID(r.Context(), requestUserID(r), collectionID, requestBody.TargetCollectionID, requestBody.UserItemIDs, requestBody.Mode)
+	if err != nil {
+		log.Printf("Error transferring copies: %v", err)
+		http.Error(w, fmt.Sprintf("Error transferring copies: %v", err), collectionErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]int{"user_item_ids": transferred})
+}
+
+func MergeCollectionsV2(w http.ResponseWriter, r *http.Request) {
+	collectionID, ok := collectionIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		TargetCollectionID int    `json:"target_collection_id"`
+		Policy             string `json:"policy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.TargetCollectionID == 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Policy != "" && requestBody.Policy != services.MergeCombine && requestBody.Policy != services.MergeKeepSeparate {
+		http.Error(w, "policy must be combine or keep_separate", http.StatusBadRequest)
+		return
+	}
+	if requestBody.TargetCollectionID == collectionID {
+		http.Error(w, "Cannot merge a collection into itself", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.MergeCollectionsByID(r.Context(), requestUserID(r), collectionID, requestBody.TargetCollectionID, requestBody.Policy); err != nil {
+		log.Printf("Error merging collections: %v", err)
+		http.Error(w, fmt.Sprintf("Error merging collections: %v", err), collectionErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
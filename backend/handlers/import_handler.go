@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/CatsMeow492/PokemonCollection/importers"
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/gorilla/mux"
+)
+
+// maxImportUploadSize caps the size of an uploaded import file.
+const maxImportUploadSize = 10 << 20
+
+func importErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrImportMapping), errors.Is(err, services.ErrArchiveVersion):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrImportTooLarge):
+		return http.StatusRequestEntityTooLarge
+	}
+	return collectionErrorStatus(err)
+}
+
+// ImportCollection imports a file into a collection. The multipart form
+// carries the file, its format ("csv" by default, "archive", or the name of
+// one of the importers adapters such as "tcgplayer"), an optional JSON column
+// mapping for plain CSV and, for committing after a preview, JSON selections
+// of candidate card IDs for ambiguous lines keyed by line number. With dry_run=true nothing is written and the response
+// is a preview of how each line resolved.
+func ImportCollection(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	collectionName := vars["collection_name"]
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportUploadSize)
+	if err := r.ParseMultipartForm(maxImportUploadSize); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid upload: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "An import file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	format := r.FormValue("format")
+	adapter, isAdapter := importers.Get(format)
+	if format != "" && format != "csv" && format != "archive" && !isAdapter {
+		http.Error(w, fmt.Sprintf("Unknown format %q; expected csv, archive or one of %v", format, importers.Formats()), http.StatusBadRequest)
+		return
+	}
+
+	if format == "archive" {
+		var archive models.CollectionArchive
+		if err := json.NewDecoder(file).Decode(&archive); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid archive: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("ImportCollection: Restoring archive into %s for user ID: %s (dry run: %t)", collectionName, userID, dryRun)
+
+		report, err := services.ImportArchive(r.Context(), userID, collectionName, &archive, dryRun)
+		if err != nil {
+			log.Printf("ImportCollection: Error restoring archive: %v", err)
+			http.Error(w, fmt.Sprintf("Error restoring archive: %v", err), importErrorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+
+	var mapping models.ImportMapping
+	if raw := r.FormValue("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid mapping: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var selections map[int]string
+	if raw := r.FormValue("selections"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &selections); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid selections: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	log.Printf("ImportCollection: Importing %s file into %s for user ID: %s (dry run: %t)", format, collectionName, userID, dryRun)
+
+	var rows []models.ImportRow
+	if isAdapter {
+		rows, err = adapter.Parse(file)
+		if err != nil {
+			log.Printf("ImportCollection: Error parsing %s file: %v", format, err)
+			http.Error(w, fmt.Sprintf("Error reading %s file: %v", format, err), http.StatusBadRequest)
+			return
+		}
+		if len(rows) > services.MaxImportRows {
+			http.Error(w, services.ErrImportTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+	} else {
+		rows, err = services.ParseImportCSV(file, mapping)
+		if err != nil {
+			log.Printf("ImportCollection: Error parsing file: %v", err)
+			http.Error(w, fmt.Sprintf("Error reading CSV: %v", err), importErrorStatus(err))
+			return
+		}
+	}
+
+	report, err := services.ImportCards(r.Context(), os.Getenv("POKEMON_TCG_API_KEY"), userID, collectionName, rows, selections, dryRun)
+	if err != nil {
+		log.Printf("ImportCollection: Error importing cards: %v", err)
+		http.Error(w, fmt.Sprintf("Error importing cards: %v", err), importErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// ExportCollection downloads a collection as CSV, as JSON in the shape the
+// collections API returns, or as a versioned archive that can be imported
+// back with format=archive.
+func ExportCollection(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	collectionName := vars["collection_name"]
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "csv" && format != "json" && format != "archive" {
+		http.Error(w, "format must be csv, json or archive", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("ExportCollection: Exporting %s for user ID: %s as %s", collectionName, userID, format)
+
+	archive, err := services.ExportCollection(userID, collectionName)
+	if err != nil {
+		log.Printf("ExportCollection: Error exporting collection: %v", err)
+		http.Error(w, "Error exporting collection", collectionErrorStatus(err))
+		return
+	}
+
+	filename := strings.NewReplacer(`"`, "", "/", "-", `\`, "-").Replace(collectionName)
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, filename))
+		if err := services.WriteCollectionCSV(w, archive); err != nil {
+			log.Printf("ExportCollection: Error writing CSV: %v", err)
+		}
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		json.NewEncoder(w).Encode(models.Collection{CollectionName: collectionName, Cards: archive.Cards, Items: archive.Items})
+	case "archive":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.archive.json"`, filename))
+		json.NewEncoder(w).Encode(archive)
+	}
+}
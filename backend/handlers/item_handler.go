@@ -37,6 +37,7 @@ func UpdateItemQuantity(w http.ResponseWriter, r *http.Request) {
 		UserID         string `json:"user_id"`
 		CollectionName string `json:"collection_name"`
 		ItemID         string `json:"item_id"`
+		UserItemID     int    `json:"user_item_id"`
 		Quantity       int    `json:"quantity"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
@@ -44,11 +45,14 @@ func UpdateItemQuantity(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if !bodyOwner(w, r, requestBody.UserID) {
+		return
+	}
 
-	updatedItem, err := services.UpdateItemQuantity(requestBody.UserID, requestBody.CollectionName, requestBody.ItemID, requestBody.Quantity)
+	updatedItem, err := services.UpdateItemQuantity(r.Context(), requestBody.UserID, requestBody.CollectionName, requestBody.ItemID, requestBody.UserItemID, requestBody.Quantity)
 	if err != nil {
 		log.Printf("Error updating item quantity: %v", err)
-		http.Error(w, "Error updating item quantity", http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error updating item quantity: %v", err), cardErrorStatus(err))
 		return
 	}
 
@@ -80,9 +84,8 @@ func AddItemWithUserIDAndCollection(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Parsed item data: %+v", itemData)
 
 	itemData.ID = generateUniqueID()
-	itemData.PurchasePrice = itemData.PurchasePrice // Ensure this is set correctly
 
-	err = services.AddItemToCollection(userID, collectionName, itemData)
+	err = services.AddItemToCollection(r.Context(), userID, collectionName, itemData)
 	if err != nil {
 		log.Printf("Error adding item to collection: %v", err)
 		http.Error(w, fmt.Sprintf("Error adding item to collection: %v", err), http.StatusInternalServerError)
@@ -102,7 +105,7 @@ func RemoveItemFromCollectionWithUserIDAndCollection(w http.ResponseWriter, r *h
 
 	log.Printf("RemoveItemFromCollectionWithUserIDAndCollection: Received request to remove item with ID: %s from collection: %s for user ID: %s", itemID, collectionName, userID)
 
-	err := services.RemoveItemFromCollection(userID, collectionName, itemID)
+	err := services.RemoveItemFromCollection(r.Context(), userID, collectionName, itemID)
 	if err != nil {
 		log.Printf("RemoveItemFromCollectionWithUserIDAndCollection: Error removing item: %v", err)
 		http.Error(w, "Error removing item from collection", http.StatusInternalServerError)
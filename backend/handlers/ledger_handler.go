@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/gorilla/mux"
+)
+
+// ledgerErrorStatus maps ledger service errors to HTTP status codes.
+func ledgerErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidLedgerEntry), errors.Is(err, services.ErrInsufficientQuantity):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrCardNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func GetLedgerByUserID(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+	itemID := r.URL.Query().Get("item_id")
+
+	ledger, err := services.GetLedgerByUserID(userID, itemID)
+	if err != nil {
+		log.Printf("Error fetching ledger: %v", err)
+		http.Error(w, "Error fetching ledger", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ledger)
+}
+
+func GetLedgerItemHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	ledger, err := services.GetLedgerByUserID(vars["user_id"], vars["item_id"])
+	if err != nil {
+		log.Printf("Error fetching item history: %v", err)
+		http.Error(w, "Error fetching item history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ledger)
+}
+
+func RecordDisposal(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	var requestBody struct {
+		UserItemID   int        `json:"user_item_id"`
+		EntryType    string     `json:"entry_type"`
+		Quantity     int        `json:"quantity"`
+		Price        float64    `json:"price"`
+		Fees         float64    `json:"fees"`
+		Shipping     float64    `json:"shipping"`
+		Counterparty string     `json:"counterparty"`
+		Notes        string     `json:"notes"`
+		OccurredAt   *time.Time `json:"occurred_at"`
+		Method       string     `json:"method"`
+		LotIDs       []int      `json:"lot_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	entry := models.LedgerEntry{
+		UserItemID:   &requestBody.UserItemID,
+		EntryType:    requestBody.EntryType,
+		Quantity:     requestBody.Quantity,
+		Price:        requestBody.Price,
+		Fees:         requestBody.Fees,
+		Shipping:     requestBody.Shipping,
+		Counterparty: requestBody.Counterparty,
+		Notes:        requestBody.Notes,
+	}
+	if requestBody.OccurredAt != nil {
+		entry.OccurredAt = *requestBody.OccurredAt
+	}
+
+	recorded, err := services.RecordDisposal(r.Context(), userID, entry, requestBody.Method, requestBody.LotIDs)
+	if err != nil {
+		log.Printf("Error recording disposal: %v", err)
+		http.Error(w, fmt.Sprintf("Error recording disposal: %v", err), ledgerErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(recorded)
+}
+
+func RecordGrading(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	var requestBody struct {
+		UserItemID int        `json:"user_item_id"`
+		Grader     string     `json:"grader"`
+		Grade      string     `json:"grade"`
+		Price      float64    `json:"price"`
+		Fees       float64    `json:"fees"`
+		Shipping   float64    `json:"shipping"`
+		Notes      string     `json:"notes"`
+		OccurredAt *time.Time `json:"occurred_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	entry := models.LedgerEntry{
+		UserItemID:   &requestBody.UserItemID,
+		Price:        requestBody.Price,
+		Fees:         requestBody.Fees,
+		Shipping:     requestBody.Shipping,
+		Counterparty: requestBody.Grader,
+		Notes:        requestBody.Notes,
+	}
+	if requestBody.OccurredAt != nil {
+		entry.OccurredAt = *requestBody.OccurredAt
+	}
+
+	recorded, err := services.RecordGrading(r.Context(), userID, entry, requestBody.Grade)
+	if err != nil {
+		log.Printf("Error recording grading submission: %v", err)
+		http.Error(w, fmt.Sprintf("Error recording grading submission: %v", err), ledgerErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(recorded)
+}
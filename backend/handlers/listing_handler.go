@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/CatsMeow492/PokemonCollection/auth"
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/gorilla/mux"
+)
+
+// Browsing listings is public; creating and changing them acts for the
+// signed-in seller.
+
+// listingErrorStatus maps listing service errors to HTTP status codes.
+func listingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidListing):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrListingNotFound), errors.Is(err, services.ErrCardNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrListingUnavailable):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// listingIDFromPath parses the {listing_id} route variable, writing a 400
+// response and returning false when it is not a number.
+func listingIDFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	listingID, err := strconv.Atoi(mux.Vars(r)["listing_id"])
+	if err != nil {
+		http.Error(w, "Invalid listing ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return listingID, true
+}
+
+func writeListing(w http.ResponseWriter, status int, listing *models.Listing) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(listing)
+}
+
+// SearchListings browses listings for sale. It takes q, item_id, set, grade,
+// condition, seller, min_price, max_price, sort, limit and offset query
+// parameters.
+func SearchListings(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	search := models.ListingSearch{
+		Query:     query.Get("q"),
+		ItemID:    query.Get("item_id"),
+		Set:       query.Get("set"),
+		Grade:     query.Get("grade"),
+		Condition: query.Get("condition"),
+		Seller:    query.Get("seller"),
+		Sort:      query.Get("sort"),
+	}
+
+	var err error
+	if value := query.Get("min_price"); value != "" {
+		if search.MinPrice, err = strconv.ParseFloat(value, 64); err != nil {
+			http.Error(w, "Invalid min_price", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("max_price"); value != "" {
+		if search.MaxPrice, err = strconv.ParseFloat(value, 64); err != nil {
+			http.Error(w, "Invalid max_price", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if search.Limit, err = strconv.Atoi(value); err != nil {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		if search.Offset, err = strconv.Atoi(value); err != nil {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	listings, err := services.SearchListings(search)
+	if err != nil {
+		log.Printf("SearchListings: Error searching listings: %v", err)
+		http.Error(w, err.Error(), listingErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listings)
+}
+
+func GetListing(w http.ResponseWriter, r *http.Request) {
+	listingID, ok := listingIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	listing, err := services.GetListing(listingID)
+	if err != nil {
+		http.Error(w, err.Error(), listingErrorStatus(err))
+		return
+	}
+	writeListing(w, http.StatusOK, listing)
+}
+
+// GetMyListings returns all of the signed-in user's listings, including sold
+// and withdrawn ones.
+func GetMyListings(w http.ResponseWriter, r *http.Request) {
+	listings, err := services.GetListingsBySeller(auth.ClaimsFromContext(r.Context()).UserID)
+	if err != nil {
+		log.Printf("GetMyListings: Error listing listings: %v", err)
+		http.Error(w, "Error fetching listings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listings)
+}
+
+func CreateListing(w http.ResponseWriter, r *http.Request) {
+	claims := auth.ClaimsFromContext(r.Context())
+
+	var req models.ListingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("CreateListing: User %d listing copy %d at %.2f", claims.UserID, req.UserItemID, req.Price)
+
+	listing, err := services.CreateListing(claims.UserID, req)
+	if err != nil {
+		log.Printf("CreateListing: Error creating listing: %v", err)
+		http.Error(w, err.Error(), listingErrorStatus(err))
+		return
+	}
+	writeListing(w, http.StatusCreated, listing)
+}
+
+func UpdateListing(w http.ResponseWriter, r *http.Request) {
+	listingID, ok := listingIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ListingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	listing, err := services.UpdateListing(auth.ClaimsFromContext(r.Context()).UserID, listingID, req)
+	if err != nil {
+		log.Printf("UpdateListing: Error updating listing %d: %v", listingID, err)
+		http.Error(w, err.Error(), listingErrorStatus(err))
+		return
+	}
+	writeListing(w, http.StatusOK, listing)
+}
+
+func WithdrawListing(w http.ResponseWriter, r *http.Request) {
+	listingID, ok := listingIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := services.WithdrawListing(auth.ClaimsFromContext(r.Context()).UserID, listingID); err != nil {
+		log.Printf("WithdrawListing: Error withdrawing listing %d: %v", listingID, err)
+		http.Error(w, err.Error(), listingErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
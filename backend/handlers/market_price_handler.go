@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/CatsMeow492/PokemonCollection/models"
 	"github.com/CatsMeow492/PokemonCollection/services"
 	"github.com/patrickmn/go-cache"
 )
@@ -23,9 +25,28 @@ func GetMarketPriceHandler(w http.ResponseWriter, r *http.Request) {
 	edition := r.URL.Query().Get("edition")
 	grade := r.URL.Query().Get("grade")
 
-	log.Printf("Received market value request for %s %s %s %s", cardName, cardId, edition, grade)
+	condition, language, finish, err := models.NormalizeRawAttributes(r.URL.Query().Get("condition"), r.URL.Query().Get("language"), r.URL.Query().Get("finish"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Condition only distinguishes raw cards; a slab's grade already covers it
+	if strings.ToLower(grade) != "ungraded" {
+		condition = ""
+	}
+
+	log.Printf("Received market value request for %s %s %s %s %s %s %s", cardName, cardId, edition, grade, condition, language, finish)
 
-	marketValue, err := services.FetchAndStoreMarketPrice(cardName, cardId, edition, grade)
+	marketValue, err := services.FetchAndStoreMarketPrice(services.MarketPriceQuery{
+		Name:      cardName,
+		ID:        cardId,
+		Edition:   edition,
+		Grade:     grade,
+		Condition: condition,
+		Language:  language,
+		Finish:    finish,
+	})
 	if err != nil {
 		log.Printf("Error in GetMarketPriceHandler: %v", err)
 		http.Error(w, fmt.Sprintf("Error fetching market price: %v", err), http.StatusInternalServerError)
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/ratelimit"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/CatsMeow492/PokemonCollection/sso"
+	"github.com/gorilla/mux"
+)
+
+// oidcFlowCookie carries the state, nonce and PKCE verifier of a sign-in
+// from the redirect to the provider until its callback. It is scoped to the
+// OIDC routes and lasts as long as a user might take at the provider.
+const (
+	oidcFlowCookie = "oidc_flow"
+	oidcFlowTTL    = 10 * time.Minute
+)
+
+// identityProviders are the external OpenID Connect providers users can sign
+// in with.
+var identityProviders sso.Providers
+
+func InitIdentityProviders(providers sso.Providers) {
+	identityProviders = providers
+}
+
+type oidcFlow struct {
+	Provider string `json:"provider"`
+	Redirect string `json:"redirect"`
+	sso.AuthRequest
+}
+
+// ListIdentityProviders lists the providers the login page can offer.
+func ListIdentityProviders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identityProviders.List())
+}
+
+// OIDCLogin sends the browser to a provider's sign-in page. An optional
+// redirect names the app path to return to afterwards.
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, err := identityProviders.Get(mux.Vars(r)["provider"])
+	if err != nil {
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return
+	}
+
+	authRequest, err := sso.NewAuthRequest()
+	if err != nil {
+		http.Error(w, "Error starting sign-in", http.StatusInternalServerError)
+		return
+	}
+	authURL, err := provider.AuthCodeURL(r.Context(), authRequest)
+	if err != nil {
+		log.Printf("OIDCLogin: Error reaching provider %s: %v", provider.Name, err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	flow, err := json.Marshal(oidcFlow{Provider: provider.Name, Redirect: appPath(r.URL.Query().Get("redirect")), AuthRequest: authRequest})
+	if err != nil {
+		http.Error(w, "Error starting sign-in", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(flow),
+		Path:     "/api/oidc",
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   secureCookies,
+		// Lax so the cookie comes back on the provider's top-level redirect
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback completes a sign-in: it checks the callback belongs to the
+// flow this browser started, redeems the code, signs in to (or creates) the
+// linked account and returns to the app with session cookies set.
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	providerName := mux.Vars(r)["provider"]
+	query := r.URL.Query()
+	ip := ratelimit.ClientIP(r)
+
+	var flow oidcFlow
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err == nil {
+		var raw []byte
+		if raw, err = base64.RawURLEncoding.DecodeString(cookie.Value); err == nil {
+			err = json.Unmarshal(raw, &flow)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcFlowCookie, Path: "/api/oidc", MaxAge: -1, HttpOnly: true, Secure: secureCookies})
+	if err != nil || flow.Provider != providerName || flow.State == "" ||
+		subtle.ConstantTimeCompare([]byte(flow.State), []byte(query.Get("state"))) != 1 {
+		oidcFailure(w, r, "invalid_state")
+		return
+	}
+	if providerError := query.Get("error"); providerError != "" {
+		log.Printf("OIDCCallback: Provider %s returned error %s: %s", providerName, providerError, query.Get("error_description"))
+		oidcFailure(w, r, "provider_error")
+		return
+	}
+
+	provider, err := identityProviders.Get(providerName)
+	if err != nil {
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return
+	}
+	identity, err := provider.Exchange(r.Context(), flow.AuthRequest, query.Get("code"))
+	if err != nil {
+		log.Printf("OIDCCallback: Error completing sign-in with %s: %v", providerName, err)
+		oidcFailure(w, r, "invalid_callback")
+		return
+	}
+
+	login, err := services.SignInWithIdentity(*identity)
+	if err != nil {
+		log.Printf("OIDCCallback: Error signing in %s identity: %v", providerName, err)
+		switch {
+		case errors.Is(err, services.ErrIdentityEmailConflict):
+			oidcFailure(w, r, "email_in_use")
+		case errors.Is(err, services.ErrIdentityEmailRequired):
+			oidcFailure(w, r, "email_required")
+		default:
+			oidcFailure(w, r, "server_error")
+		}
+		return
+	}
+
+	if !login.Active {
+		services.RecordLoginAttempt(&login.UserID, login.Username, ip, false, services.LoginInactive)
+		oidcFailure(w, r, "account_deactivated")
+		return
+	}
+	if services.RequireEmailVerification && !login.EmailVerified {
+		services.RecordLoginAttempt(&login.UserID, login.Username, ip, false, services.LoginUnverified)
+		oidcFailure(w, r, "email_unverified")
+		return
+	}
+
+	refreshToken, err := services.StartSession(login.UserID)
+	if err != nil {
+		oidcFailure(w, r, "server_error")
+		return
+	}
+	tokenString, expirationTime, err := tokenService.Issue(login.UserID, login.Username)
+	if err != nil {
+		oidcFailure(w, r, "server_error")
+		return
+	}
+	setSessionCookies(w, tokenString, expirationTime, refreshToken)
+	services.RecordSuccessfulLogin(login.UserID, login.Username, ip)
+
+	log.Printf("Login successful for user ID: %d via %s", login.UserID, providerName)
+	http.Redirect(w, r, services.AppURL+flow.Redirect, http.StatusFound)
+}
+
+// oidcFailure returns the browser to the app's login page with an error code
+// it can show.
+func oidcFailure(w http.ResponseWriter, r *http.Request, code string) {
+	http.Redirect(w, r, services.AppURL+"/login?"+url.Values{"oidc_error": {code}}.Encode(), http.StatusFound)
+}
+
+// appPath keeps post-login redirects inside the app: only absolute paths are
+// accepted, never another host.
+func appPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.ContainsAny(path, `\`) {
+		return "/"
+	}
+	return path
+}
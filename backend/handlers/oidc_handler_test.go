@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/auth"
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/CatsMeow492/PokemonCollection/sso"
+	"github.com/CatsMeow492/PokemonCollection/sso/ssotest"
+	"github.com/gorilla/mux"
+)
+
+// oidcTest drives sign-ins through OIDCLogin and OIDCCallback against an
+// ssotest provider named "test".
+type oidcTest struct {
+	t        *testing.T
+	provider *ssotest.Server
+	router   *mux.Router
+}
+
+func newOIDCTest(t *testing.T, user ssotest.User) *oidcTest {
+	t.Helper()
+	server, err := ssotest.NewServer("pokemon-collection", "test-secret", user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+
+	providers, err := sso.NewProviders([]sso.Config{{
+		Name:         "test",
+		Issuer:       server.URL,
+		ClientID:     "pokemon-collection",
+		ClientSecret: "test-secret",
+		RedirectURL:  "http://api.test/api/oidc/test/callback",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	InitIdentityProviders(providers)
+	t.Cleanup(func() { InitIdentityProviders(nil) })
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/oidc/{provider}/login", OIDCLogin)
+	router.HandleFunc("/api/oidc/{provider}/callback", OIDCCallback)
+	return &oidcTest{t: t, provider: server, router: router}
+}
+
+// start begins a sign-in and lets the provider approve it, returning the flow
+// cookie and the callback URL the provider sent the browser back to.
+func (o *oidcTest) start() (*http.Cookie, *url.URL) {
+	o.t.Helper()
+	rec := httptest.NewRecorder()
+	o.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/oidc/test/login?redirect=/collections", nil))
+	if rec.Code != http.StatusFound {
+		o.t.Fatalf("login: status %d: %s", rec.Code, rec.Body)
+	}
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == oidcFlowCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		o.t.Fatal("login: no flow cookie set")
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(rec.Header().Get("Location"))
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || callback.Query().Get("code") == "" {
+		o.t.Fatalf("provider did not redirect back with a code: %q", resp.Header.Get("Location"))
+	}
+	return cookie, callback
+}
+
+// finish delivers the callback and returns where the browser is sent next.
+func (o *oidcTest) finish(cookie *http.Cookie, callback *url.URL) string {
+	o.t.Helper()
+	req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	o.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		o.t.Fatalf("callback: status %d: %s", rec.Code, rec.Body)
+	}
+	return rec.Header().Get("Location")
+}
+
+func oidcErrorURL(code string) string {
+	return services.AppURL + "/login?" + url.Values{"oidc_error": {code}}.Encode()
+}
+
+func TestOIDCCallbackStateMismatch(t *testing.T) {
+	o := newOIDCTest(t, ssotest.User{Subject: "ash", Email: "ash@example.com", EmailVerified: true})
+	cookie, callback := o.start()
+
+	query := callback.Query()
+	query.Set("state", "forged")
+	callback.RawQuery = query.Encode()
+
+	if got, want := o.finish(cookie, callback), oidcErrorURL("invalid_state"); got != want {
+		t.Errorf("redirected to %q, want %q", got, want)
+	}
+}
+
+func TestOIDCCallbackNonceMismatch(t *testing.T) {
+	o := newOIDCTest(t, ssotest.User{Subject: "ash", Email: "ash@example.com", EmailVerified: true})
+	cookie, callback := o.start()
+
+	// The ID token carries the nonce of this sign-in, not the one the flow
+	// cookie now expects, as with a token replayed from another sign-in
+	raw, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flow oidcFlow
+	if err := json.Unmarshal(raw, &flow); err != nil {
+		t.Fatal(err)
+	}
+	flow.Nonce = "another-nonce"
+	if raw, err = json.Marshal(flow); err != nil {
+		t.Fatal(err)
+	}
+	cookie.Value = base64.RawURLEncoding.EncodeToString(raw)
+
+	if got, want := o.finish(cookie, callback), oidcErrorURL("invalid_callback"); got != want {
+		t.Errorf("redirected to %q, want %q", got, want)
+	}
+}
+
+// useTestDB points the database at TEST_DATABASE_URL, a Postgres database
+// loaded with schema.sql, skipping the test when it isn't set.
+func useTestDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		db.Close()
+	})
+
+	tokens, err := auth.NewHMACTokenService("test", "test", time.Minute, auth.Key{ID: "test", Secret: []byte("test-secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	InitTokenService(tokens)
+}
+
+// createPasswordUser adds an account that signs in with a password, removing
+// it and anything signing in left behind when the test ends.
+func createPasswordUser(t *testing.T, email string, verified bool) int {
+	t.Helper()
+	var userID int
+	err := database.DB.QueryRow(`
+		INSERT INTO Users (username, email, password, email_verified, joined)
+		VALUES ($1, $1, 'not-a-bcrypt-hash', $2, CURRENT_TIMESTAMP)
+		RETURNING user_id
+	`, email, verified).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, table := range []string{"LoginAttempts", "RefreshTokens", "UserTokens", "Users"} {
+			if _, err := database.DB.Exec(`DELETE FROM `+table+` WHERE user_id = $1`, userID); err != nil {
+				t.Errorf("cleaning up %s: %v", table, err)
+			}
+		}
+	})
+	return userID
+}
+
+func linkedUser(t *testing.T, subject string) (int, bool) {
+	t.Helper()
+	var userID int
+	err := database.DB.QueryRow(`SELECT user_id FROM UserIdentities WHERE provider = 'test' AND subject = $1`, subject).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID, true
+}
+
+func TestOIDCCallbackLinksVerifiedEmail(t *testing.T) {
+	useTestDB(t)
+	email := fmt.Sprintf("ash-%d@example.com", time.Now().UnixNano())
+	userID := createPasswordUser(t, email, true)
+
+	o := newOIDCTest(t, ssotest.User{Subject: "sub-" + email, Email: email, EmailVerified: true})
+	cookie, callback := o.start()
+	if got, want := o.finish(cookie, callback), services.AppURL+"/collections"; got != want {
+		t.Fatalf("redirected to %q, want %q", got, want)
+	}
+
+	linked, ok := linkedUser(t, "sub-"+email)
+	if !ok || linked != userID {
+		t.Errorf("identity linked to user %d (linked: %t), want %d", linked, ok, userID)
+	}
+}
+
+func TestOIDCCallbackRefusesUnverifiedEmail(t *testing.T) {
+	useTestDB(t)
+	tests := []struct {
+		name             string
+		accountVerified  bool
+		providerVerified bool
+	}{
+		{"unverified by provider", true, false},
+		{"unverified account", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := fmt.Sprintf("misty-%d@example.com", time.Now().UnixNano())
+			createPasswordUser(t, email, tt.accountVerified)
+
+			o := newOIDCTest(t, ssotest.User{Subject: "sub-" + email, Email: email, EmailVerified: tt.providerVerified})
+			cookie, callback := o.start()
+			if got, want := o.finish(cookie, callback), oidcErrorURL("email_in_use"); got != want {
+				t.Errorf("redirected to %q, want %q", got, want)
+			}
+			if userID, ok := linkedUser(t, "sub-"+email); ok {
+				t.Errorf("identity linked to user %d", userID)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/CatsMeow492/PokemonCollection/auth"
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/gorilla/mux"
+)
+
+// Order routes act for the signed-in user, who must be the buyer or seller.
+
+// orderErrorStatus maps checkout and order service errors to HTTP status
+// codes.
+func orderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidOrder):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrOrderNotFound), errors.Is(err, services.ErrCollectionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrOrderState):
+		return http.StatusConflict
+	}
+	return listingErrorStatus(err)
+}
+
+// orderIDFromPath parses the {order_id} route variable, writing a 400
+// response and returning false when it is not a number.
+func orderIDFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["order_id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return orderID, true
+}
+
+// checkoutLines turns cart items into checkout lines, pricing shop products
+// from the catalog. Listings are priced by the checkout itself.
+func checkoutLines(items []models.CartItem) ([]models.CheckoutLine, error) {
+	lines := make([]models.CheckoutLine, 0, len(items))
+	for _, item := range items {
+		if item.ListingID != 0 {
+			lines = append(lines, models.CheckoutLine{ListingID: item.ListingID, ShippingOptionID: item.ShippingOptionID})
+			continue
+		}
+		product, err := getProductById(item.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		price, err := strconv.ParseFloat(strings.TrimPrefix(product.Price, "$"), 64)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, models.CheckoutLine{
+			ProductID: item.ProductID,
+			Name:      product.Name,
+			Image:     product.Image,
+			Quantity:  item.Quantity,
+			UnitPrice: price,
+		})
+	}
+	return lines, nil
+}
+
+// Checkout buys everything in the user's cart, taking an optional
+// collection_id to add bought cards to, and empties the cart. The cart is
+// taken for the checkout and put back if it fails.
+func Checkout(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+	claims := auth.ClaimsFromContext(r.Context())
+
+	var requestBody struct {
+		CollectionID *int `json:"collection_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	cart := takeCart(userID)
+	lines, err := checkoutLines(cart.Items)
+	if err != nil {
+		restoreCart(userID, cart)
+		log.Printf("Checkout: Error pricing cart for user ID %s: %v", userID, err)
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	orders, err := services.Checkout(r.Context(), claims.UserID, lines, requestBody.CollectionID)
+	if err != nil {
+		restoreCart(userID, cart)
+		log.Printf("Checkout: Error checking out cart for user ID %s: %v", userID, err)
+		http.Error(w, err.Error(), orderErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(orders)
+}
+
+func GetOrders(w http.ResponseWriter, r *http.Request) {
+	orders, err := services.GetOrders(auth.ClaimsFromContext(r.Context()).UserID)
+	if err != nil {
+		log.Printf("GetOrders: Error listing orders: %v", err)
+		http.Error(w, "Error fetching orders", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+func GetOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := orderIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := services.GetOrder(auth.ClaimsFromContext(r.Context()).UserID, orderID)
+	if err != nil {
+		http.Error(w, err.Error(), orderErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// UpdateOrderStatus lets the seller mark an order shipped and the buyer mark
+// it delivered.
+func UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := orderIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	order, err := services.UpdateOrderStatus(auth.ClaimsFromContext(r.Context()).UserID, orderID, requestBody.Status)
+	if err != nil {
+		log.Printf("UpdateOrderStatus: Error updating order %d: %v", orderID, err)
+		http.Error(w, err.Error(), orderErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
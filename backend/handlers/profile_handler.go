@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/gorilla/mux"
+)
+
+// Profile routes only act for the signed-in user named in the route.
+
+func profileErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidProfile):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrIncorrectPassword):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrCollectionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrUserExists):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func GetProfile(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	profile, err := services.GetProfile(userID)
+	if err != nil {
+		log.Printf("GetProfile: Error fetching profile for user ID %s: %v", userID, err)
+		http.Error(w, "Error fetching profile", profileErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// UpdateProfile changes the profile fields and preferences present in the
+// body and leaves the rest as they are. Setting preferences.default_collection
+// to "" clears it.
+func UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	var update models.ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	profile, err := services.UpdateProfile(r.Context(), userID, update)
+	if err != nil {
+		log.Printf("UpdateProfile: Error updating profile for user ID %s: %v", userID, err)
+		http.Error(w, err.Error(), profileErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	var requestBody struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.CurrentPassword == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.ChangePassword(r.Context(), userID, requestBody.CurrentPassword, requestBody.NewPassword); err != nil {
+		log.Printf("ChangePassword: Error changing password for user ID %s: %v", userID, err)
+		http.Error(w, err.Error(), profileErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
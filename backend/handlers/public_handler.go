@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/gorilla/mux"
+)
+
+// The public routes serve shared collections to anyone, signed in or not.
+// They only ever return the redacted models.PublicCollection views.
+
+func GetPublicCollection(w http.ResponseWriter, r *http.Request) {
+	collection, err := services.GetPublicCollection(mux.Vars(r)["slug"])
+	if err != nil {
+		if !errors.Is(err, services.ErrCollectionNotFound) {
+			http.Error(w, "Error fetching collection", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+// GetPublicCollections lists the public collections on a user's profile.
+func GetPublicCollections(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	collections, err := services.GetPublicCollections(username)
+	if err != nil {
+		if !errors.Is(err, services.ErrUserNotFound) {
+			log.Printf("GetPublicCollections: Error listing collections of %s: %v", username, err)
+			http.Error(w, "Error fetching collections", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collections)
+}
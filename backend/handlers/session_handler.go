@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/auth"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/gorilla/mux"
+)
+
+// AccessTokenTTL is kept short because access tokens can't be revoked; the
+// refresh token is what keeps a session going.
+const AccessTokenTTL = 15 * time.Minute
+
+const (
+	accessTokenCookie  = "token"
+	refreshTokenCookie = "refresh_token"
+)
+
+// tokenService issues and verifies access tokens.
+var tokenService auth.TokenService
+
+func InitTokenService(tokens auth.TokenService) {
+	tokenService = tokens
+}
+
+// secureCookies marks session cookies Secure. It can only be turned off for
+// local development over plain HTTP.
+var secureCookies = true
+
+func InitCookieSecurity(secure bool) {
+	secureCookies = secure
+}
+
+// setSessionCookies stores the access token for the API and the refresh
+// token only for the session endpoints under /api. Neither is readable from
+// JavaScript.
+func setSessionCookies(w http.ResponseWriter, accessToken string, accessExpires time.Time, refreshToken string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessTokenCookie,
+		Value:    accessToken,
+		Path:     "/",
+		Expires:  accessExpires,
+		HttpOnly: true,
+		Secure:   secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    refreshToken,
+		Path:     "/api",
+		Expires:  time.Now().Add(services.RefreshTokenTTL),
+		HttpOnly: true,
+		Secure:   secureCookies,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	for name, path := range map[string]string{accessTokenCookie: "/", refreshTokenCookie: "/api"} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     path,
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   secureCookies,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+// refreshTokenFromRequest reads the refresh token from its cookie, or from
+// the JSON body for clients that don't keep cookies.
+func refreshTokenFromRequest(r *http.Request) string {
+	if cookie, err := r.Cookie(refreshTokenCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	var requestBody struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(r.Body).Decode(&requestBody)
+	return requestBody.RefreshToken
+}
+
+// RefreshToken rotates the refresh token and issues a new access token.
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	refreshToken := refreshTokenFromRequest(r)
+	if refreshToken == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, newRefreshToken, err := services.RotateRefreshToken(refreshToken)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			clearSessionCookies(w)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		log.Printf("RefreshToken: Error rotating refresh token: %v", err)
+		http.Error(w, "Error refreshing token", http.StatusInternalServerError)
+		return
+	}
+
+	username, err := services.GetUsername(userID)
+	if err != nil {
+		log.Printf("RefreshToken: Error looking up user ID %d: %v", userID, err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokenString, expirationTime, err := tokenService.Issue(userID, username)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	setSessionCookies(w, tokenString, expirationTime, newRefreshToken)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"token":      tokenString,
+		"expires_at": expirationTime.UTC().Format(time.RFC3339),
+		"id":         strconv.Itoa(userID),
+		"username":   username,
+	})
+}
+
+// Logout ends the current session and clears the session cookies.
+func Logout(w http.ResponseWriter, r *http.Request) {
+	if refreshToken := refreshTokenFromRequest(r); refreshToken != "" {
+		if err := services.EndSession(refreshToken); err != nil {
+			log.Printf("Logout: Error ending session: %v", err)
+			http.Error(w, "Error logging out", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAllSessions signs a user out everywhere. Only the user themselves
+// may do it, so the route sits behind middleware.Owner.
+func RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	if err := services.RevokeAllSessions(userID); err != nil {
+		http.Error(w, "Error revoking sessions", http.StatusInternalServerError)
+		return
+	}
+
+	clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/gorilla/mux"
+)
+
+func GetSetProgress(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	setID := vars["set_id"]
+	variants, _ := strconv.ParseBool(r.URL.Query().Get("variants"))
+
+	progress, err := services.GetSetProgress(os.Getenv("POKEMON_TCG_API_KEY"), userID, setID, variants)
+	if errors.Is(err, services.ErrSetNotFound) {
+		http.Error(w, "Set not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error computing progress for set %s, user ID %s: %v", setID, userID, err)
+		http.Error(w, "Error computing set progress", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/CatsMeow492/PokemonCollection/auth"
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/gorilla/mux"
+)
+
+// Trade routes act for the signed-in user, who must be a party to the trade.
+
+// tradeErrorStatus maps trade service errors to HTTP status codes.
+func tradeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidTrade):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrTradeNotFound), errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrCollectionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrTradeState), errors.Is(err, services.ErrTradeUnavailable),
+		errors.Is(err, services.ErrTradeUnvalued):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// tradeIDFromPath parses the {trade_id} route variable, writing a 400
+// response and returning false when it is not a number.
+func tradeIDFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	tradeID, err := strconv.Atoi(mux.Vars(r)["trade_id"])
+	if err != nil {
+		http.Error(w, "Invalid trade ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return tradeID, true
+}
+
+func writeTrade(w http.ResponseWriter, status int, trade *models.Trade) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(trade)
+}
+
+func GetTrades(w http.ResponseWriter, r *http.Request) {
+	claims := auth.ClaimsFromContext(r.Context())
+
+	trades, err := services.GetTradesByUserID(claims.UserID, r.URL.Query().Get("status"))
+	if err != nil {
+		log.Printf("GetTrades: Error listing trades: %v", err)
+		http.Error(w, err.Error(), tradeErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trades)
+}
+
+func GetTrade(w http.ResponseWriter, r *http.Request) {
+	tradeID, ok := tradeIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	trade, err := services.GetTrade(auth.ClaimsFromContext(r.Context()).UserID, tradeID)
+	if err != nil {
+		http.Error(w, err.Error(), tradeErrorStatus(err))
+		return
+	}
+	writeTrade(w, http.StatusOK, trade)
+}
+
+func ProposeTrade(w http.ResponseWriter, r *http.Request) {
+	claims := auth.ClaimsFromContext(r.Context())
+
+	var offer models.TradeOffer
+	if err := json.NewDecoder(r.Body).Decode(&offer); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("ProposeTrade: User %d proposing a trade to %s", claims.UserID, offer.Recipient)
+
+	trade, err := services.ProposeTrade(claims.UserID, offer)
+	if err != nil {
+		log.Printf("ProposeTrade: Error proposing trade: %v", err)
+		http.Error(w, err.Error(), tradeErrorStatus(err))
+		return
+	}
+	writeTrade(w, http.StatusCreated, trade)
+}
+
+func CounterTrade(w http.ResponseWriter, r *http.Request) {
+	tradeID, ok := tradeIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var offer models.TradeOffer
+	if err := json.NewDecoder(r.Body).Decode(&offer); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	trade, err := services.CounterTrade(auth.ClaimsFromContext(r.Context()).UserID, tradeID, offer)
+	if err != nil {
+		log.Printf("CounterTrade: Error countering trade %d: %v", tradeID, err)
+		http.Error(w, err.Error(), tradeErrorStatus(err))
+		return
+	}
+	writeTrade(w, http.StatusOK, trade)
+}
+
+// AcceptTrade takes an optional collection_id for the copies the user
+// receives.
+func AcceptTrade(w http.ResponseWriter, r *http.Request) {
+	tradeID, ok := tradeIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		CollectionID *int `json:"collection_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	trade, err := services.AcceptTrade(auth.ClaimsFromContext(r.Context()).UserID, tradeID, requestBody.CollectionID)
+	if err != nil {
+		log.Printf("AcceptTrade: Error accepting trade %d: %v", tradeID, err)
+		http.Error(w, err.Error(), tradeErrorStatus(err))
+		return
+	}
+	writeTrade(w, http.StatusOK, trade)
+}
+
+func DeclineTrade(w http.ResponseWriter, r *http.Request) {
+	tradeID, ok := tradeIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	trade, err := services.DeclineTrade(auth.ClaimsFromContext(r.Context()).UserID, tradeID)
+	if err != nil {
+		http.Error(w, err.Error(), tradeErrorStatus(err))
+		return
+	}
+	writeTrade(w, http.StatusOK, trade)
+}
+
+func CancelTrade(w http.ResponseWriter, r *http.Request) {
+	tradeID, ok := tradeIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	trade, err := services.CancelTrade(auth.ClaimsFromContext(r.Context()).UserID, tradeID)
+	if err != nil {
+		http.Error(w, err.Error(), tradeErrorStatus(err))
+		return
+	}
+	writeTrade(w, http.StatusOK, trade)
+}
+
+// CompleteTrade exchanges the copies of an accepted trade once the parties
+// have swapped the cards.
+func CompleteTrade(w http.ResponseWriter, r *http.Request) {
+	tradeID, ok := tradeIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	trade, err := services.CompleteTrade(r.Context(), auth.ClaimsFromContext(r.Context()).UserID, tradeID)
+	if err != nil {
+		log.Printf("CompleteTrade: Error completing trade %d: %v", tradeID, err)
+		http.Error(w, err.Error(), tradeErrorStatus(err))
+		return
+	}
+	writeTrade(w, http.StatusOK, trade)
+}
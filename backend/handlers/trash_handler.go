@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/gorilla/mux"
+)
+
+// trashErrorStatus maps trash service errors to HTTP status codes.
+func trashErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrNotInTrash):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCollectionExists), errors.Is(err, services.ErrCollectionDeleted):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func GetTrashByUserID(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	trash, err := services.GetTrashByUserID(userID)
+	if err != nil {
+		log.Printf("Error fetching trash: %v", err)
+		http.Error(w, "Error fetching trash", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trash)
+}
+
+func RestoreCollection(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	collectionID, err := strconv.Atoi(vars["collection_id"])
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("RestoreCollection: Restoring collection %d for user ID: %s", collectionID, userID)
+
+	if err := services.RestoreCollection(r.Context(), userID, collectionID); err != nil {
+		log.Printf("RestoreCollection: Error restoring collection: %v", err)
+		http.Error(w, err.Error(), trashErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+func RestoreCopy(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	userItemID, err := strconv.Atoi(vars["user_item_id"])
+	if err != nil {
+		http.Error(w, "Invalid user item ID", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("RestoreCopy: Restoring copy %d for user ID: %s", userItemID, userID)
+
+	if err := services.RestoreCopy(r.Context(), userID, userItemID); err != nil {
+		log.Printf("RestoreCopy: Error restoring copy: %v", err)
+		http.Error(w, err.Error(), trashErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
@@ -1,29 +1,22 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/CatsMeow492/PokemonCollection/database"
 	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/ratelimit"
+	"github.com/CatsMeow492/PokemonCollection/services"
 
-	"github.com/dgrijalva/jwt-go"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtKey []byte
-
-func InitJWTKey(key string) {
-	jwtKey = []byte(key)
-}
-
-type Claims struct {
-	Username string `json:"username"`
-	jwt.StandardClaims
-}
-
 func Register(w http.ResponseWriter, r *http.Request) {
 	var user models.User
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
@@ -49,10 +42,12 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Insert the new user into the database
-	_, err = database.DB.Exec(`
+	var userID int
+	err = database.DB.QueryRow(`
 		INSERT INTO Users (username, first_name, last_name, email, password, profile_picture, joined)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, user.Username, user.FirstName, user.LastName, user.Email, string(hashedPassword), user.ProfilePicture, time.Now())
+		RETURNING user_id
+	`, user.Username, user.FirstName, user.LastName, user.Email, string(hashedPassword), user.ProfilePicture, time.Now()).Scan(&userID)
 
 	if err != nil {
 		log.Printf("Error inserting user into database: %v", err)
@@ -60,66 +55,120 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := services.SendVerificationEmail(userID); err != nil {
+		log.Printf("Error sending verification email: %v", err)
+	}
+
 	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "User registered successfully"})
 	log.Printf("User registered successfully: %s", user.Username)
 }
 
+// dummyPasswordHash is compared against when no account matches so unknown
+// usernames take as long to reject as wrong passwords.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// loginAccountLimiter limits login attempts per username or email on top of
+// the per-IP limit applied to the route.
+var loginAccountLimiter *ratelimit.Limiter
+
+func InitLoginLimiter(limiter *ratelimit.Limiter) {
+	loginAccountLimiter = limiter
+}
+
 func Login(w http.ResponseWriter, r *http.Request) {
 	var user models.User
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	ip := ratelimit.ClientIP(r)
+
+	if loginAccountLimiter != nil {
+		if allowed, retryAfter := loginAccountLimiter.Allow(strings.ToLower(user.Username)); !allowed {
+			services.RecordLoginAttempt(nil, user.Username, ip, false, services.LoginRateLimited)
+			ratelimit.TooManyRequests(w, retryAfter)
+			return
+		}
+	}
 
 	// Retrieve the user from the database
 	var storedUser models.User
+	var emailVerified bool
+	var lockedUntil sql.NullTime
 	err := database.DB.QueryRow(`
-		SELECT user_id, username, password, profile_picture
+		SELECT user_id, username, password, profile_picture, COALESCE(email_verified, FALSE), locked_until, COALESCE(is_active, TRUE)
 		FROM Users
 		WHERE username = $1 OR email = $1
-	`, user.Username).Scan(&storedUser.ID, &storedUser.Username, &storedUser.Password, &storedUser.ProfilePicture)
+	`, user.Username).Scan(&storedUser.ID, &storedUser.Username, &storedUser.Password, &storedUser.ProfilePicture, &emailVerified, &lockedUntil, &storedUser.IsActive)
 
 	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(user.Password))
+		services.RecordLoginAttempt(nil, user.Username, ip, false, services.LoginUnknownUser)
 		http.Error(w, "Invalid username/email or password", http.StatusUnauthorized)
 		return
 	}
 
+	userID, err := strconv.Atoi(storedUser.ID)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	// A locked account is refused before the password is checked so guesses
+	// during the lock tell nothing
+	if lockedUntil.Valid && lockedUntil.Time.After(time.Now()) {
+		services.RecordLoginAttempt(&userID, user.Username, ip, false, services.LoginLocked)
+		ratelimit.TooManyRequests(w, time.Until(lockedUntil.Time))
+		return
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(storedUser.Password), []byte(user.Password)); err != nil {
+		until, err := services.RecordFailedLogin(userID, user.Username, ip)
+		if err == nil && until != nil {
+			ratelimit.TooManyRequests(w, time.Until(*until))
+			return
+		}
 		http.Error(w, "Invalid username/email or password", http.StatusUnauthorized)
 		return
 	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		Username: storedUser.Username,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+	if !storedUser.IsActive {
+		services.RecordLoginAttempt(&userID, user.Username, ip, false, services.LoginInactive)
+		http.Error(w, "Account is deactivated", http.StatusForbidden)
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
-	if err != nil {
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+	if services.RequireEmailVerification && !emailVerified {
+		services.RecordLoginAttempt(&userID, user.Username, ip, false, services.LoginUnverified)
+		http.Error(w, "Email address not verified", http.StatusForbidden)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:    "token",
-		Value:   tokenString,
-		Expires: expirationTime,
-	})
+	refreshToken, err := services.StartSession(userID)
+	if err != nil {
+		http.Error(w, "Error starting session", http.StatusInternalServerError)
+		return
+	}
 
-	// Update last_login in the database
-	_, err = database.DB.Exec("UPDATE Users SET last_login = $1 WHERE user_id = $2", time.Now(), storedUser.ID)
+	tokenString, expirationTime, err := tokenService.Issue(userID, storedUser.Username)
 	if err != nil {
-		log.Printf("Error updating last_login: %v", err)
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
 	}
+	setSessionCookies(w, tokenString, expirationTime, refreshToken)
+
+	services.RecordSuccessfulLogin(userID, storedUser.Username, ip)
 
 	w.Header().Set("Content-Type", "application/json")
-	response := map[string]string{"token": tokenString, "username": storedUser.Username, "profile_picture": storedUser.ProfilePicture, "id": storedUser.ID}
-	log.Printf("Login response: %+v", response)
+	response := map[string]string{
+		"token":           tokenString,
+		"expires_at":      expirationTime.UTC().Format(time.RFC3339),
+		"username":        storedUser.Username,
+		"profile_picture": storedUser.ProfilePicture,
+		"id":              storedUser.ID,
+	}
+	log.Printf("Login successful for user ID: %s", storedUser.ID)
 	json.NewEncoder(w).Encode(response)
 }
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/gorilla/mux"
+)
+
+// wantErrorStatus maps want list and alert service errors to HTTP status codes.
+func wantErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidWant):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrWantNotFound), errors.Is(err, services.ErrAlertNotFound), errors.Is(err, services.ErrNotInCatalog):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func GetWantsByUserID(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	wants, err := services.GetWantsByUserID(userID)
+	if err != nil {
+		log.Printf("Error fetching want list: %v", err)
+		http.Error(w, "Error fetching want list", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(wants)
+}
+
+func AddWant(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+
+	var want models.Want
+	if err := json.NewDecoder(r.Body).Decode(&want); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("AddWant: Adding %s at or below %.2f for user ID: %s", want.ItemID, want.MaxPrice, userID)
+
+	created, err := services.AddWant(os.Getenv("POKEMON_TCG_API_KEY"), userID, want)
+	if err != nil {
+		log.Printf("AddWant: Error adding want: %v", err)
+		http.Error(w, err.Error(), wantErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func UpdateWant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	wantID, err := strconv.Atoi(vars["want_id"])
+	if err != nil {
+		http.Error(w, "Invalid want ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		MaxPrice float64 `json:"max_price"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.UpdateWantMaxPrice(userID, wantID, requestBody.MaxPrice); err != nil {
+		log.Printf("UpdateWant: Error updating want %d: %v", wantID, err)
+		http.Error(w, err.Error(), wantErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+func RemoveWant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	wantID, err := strconv.Atoi(vars["want_id"])
+	if err != nil {
+		http.Error(w, "Invalid want ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.RemoveWant(userID, wantID); err != nil {
+		log.Printf("RemoveWant: Error removing want %d: %v", wantID, err)
+		http.Error(w, err.Error(), wantErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+func GetAlertsByUserID(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+	includeDismissed, _ := strconv.ParseBool(r.URL.Query().Get("include_dismissed"))
+
+	alerts, err := services.GetAlertsByUserID(userID, includeDismissed)
+	if err != nil {
+		log.Printf("Error fetching alerts: %v", err)
+		http.Error(w, "Error fetching alerts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
+
+func DismissAlert(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+	alertID, err := strconv.Atoi(vars["alert_id"])
+	if err != nil {
+		http.Error(w, "Invalid alert ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.DismissAlert(userID, alertID); err != nil {
+		log.Printf("DismissAlert: Error dismissing alert %d: %v", alertID, err)
+		http.Error(w, err.Error(), wantErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
@@ -0,0 +1,78 @@
+package importers
+
+import (
+	"io"
+	"strings"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+func init() {
+	Register(collectrAdapter{})
+}
+
+// collectrAdapter reads Collectr's portfolio CSV export: Portfolio Name,
+// Category, Set, Product Name, Card Number, Rarity, Variance, Grade, Card
+// Condition, Average Cost Paid, Quantity, Market Price, Price Override,
+// Watchlist, Date Added and Notes.
+type collectrAdapter struct{}
+
+var collectrVariances = map[string]string{
+	"normal":           "",
+	"holofoil":         models.FinishHolo,
+	"reverse holofoil": models.FinishReverseHolo,
+	"1st edition":      models.FinishFirstEdition,
+	"unlimited":        models.FinishUnlimited,
+}
+
+func (collectrAdapter) Name() string { return "collectr" }
+
+func (collectrAdapter) Parse(r io.Reader) ([]models.ImportRow, error) {
+	table, err := newCSVTable(r, "Product Name", "Set", "Quantity")
+	if err != nil {
+		return nil, err
+	}
+
+	return table.rows(func(line int, record csvRecord) models.ImportRow {
+		row := models.ImportRow{Line: line, Number: record.get("Card Number")}
+		row.Card.Name = record.get("Product Name")
+		row.Card.Set = record.get("Set")
+		row.Card.Notes = record.get("Notes")
+		if row.Card.Name == "" || row.Card.Set == "" {
+			return invalidRow(row, "name and set are required")
+		}
+
+		// Portfolios mix singles with sealed product, which has no number
+		if category := record.get("Category"); category != "" && !strings.HasPrefix(strings.ToLower(category), "pok") {
+			return invalidRow(row, "unsupported category %q", category)
+		}
+		if row.Number == "" {
+			return invalidRow(row, "sealed products are not supported")
+		}
+
+		if strings.EqualFold(record.get("Watchlist"), "true") {
+			return invalidRow(row, "watchlist entries are not owned cards")
+		}
+
+		// Graded cards have no raw condition
+		row.Card.Grade = models.ParseImportGrade(record.get("Grade"))
+		condition := record.get("Card Condition")
+		if row.Card.Grade != "Ungraded" {
+			condition = ""
+		}
+		if err := normalizeAttributes(&row, condition, nil, "", record.get("Variance"), collectrVariances); err != nil {
+			return invalidRow(row, "%v", err)
+		}
+
+		if row.Card.Quantity, err = models.ParseImportQuantity(record.get("Quantity")); err != nil {
+			return invalidRow(row, "%v", err)
+		}
+		if row.Card.PurchasePrice, err = models.ParseImportPrice(record.get("Average Cost Paid")); err != nil {
+			return invalidRow(row, "%v", err)
+		}
+		if row.Card.AcquiredAt, err = models.ParseImportDate(record.get("Date Added")); err != nil {
+			return invalidRow(row, "%v", err)
+		}
+		return row
+	})
+}
@@ -0,0 +1,22 @@
+package importers
+
+import (
+	"testing"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+func TestCollectrParse(t *testing.T) {
+	rows := parseFixture(t, "collectr", "collectr.csv")
+	checkRows(t, rows, []wantRow{
+		{Line: 2, Name: "Charizard", Set: "Base Set", Number: "4/102", Grade: "PSA 9",
+			Language: models.DefaultLanguage, Finish: models.FinishHolo, Quantity: 1, Price: 1250, Date: "2023-04-18"},
+		{Line: 3, Name: "Umbreon VMAX", Set: "Evolving Skies", Number: "215/203", Grade: "Ungraded", Condition: models.ConditionNearMint,
+			Language: models.DefaultLanguage, Finish: models.FinishHolo, Quantity: 1, Price: 410.50, Date: "2023-08-02"},
+		{Line: 4, Name: "Pikachu", Set: "Crown Zenith", Number: "160/159", Grade: 10,
+			Language: models.DefaultLanguage, Finish: models.FinishHolo, Quantity: 2, Price: 95, Date: "2024-01-15"},
+		{Line: 5, Error: "sealed products are not supported"},
+		{Line: 6, Error: "watchlist entries are not owned cards"},
+		{Line: 7, Error: `unknown condition: "Pristine"`},
+	})
+}
@@ -0,0 +1,134 @@
+package importers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+// csvTable reads a CSV export whose first line names the columns. Columns
+// are looked up by header case-insensitively.
+type csvTable struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// newCSVTable reads the header row, skipping the "sep=," hint some exports
+// start with, and checks that every required column is present.
+func newCSVTable(r io.Reader, required ...string) (*csvTable, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == nil && len(header) > 0 && strings.HasPrefix(strings.ToLower(header[0]), "sep=") {
+		header, err = reader.Read()
+	}
+	if err == io.EOF {
+		return nil, errors.New("file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	table := &csvTable{reader: reader, columns: make(map[string]int, len(header))}
+	for i, column := range header {
+		if i == 0 {
+			column = strings.TrimPrefix(column, "\ufeff")
+		}
+		table.columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range required {
+		if !table.has(column) {
+			return nil, fmt.Errorf("missing column %q", column)
+		}
+	}
+	return table, nil
+}
+
+func (t *csvTable) has(column string) bool {
+	_, ok := t.columns[strings.ToLower(column)]
+	return ok
+}
+
+// csvRecord is one data line of a csvTable.
+type csvRecord struct {
+	table  *csvTable
+	fields []string
+}
+
+// get returns the trimmed value of the first of the named columns that the
+// file has.
+func (r csvRecord) get(columns ...string) string {
+	for _, column := range columns {
+		if i, ok := r.table.columns[strings.ToLower(column)]; ok {
+			if i < len(r.fields) {
+				return strings.TrimSpace(r.fields[i])
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// rows calls parse for every non-blank data line and collects the results.
+// Malformed lines become invalid rows.
+func (t *csvTable) rows(parse func(line int, record csvRecord) models.ImportRow) ([]models.ImportRow, error) {
+	var rows []models.ImportRow
+	for {
+		fields, err := t.reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rows = append(rows, invalidRow(models.ImportRow{Line: parseErr.Line}, parseErr.Err.Error()))
+				continue
+			}
+			return nil, err
+		}
+
+		blank := true
+		for _, field := range fields {
+			if strings.TrimSpace(field) != "" {
+				blank = false
+				break
+			}
+		}
+		if blank {
+			continue
+		}
+
+		line, _ := t.reader.FieldPos(0)
+		rows = append(rows, parse(line, csvRecord{table: t, fields: fields}))
+	}
+}
+
+func invalidRow(row models.ImportRow, format string, args ...interface{}) models.ImportRow {
+	row.Status = models.ImportInvalid
+	row.Error = fmt.Sprintf(format, args...)
+	return row
+}
+
+// normalizeAttributes maps a tracker's condition, language and printing onto
+// ours using its alias tables, then validates the result.
+func normalizeAttributes(row *models.ImportRow, condition string, conditionAliases map[string]string, language string, printing string, printingAliases map[string]string) error {
+	if alias, ok := conditionAliases[strings.ToLower(condition)]; ok {
+		condition = alias
+	}
+	if alias, ok := printingAliases[strings.ToLower(printing)]; ok {
+		printing = alias
+	}
+
+	condition, language, finish, err := models.NormalizeRawAttributes(condition, language, printing)
+	if err != nil {
+		return err
+	}
+	row.Card.Condition, row.Card.Language, row.Card.Finish = condition, language, finish
+	return nil
+}
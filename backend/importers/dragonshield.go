@@ -0,0 +1,74 @@
+package importers
+
+import (
+	"io"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+func init() {
+	Register(dragonShieldAdapter{})
+}
+
+// dragonShieldAdapter reads the Dragon Shield Card Manager CSV export, which
+// may start with a "sep=," line: Folder Name, Quantity, Trade Quantity, Card
+// Name, Set Code, Set Name, Card Number, Condition, Printing, Language, Price
+// Bought, Date Bought and market prices.
+type dragonShieldAdapter struct{}
+
+// Dragon Shield uses European grading names; these follow the usual
+// conversion to the TCGplayer scale we store.
+var dragonShieldConditions = map[string]string{
+	"mint":         models.ConditionMint,
+	"nearmint":     models.ConditionNearMint,
+	"excellent":    models.ConditionLightlyPlayed,
+	"good":         models.ConditionModeratelyPlayed,
+	"lightplayed":  models.ConditionModeratelyPlayed,
+	"played":       models.ConditionHeavilyPlayed,
+	"poor":         models.ConditionDamaged,
+	"light played": models.ConditionModeratelyPlayed,
+}
+
+var dragonShieldPrintings = map[string]string{
+	"normal":       "",
+	"foil":         models.FinishHolo,
+	"holo":         models.FinishHolo,
+	"reverse":      models.FinishReverseHolo,
+	"reverse holo": models.FinishReverseHolo,
+	"reverseholo":  models.FinishReverseHolo,
+	"firstedition": models.FinishFirstEdition,
+}
+
+func (dragonShieldAdapter) Name() string { return "dragonshield" }
+
+func (dragonShieldAdapter) Parse(r io.Reader) ([]models.ImportRow, error) {
+	table, err := newCSVTable(r, "Card Name", "Quantity")
+	if err != nil {
+		return nil, err
+	}
+
+	return table.rows(func(line int, record csvRecord) models.ImportRow {
+		row := models.ImportRow{Line: line, Number: record.get("Card Number")}
+		row.Card.Name = record.get("Card Name")
+		row.Card.Set = record.get("Set Name", "Set Code")
+		if row.Card.Name == "" || row.Card.Set == "" {
+			return invalidRow(row, "name and set are required")
+		}
+
+		if err := normalizeAttributes(&row, record.get("Condition"), dragonShieldConditions, record.get("Language"), record.get("Printing"), dragonShieldPrintings); err != nil {
+			return invalidRow(row, "%v", err)
+		}
+		row.Card.Grade = models.ParseImportGrade("")
+
+		if row.Card.Quantity, err = models.ParseImportQuantity(record.get("Quantity")); err != nil {
+			return invalidRow(row, "%v", err)
+		}
+		if row.Card.PurchasePrice, err = models.ParseImportPrice(record.get("Price Bought")); err != nil {
+			return invalidRow(row, "%v", err)
+		}
+		if row.Card.AcquiredAt, err = models.ParseImportDate(record.get("Date Bought")); err != nil {
+			return invalidRow(row, "%v", err)
+		}
+		return row
+	})
+}
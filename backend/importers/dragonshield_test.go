@@ -0,0 +1,20 @@
+package importers
+
+import (
+	"testing"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+func TestDragonShieldParse(t *testing.T) {
+	rows := parseFixture(t, "dragonshield", "dragonshield.csv")
+	checkRows(t, rows, []wantRow{
+		{Line: 3, Name: "Charizard", Set: "Base Set", Number: "4", Grade: "Ungraded", Condition: models.ConditionLightlyPlayed,
+			Language: models.DefaultLanguage, Finish: models.FinishHolo, Quantity: 1, Price: 310, Date: "2022-11-05"},
+		{Line: 4, Name: "Pikachu", Set: "Base Set", Number: "58", Grade: "Ungraded", Condition: models.ConditionNearMint,
+			Language: models.DefaultLanguage, Quantity: 4, Price: 2.50, Date: "2022-11-05"},
+		{Line: 5, Name: "Lugia V", Set: "Silver Tempest", Number: "186", Grade: "Ungraded", Condition: models.ConditionMint,
+			Language: "Japanese", Finish: models.FinishHolo, Quantity: 1, Price: 150, Date: "2023-01-12"},
+		{Line: 6, Error: `invalid date "2023/13/40"`},
+	})
+}
@@ -0,0 +1,51 @@
+// Package importers parses collection exports from other trackers into import
+// rows. Each format is an Adapter registered under the name clients pass as
+// the import format; the rows it returns are resolved against the card catalog
+// and committed by services.ImportCards like any other import.
+//
+// Sample exports for every format live in testdata.
+package importers
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+// Adapter parses one tracker's export format.
+type Adapter interface {
+	// Name is the format identifier used by the import endpoint.
+	Name() string
+	// Parse reads an export file into import rows. Lines that cannot be
+	// parsed are returned with status invalid and a line-level error.
+	Parse(r io.Reader) ([]models.ImportRow, error)
+}
+
+var adapters = map[string]Adapter{}
+
+// Register makes an adapter available under its name. Registering two
+// adapters with the same name panics.
+func Register(adapter Adapter) {
+	if _, exists := adapters[adapter.Name()]; exists {
+		panic(fmt.Sprintf("importers: adapter %q registered twice", adapter.Name()))
+	}
+	adapters[adapter.Name()] = adapter
+}
+
+// Get returns the adapter registered under name.
+func Get(name string) (Adapter, bool) {
+	adapter, ok := adapters[name]
+	return adapter, ok
+}
+
+// Formats lists the registered format names in sorted order.
+func Formats() []string {
+	names := make([]string, 0, len(adapters))
+	for name := range adapters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,94 @@
+package importers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+// wantRow is the part of a parsed row the adapter tests check. Rows expected
+// to be invalid only check Line, Status and Error.
+type wantRow struct {
+	Line      int
+	Name      string
+	Set       string
+	Number    string
+	Grade     interface{}
+	Condition string
+	Language  string
+	Finish    string
+	Quantity  int
+	Price     float64
+	Date      string
+	Error     string
+}
+
+// parseFixture runs the named adapter over a file in testdata.
+func parseFixture(t *testing.T, format string, file string) []models.ImportRow {
+	t.Helper()
+	adapter, ok := Get(format)
+	if !ok {
+		t.Fatalf("adapter %q is not registered", format)
+	}
+	f, err := os.Open(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, err := adapter.Parse(f)
+	if err != nil {
+		t.Fatalf("Parse(%s): %v", file, err)
+	}
+	return rows
+}
+
+func checkRows(t *testing.T, rows []models.ImportRow, want []wantRow) {
+	t.Helper()
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want))
+	}
+	for i, w := range want {
+		row := rows[i]
+		if row.Line != w.Line {
+			t.Errorf("row %d: line = %d, want %d", i, row.Line, w.Line)
+		}
+		if w.Error != "" {
+			if row.Status != models.ImportInvalid || row.Error != w.Error {
+				t.Errorf("line %d: got status %q error %q, want invalid with %q", w.Line, row.Status, row.Error, w.Error)
+			}
+			continue
+		}
+		if row.Status != "" || row.Error != "" {
+			t.Errorf("line %d: unexpected status %q error %q", w.Line, row.Status, row.Error)
+		}
+
+		date := ""
+		if row.Card.AcquiredAt != nil {
+			date = row.Card.AcquiredAt.Format("2006-01-02")
+		}
+		got := wantRow{
+			Line: row.Line, Name: row.Card.Name, Set: row.Card.Set, Number: row.Number, Grade: row.Card.Grade,
+			Condition: row.Card.Condition, Language: row.Card.Language, Finish: row.Card.Finish,
+			Quantity: row.Card.Quantity, Price: row.Card.PurchasePrice, Date: date,
+		}
+		if got != w {
+			t.Errorf("line %d:\n got %+v\nwant %+v", w.Line, got, w)
+		}
+	}
+}
+
+func TestFormats(t *testing.T) {
+	formats := Formats()
+	want := []string{"collectr", "dragonshield", "ptcgl", "tcgplayer"}
+	if len(formats) != len(want) {
+		t.Fatalf("Formats() = %v, want %v", formats, want)
+	}
+	for i := range want {
+		if formats[i] != want[i] {
+			t.Fatalf("Formats() = %v, want %v", formats, want)
+		}
+	}
+}
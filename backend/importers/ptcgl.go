@@ -0,0 +1,60 @@
+package importers
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+func init() {
+	Register(ptcglAdapter{})
+}
+
+// ptcglAdapter reads a Pokémon TCG Live deck list as copied from the game:
+// section headers ("Pokémon: 12") followed by lines of the form
+// "4 Pikachu ex SVI 57", where SVI is the set's PTCGO code.
+type ptcglAdapter struct{}
+
+var (
+	ptcglCardLine = regexp.MustCompile(`^\*?\s*(\d+)\s+(.+)\s+([A-Za-z0-9-]+)\s+([A-Za-z0-9]+)$`)
+	ptcglHeader   = regexp.MustCompile(`^[^\d].*:\s*\d+$`)
+)
+
+func (ptcglAdapter) Name() string { return "ptcgl" }
+
+func (ptcglAdapter) Parse(r io.Reader) ([]models.ImportRow, error) {
+	var rows []models.ImportRow
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || ptcglHeader.MatchString(text) {
+			continue
+		}
+
+		row := models.ImportRow{Line: line}
+		match := ptcglCardLine.FindStringSubmatch(text)
+		if match == nil {
+			rows = append(rows, invalidRow(row, "unrecognized deck list line %q", text))
+			continue
+		}
+
+		row.Card.Quantity, _ = strconv.Atoi(match[1])
+		if row.Card.Quantity <= 0 {
+			rows = append(rows, invalidRow(row, "invalid quantity %q", match[1]))
+			continue
+		}
+		row.Card.Name = strings.TrimSpace(match[2])
+		row.Card.Set = match[3]
+		row.Number = match[4]
+		row.Card.Grade = models.ParseImportGrade("")
+		row.Card.Language = models.DefaultLanguage
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
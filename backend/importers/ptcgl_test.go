@@ -0,0 +1,28 @@
+package importers
+
+import (
+	"testing"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+func TestPTCGLParse(t *testing.T) {
+	card := func(line int, quantity int, name string, set string, number string) wantRow {
+		return wantRow{Line: line, Name: name, Set: set, Number: number, Grade: "Ungraded",
+			Language: models.DefaultLanguage, Quantity: quantity}
+	}
+
+	rows := parseFixture(t, "ptcgl", "ptcgl.txt")
+	checkRows(t, rows, []wantRow{
+		card(2, 4, "Pikachu ex", "SVI", "57"),
+		card(3, 3, "Charizard ex", "OBF", "125"),
+		card(4, 2, "Pidgeot ex", "OBF", "164"),
+		card(5, 3, "Rotom V", "CRZ", "45"),
+		card(8, 4, "Professor's Research", "SVI", "189"),
+		card(9, 4, "Ultra Ball", "SVI", "196"),
+		card(10, 4, "Rare Candy", "SVI", "191"),
+		{Line: 11, Error: `unrecognized deck list line "This line is not a card"`},
+		card(13, 10, "Basic Lightning Energy", "SVE", "4"),
+		card(14, 8, "Basic Fire Energy", "SVE", "2"),
+	})
+}
@@ -0,0 +1,80 @@
+package importers
+
+import (
+	"io"
+	"strings"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+func init() {
+	Register(tcgplayerAdapter{})
+}
+
+// tcgplayerAdapter reads the CSV exported by TCGplayer's collection tracker:
+// Quantity, Name, Simple Name, Set, Card Number, Set Code, Printing,
+// Condition, Language, Rarity, Product ID, SKU and optionally a price paid.
+type tcgplayerAdapter struct{}
+
+var tcgplayerPrintings = map[string]string{
+	"normal":               "",
+	"holofoil":             models.FinishHolo,
+	"reverse holofoil":     models.FinishReverseHolo,
+	"1st edition":          models.FinishFirstEdition,
+	"1st edition normal":   models.FinishFirstEdition,
+	"1st edition holofoil": models.FinishFirstEdition,
+	"unlimited":            models.FinishUnlimited,
+	"unlimited holofoil":   models.FinishUnlimited,
+}
+
+func (tcgplayerAdapter) Name() string { return "tcgplayer" }
+
+func (tcgplayerAdapter) Parse(r io.Reader) ([]models.ImportRow, error) {
+	table, err := newCSVTable(r, "Quantity", "Set", "Condition")
+	if err != nil {
+		return nil, err
+	}
+
+	return table.rows(func(line int, record csvRecord) models.ImportRow {
+		row := models.ImportRow{Line: line, Number: record.get("Card Number", "Number")}
+
+		// Name carries the number and variant ("Charizard - 4/102 (Holo)");
+		// Simple Name is just the card name when the export has it
+		row.Card.Name = record.get("Simple Name")
+		if row.Card.Name == "" {
+			row.Card.Name = strings.TrimSpace(strings.SplitN(record.get("Name", "Product Name"), " - ", 2)[0])
+		}
+		// Variant tags such as "(Alternate Full Art)" are not part of the
+		// catalog name
+		if i := strings.Index(row.Card.Name, " ("); i > 0 {
+			row.Card.Name = row.Card.Name[:i]
+		}
+		row.Card.Set = record.get("Set", "Set Name")
+		if row.Card.Name == "" || row.Card.Set == "" {
+			return invalidRow(row, "name and set are required")
+		}
+
+		// Older exports fold the printing into the condition ("Near Mint Holofoil")
+		condition, printing := record.get("Condition"), record.get("Printing")
+		if printing == "" {
+			for _, suffix := range []string{"Reverse Holofoil", "Holofoil", "1st Edition", "Unlimited"} {
+				if strings.HasSuffix(condition, " "+suffix) {
+					condition, printing = strings.TrimSuffix(condition, " "+suffix), suffix
+					break
+				}
+			}
+		}
+		if err := normalizeAttributes(&row, condition, nil, record.get("Language"), printing, tcgplayerPrintings); err != nil {
+			return invalidRow(row, "%v", err)
+		}
+		row.Card.Grade = models.ParseImportGrade("")
+
+		if row.Card.Quantity, err = models.ParseImportQuantity(record.get("Quantity", "Add to Quantity")); err != nil {
+			return invalidRow(row, "%v", err)
+		}
+		if row.Card.PurchasePrice, err = models.ParseImportPrice(record.get("Purchase Price", "Price Paid")); err != nil {
+			return invalidRow(row, "%v", err)
+		}
+		return row
+	})
+}
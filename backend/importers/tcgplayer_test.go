@@ -0,0 +1,55 @@
+package importers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+func TestTCGplayerParse(t *testing.T) {
+	rows := parseFixture(t, "tcgplayer", "tcgplayer.csv")
+	checkRows(t, rows, []wantRow{
+		{Line: 2, Name: "Charizard", Set: "Base Set", Number: "4/102", Grade: "Ungraded", Condition: models.ConditionLightlyPlayed,
+			Language: models.DefaultLanguage, Finish: models.FinishHolo, Quantity: 1},
+		{Line: 3, Name: "Pikachu", Set: "Base Set", Number: "58/102", Grade: "Ungraded", Condition: models.ConditionNearMint,
+			Language: models.DefaultLanguage, Quantity: 3},
+		{Line: 4, Name: "Pikachu ex", Set: "Scarlet & Violet", Number: "057/198", Grade: "Ungraded", Condition: models.ConditionNearMint,
+			Language: models.DefaultLanguage, Quantity: 2},
+		{Line: 5, Name: "Umbreon VMAX", Set: "Evolving Skies", Number: "215/203", Grade: "Ungraded", Condition: models.ConditionNearMint,
+			Language: "Japanese", Finish: models.FinishHolo, Quantity: 1},
+		{Line: 6, Name: "Gengar", Set: "Fossil", Number: "5/62", Grade: "Ungraded", Condition: models.ConditionModeratelyPlayed,
+			Language: models.DefaultLanguage, Finish: models.FinishFirstEdition, Quantity: 1},
+		{Line: 7, Error: `invalid quantity "0"`},
+	})
+}
+
+// Older exports have no Printing column and fold it into the condition.
+func TestTCGplayerParseConditionPrinting(t *testing.T) {
+	adapter, _ := Get("tcgplayer")
+	rows, err := adapter.Parse(strings.NewReader("Quantity,Name,Set,Condition\n" +
+		"2,Blastoise - 2/102,Base Set,Near Mint Holofoil\n" +
+		"1,Eevee - 51/64,Jungle,Lightly Played Reverse Holofoil\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRows(t, rows, []wantRow{
+		{Line: 2, Name: "Blastoise", Set: "Base Set", Grade: "Ungraded", Condition: models.ConditionNearMint,
+			Language: models.DefaultLanguage, Finish: models.FinishHolo, Quantity: 2},
+		{Line: 3, Name: "Eevee", Set: "Jungle", Grade: "Ungraded", Condition: models.ConditionLightlyPlayed,
+			Language: models.DefaultLanguage, Finish: models.FinishReverseHolo, Quantity: 1},
+	})
+}
+
+func TestCSVTableMalformedLine(t *testing.T) {
+	adapter, _ := Get("tcgplayer")
+	rows, err := adapter.Parse(strings.NewReader("Quantity,Name,Set,Condition\n" +
+		"1,Bad \"name,Base Set,Near Mint\n" +
+		"1,Pikachu - 58/102,Base Set,Near Mint\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Status != models.ImportInvalid || rows[1].Card.Name != "Pikachu" {
+		t.Fatalf("got %+v, want an invalid row then Pikachu", rows)
+	}
+}
@@ -7,23 +7,25 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/CatsMeow492/PokemonCollection/auth"
 	"github.com/CatsMeow492/PokemonCollection/database"
 	"github.com/CatsMeow492/PokemonCollection/handlers"
+	"github.com/CatsMeow492/PokemonCollection/middleware"
+	"github.com/CatsMeow492/PokemonCollection/notify"
+	"github.com/CatsMeow492/PokemonCollection/ratelimit"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/CatsMeow492/PokemonCollection/sso"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 )
 
-var jwtKey []byte
-
-func InitJWTKey(key string) {
-	jwtKey = []byte(key)
-}
-
 const pokemonCacheDuration = 10 * time.Minute // or any duration you prefer
 var pokemonCacheMutex sync.Mutex
 
@@ -41,25 +43,136 @@ func main() {
 	database.InitDB()
 	defer database.CloseDB()
 
-	handlers.InitJWTKey(jwtKey)
+	// Access tokens are signed with JWT_KEY under JWT_KEY_ID. Keys rotated out
+	// go in JWT_PREVIOUS_KEYS as kid:secret pairs until their tokens expire.
+	jwtKeyID := os.Getenv("JWT_KEY_ID")
+	if jwtKeyID == "" {
+		jwtKeyID = "1"
+	}
+	previousKeys, err := auth.ParseKeys(os.Getenv("JWT_PREVIOUS_KEYS"))
+	if err != nil {
+		log.Fatalf("Invalid JWT_PREVIOUS_KEYS: %v", err)
+	}
+	jwtIssuer := os.Getenv("JWT_ISSUER")
+	if jwtIssuer == "" {
+		jwtIssuer = "pokemon-collection"
+	}
+	jwtAudience := os.Getenv("JWT_AUDIENCE")
+	if jwtAudience == "" {
+		jwtAudience = "pokemon-collection-api"
+	}
+	tokens, err := auth.NewHMACTokenService(jwtIssuer, jwtAudience, handlers.AccessTokenTTL,
+		auth.Key{ID: jwtKeyID, Secret: []byte(jwtKey)}, previousKeys...)
+	if err != nil {
+		log.Fatalf("Error creating token service: %v", err)
+	}
+	handlers.InitTokenService(tokens)
+
+	// Session cookies are Secure unless COOKIE_INSECURE is set for local
+	// development over plain HTTP
+	insecureCookies, _ := strconv.ParseBool(os.Getenv("COOKIE_INSECURE"))
+	handlers.InitCookieSecurity(!insecureCookies)
+
+	// Deleted collections and copies stay restorable for TRASH_RETENTION_DAYS
+	trashRetentionDays := 30
+	if days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil && days > 0 {
+		trashRetentionDays = days
+	}
+	services.StartTrashPurgeJob(time.Duration(trashRetentionDays)*24*time.Hour, time.Hour)
+
+	// Wanted cards are re-priced every WANT_REFRESH_HOURS so alerts fire
+	// without anyone viewing the card
+	wantRefreshHours := 6
+	if hours, err := strconv.Atoi(os.Getenv("WANT_REFRESH_HOURS")); err == nil && hours > 0 {
+		wantRefreshHours = hours
+	}
+	services.StartWantRefreshJob(time.Duration(wantRefreshHours) * time.Hour)
+
+	services.SetNotifier(notifierFromEnv())
+
+	// Reset and verification links point at APP_URL; REQUIRE_EMAIL_VERIFICATION
+	// keeps unverified users from logging in
+	if appURL := os.Getenv("APP_URL"); appURL != "" {
+		services.AppURL = strings.TrimRight(appURL, "/")
+	}
+	services.RequireEmailVerification, _ = strconv.ParseBool(os.Getenv("REQUIRE_EMAIL_VERIFICATION"))
+
+	identityProviders, err := sso.NewProviders(ssoConfigsFromEnv())
+	if err != nil {
+		log.Fatalf("Invalid OIDC provider configuration: %v", err)
+	}
+	handlers.InitIdentityProviders(identityProviders)
+
+	// Rate limits per client IP, plus per account for logins. Accounts are
+	// also locked after LOGIN_LOCKOUT_THRESHOLD consecutive failed logins.
+	rateLimits := ratelimit.NewMemoryStore()
+	loginLimiter := ratelimit.New("login", ratelimit.PerMinute(10), rateLimits)
+	registerLimiter := ratelimit.New("register", ratelimit.PerHour(10), rateLimits)
+	accountEmailLimiter := ratelimit.New("account-email", ratelimit.PerHour(10), rateLimits)
+	marketPriceLimiter := ratelimit.New("market-price", ratelimit.PerMinute(30), rateLimits)
+	publicLimiter := ratelimit.New("public", ratelimit.PerMinute(60), rateLimits)
+	handlers.InitLoginLimiter(ratelimit.New("login-account", ratelimit.Limit{Burst: 5, Refill: time.Minute}, rateLimits))
+	if threshold, err := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_THRESHOLD")); err == nil {
+		services.LockoutThreshold = threshold
+	}
 
 	r := mux.NewRouter()
+	// Every request gets an ID for the audit log, and the caller is identified
+	// when a token is sent even on routes that don't require one
+	r.Use(middleware.RequestID, middleware.OptionalAuth(tokens))
+
+	// signedIn wraps routes that act for the signed-in user
+	signedIn := func(handler http.HandlerFunc) http.Handler {
+		return middleware.Auth(tokens)(handler)
+	}
+	// owned wraps routes that act on the data of the user named in the route,
+	// who must be the one signed in
+	owned := func(handler http.HandlerFunc) http.Handler {
+		return middleware.Auth(tokens)(middleware.Owner(handler))
+	}
+
 	// Login and Register
-	r.HandleFunc("/api/login", handlers.Login).Methods("POST")
-	r.HandleFunc("/api/register", handlers.Register).Methods("POST")
+	r.Handle("/api/login", loginLimiter.Middleware(http.HandlerFunc(handlers.Login))).Methods("POST")
+	r.Handle("/api/register", registerLimiter.Middleware(http.HandlerFunc(handlers.Register))).Methods("POST")
+
+	// Sign-in with external OpenID Connect providers
+	r.HandleFunc("/api/oidc/providers", handlers.ListIdentityProviders).Methods("GET")
+	r.HandleFunc("/api/oidc/{provider}/login", handlers.OIDCLogin).Methods("GET")
+	r.Handle("/api/oidc/{provider}/callback", loginLimiter.Middleware(http.HandlerFunc(handlers.OIDCCallback))).Methods("GET")
+
+	// Sessions
+	r.HandleFunc("/api/token/refresh", handlers.RefreshToken).Methods("POST")
+	r.HandleFunc("/api/logout", handlers.Logout).Methods("POST")
+	r.Handle("/api/users/{user_id}/sessions", owned(handlers.RevokeAllSessions)).Methods("DELETE")
+
+	// Personal API keys, sent as "Authorization: Bearer pcol_..." by scripts
+	r.Handle("/api/users/{user_id}/api-keys", owned(handlers.GetAPIKeys)).Methods("GET")
+	r.Handle("/api/users/{user_id}/api-keys", owned(handlers.CreateAPIKey)).Methods("POST")
+	r.Handle("/api/users/{user_id}/api-keys/{key_id}", owned(handlers.RevokeAPIKey)).Methods("DELETE")
+
+	// Password reset and email verification
+	r.Handle("/api/password-reset", accountEmailLimiter.Middleware(http.HandlerFunc(handlers.RequestPasswordReset))).Methods("POST")
+	r.HandleFunc("/api/password-reset/confirm", handlers.ConfirmPasswordReset).Methods("POST")
+	r.HandleFunc("/api/verify-email", handlers.VerifyEmail).Methods("POST")
+	r.Handle("/api/verify-email/resend", accountEmailLimiter.Middleware(http.HandlerFunc(handlers.ResendVerificationEmail))).Methods("POST")
+
+	// Profile and preferences
+	r.Handle("/api/users/{user_id}", owned(handlers.GetProfile)).Methods("GET")
+	r.Handle("/api/users/{user_id}", owned(handlers.UpdateProfile)).Methods("PATCH")
+	r.Handle("/api/users/{user_id}/password", owned(handlers.ChangePassword)).Methods("POST")
 
 	// Card Market Data
 	r.HandleFunc("/api/card-market-data/{cardId}", handlers.GetCardMarketData).Methods("GET")
 
 	// Cards
-	r.HandleFunc("/api/cards", handlers.AddCardWithUserID).Methods("POST")
-	r.HandleFunc("/api/cards/collection", func(w http.ResponseWriter, r *http.Request) {
+	r.Handle("/api/cards", signedIn(handlers.AddCardWithUserID)).Methods("POST")
+	r.Handle("/api/cards/collection", signedIn(func(w http.ResponseWriter, r *http.Request) {
 		log.Println("Endpoint hit: POST /api/cards/collection")
 		handlers.AddCardWithUserIDAndCollection(w, r)
-	}).Methods("POST")
+	})).Methods("POST")
 
 	// Cards
-	r.HandleFunc("/api/cards", func(w http.ResponseWriter, r *http.Request) {
+	r.Handle("/api/cards", owned(func(w http.ResponseWriter, r *http.Request) {
 		userID := r.URL.Query().Get("user_id")
 		collectionName := r.URL.Query().Get("collection_name")
 		if userID != "" {
@@ -72,11 +185,13 @@ func main() {
 			// This should return a demo collection
 			println("No user ID provided")
 		}
-	}).Methods("GET")
-	r.HandleFunc("/api/cards/remove/{user_id}/{collection_name}/{card_id}", handlers.RemoveCardFromCollectionWithUserIDAndCollection).Methods("DELETE")
+	})).Methods("GET")
+	r.Handle("/api/cards/summary", owned(handlers.GetCardSummariesByUserIDAndCollectionName)).Methods("GET")
+	r.Handle("/api/cards/remove/{user_id}/{collection_name}/{card_id}", owned(handlers.RemoveCardFromCollectionWithUserIDAndCollection)).Methods("DELETE")
+	r.Handle("/api/cards/copies/{user_id}/{user_item_id}", owned(handlers.RemoveCardCopy)).Methods("DELETE")
 
 	// Items
-	r.HandleFunc("/api/items/{user_id}/{collection_name}", func(w http.ResponseWriter, r *http.Request) {
+	r.Handle("/api/items/{user_id}/{collection_name}", owned(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Endpoint hit: POST /api/items/{user_id}/{collection_name}")
 
 		// Log the body of the request
@@ -91,28 +206,79 @@ func main() {
 		r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 
 		handlers.AddItemWithUserIDAndCollection(w, r)
-	}).Methods("POST")
-	r.HandleFunc("/api/items/{user_id}/{collection_name}/{item_id}", handlers.RemoveItemFromCollectionWithUserIDAndCollection).Methods("DELETE")
-	r.HandleFunc("/api/items/quantity", handlers.UpdateItemQuantity).Methods("PUT")
+	})).Methods("POST")
+	r.Handle("/api/items/{user_id}/{collection_name}/{item_id}", owned(handlers.RemoveItemFromCollectionWithUserIDAndCollection)).Methods("DELETE")
+	r.Handle("/api/items/quantity", signedIn(handlers.UpdateItemQuantity)).Methods("PUT")
 
 	// Collections
-	r.HandleFunc("/api/collections/{user_id}", handlers.GetCollectionsByUserID).Methods("GET")
-	r.HandleFunc("/api/collections/{user_id}/{collection_name}", func(w http.ResponseWriter, r *http.Request) {
+	// Batch card routes are keyed by collection_id and registered first, so
+	// they aren't taken for a collection named "cards:batch"
+	r.Handle("/api/collections/{collection_id:[0-9]+}/cards:batch", owned(handlers.BatchAddCards)).Methods("POST")
+	r.Handle("/api/collections/{collection_id:[0-9]+}/cards:batch", owned(handlers.BatchUpdateCards)).Methods("PATCH")
+	r.Handle("/api/collections/{collection_id:[0-9]+}/cards:batch", owned(handlers.BatchRemoveCards)).Methods("DELETE")
+	r.Handle("/api/collections/{user_id}", owned(handlers.GetCollectionsByUserID)).Methods("GET")
+	r.Handle("/api/collections/{user_id}/{collection_name}", owned(func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		userID := vars["user_id"]
 		collectionName := vars["collection_name"]
 		handlers.GetCollectionByUserIDandCollectionName(w, r, userID, collectionName)
-	}).Methods("GET")
-	r.HandleFunc("/api/collections/{user_id}/{collection_name}", func(w http.ResponseWriter, r *http.Request) {
+	})).Methods("GET")
+	r.Handle("/api/collections/{user_id}/{collection_name}", owned(func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		log.Printf("DELETE request received for user_id: %s, collection_name: %s", vars["user_id"], vars["collection_name"])
 		handlers.DeleteCollectionByUserIDandCollectionName(w, r)
-	}).Methods("DELETE")
-	r.HandleFunc("/api/collections/{user_id}/{collection_name}", func(w http.ResponseWriter, r *http.Request) {
+	})).Methods("DELETE")
+	r.Handle("/api/collections/{user_id}/{collection_name}", owned(func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		log.Printf("POST request received for user_id: %s, collection_name: %s", vars["user_id"], vars["collection_name"])
 		handlers.CreateCollectionByUserIDandCollectionName(w, r)
-	}).Methods("POST")
+	})).Methods("POST")
+
+	r.Handle("/api/collections/{user_id}/{collection_name}/rename", owned(handlers.RenameCollection)).Methods("PUT")
+	r.Handle("/api/collections/{user_id}/{collection_name}/transfer", owned(handlers.TransferCopies)).Methods("POST")
+	r.Handle("/api/collections/{user_id}/{collection_name}/merge", owned(handlers.MergeCollections)).Methods("POST")
+	r.Handle("/api/collections/{user_id}/{collection_name}/import", owned(handlers.ImportCollection)).Methods("POST")
+	r.Handle("/api/collections/{user_id}/{collection_name}/export", owned(handlers.ExportCollection)).Methods("GET")
+	r.Handle("/api/collections/{user_id}/{collection_name}/visibility", owned(handlers.SetCollectionVisibility)).Methods("PUT")
+
+	// Shared collections, readable by anyone
+	r.Handle("/api/public/collections/{slug}", publicLimiter.Middleware(http.HandlerFunc(handlers.GetPublicCollection))).Methods("GET")
+	r.Handle("/api/public/users/{username}/collections", publicLimiter.Middleware(http.HandlerFunc(handlers.GetPublicCollections))).Methods("GET")
+
+	// Collections v2, keyed by collection_id
+	r.Handle("/api/v2/collections", owned(handlers.ListCollectionsV2)).Methods("GET")
+	r.Handle("/api/v2/collections", owned(handlers.CreateCollectionV2)).Methods("POST")
+	r.Handle("/api/v2/collections/{collection_id}", owned(handlers.GetCollectionV2)).Methods("GET")
+	r.Handle("/api/v2/collections/{collection_id}", owned(handlers.RenameCollectionV2)).Methods("PATCH")
+	r.Handle("/api/v2/collections/{collection_id}", owned(handlers.DeleteCollectionV2)).Methods("DELETE")
+	r.Handle("/api/v2/collections/{collection_id}/visibility", owned(handlers.SetCollectionVisibilityV2)).Methods("PUT")
+	r.Handle("/api/v2/collections/{collection_id}/cards", owned(handlers.GetCollectionCardsV2)).Methods("GET")
+	r.Handle("/api/v2/collections/{collection_id}/cards", owned(handlers.AddCardToCollectionV2)).Methods("POST")
+	r.Handle("/api/v2/collections/{collection_id}/cards:batch", owned(handlers.BatchAddCards)).Methods("POST")
+	r.Handle("/api/v2/collections/{collection_id}/cards:batch", owned(handlers.BatchUpdateCards)).Methods("PATCH")
+	r.Handle("/api/v2/collections/{collection_id}/cards:batch", owned(handlers.BatchRemoveCards)).Methods("DELETE")
+	r.Handle("/api/v2/collections/{collection_id}/cards/{card_id}", owned(handlers.RemoveCardFromCollectionV2)).Methods("DELETE")
+	r.Handle("/api/v2/collections/{collection_id}/cards/{card_id}/quantity", owned(handlers.UpdateCardQuantityV2)).Methods("PUT")
+	r.Handle("/api/v2/collections/{collection_id}/cards/{card_id}/attributes", owned(handlers.UpdateCardAttributesV2)).Methods("PUT")
+	r.Handle("/api/v2/collections/{collection_id}/transfer", owned(handlers.TransferCopiesV2)).Methods("POST")
+	r.Handle("/api/v2/collections/{collection_id}/merge", owned(handlers.MergeCollectionsV2)).Methods("POST")
+
+	// Admin, guarded by role
+	admin := func(permission auth.Permission, handler http.HandlerFunc) http.Handler {
+		return middleware.Auth(tokens)(middleware.Require(permission)(handler))
+	}
+	r.Handle("/api/admin/users", admin(auth.PermViewUsers, handlers.AdminListUsers)).Methods("GET")
+	r.Handle("/api/admin/users/{user_id}", admin(auth.PermViewUsers, handlers.AdminGetUser)).Methods("GET")
+	r.Handle("/api/admin/users/{user_id}/active", admin(auth.PermManageUsers, handlers.AdminSetUserActive)).Methods("PUT")
+	r.Handle("/api/admin/users/{user_id}/role", admin(auth.PermManageRoles, handlers.AdminSetUserRole)).Methods("PUT")
+	r.Handle("/api/admin/users/{user_id}/password-reset", admin(auth.PermManageUsers, handlers.AdminForcePasswordReset)).Methods("POST")
+	r.Handle("/api/admin/users/{user_id}/collections", admin(auth.PermViewCollections, handlers.AdminGetCollections)).Methods("GET")
+	r.Handle("/api/admin/users/{user_id}/collections/{collection_id}", admin(auth.PermViewCollections, handlers.AdminGetCollection)).Methods("GET")
+	r.Handle("/api/admin/market/refresh", admin(auth.PermRefreshMarket, handlers.AdminRefreshMarket)).Methods("POST")
+	r.Handle("/api/admin/audit", admin(auth.PermViewAudit, handlers.AdminGetAudit)).Methods("GET")
+
+	// Set completion
+	r.Handle("/api/users/{user_id}/sets/{set_id}/progress", owned(handlers.GetSetProgress)).Methods("GET")
 
 	r.HandleFunc("/api/health", handlers.HealthCheck).Methods("GET")
 	r.HandleFunc("/api/pokemon-names", handlers.GetPokemonNames).Methods("GET")
@@ -126,17 +292,61 @@ func main() {
 		products := handlers.GetAllProducts()
 		json.NewEncoder(w).Encode(products)
 	}).Methods("GET")
-	r.HandleFunc("/api/cards/quantity", func(w http.ResponseWriter, r *http.Request) {
+	r.Handle("/api/cards/quantity", signedIn(func(w http.ResponseWriter, r *http.Request) {
 		log.Println("Endpoint hit: PUT /api/cards/quantity")
 		handlers.UpdateCardQuantity(w, r)
-	}).Methods("PUT")
+	})).Methods("PUT")
 	log.Println("Registered PUT /api/cards/quantity route")
+	r.Handle("/api/cards/attributes", signedIn(handlers.UpdateCardAttributes)).Methods("PUT")
+
+	// Ledger
+	r.Handle("/api/ledger/{user_id}", owned(handlers.GetLedgerByUserID)).Methods("GET")
+	r.Handle("/api/ledger/{user_id}/items/{item_id}", owned(handlers.GetLedgerItemHistory)).Methods("GET")
+	r.Handle("/api/ledger/{user_id}/disposals", owned(handlers.RecordDisposal)).Methods("POST")
+	r.Handle("/api/ledger/{user_id}/grading", owned(handlers.RecordGrading)).Methods("POST")
+
+	// Trades between users
+	r.Handle("/api/trades", signedIn(handlers.GetTrades)).Methods("GET")
+	r.Handle("/api/trades", signedIn(handlers.ProposeTrade)).Methods("POST")
+	r.Handle("/api/trades/{trade_id}", signedIn(handlers.GetTrade)).Methods("GET")
+	r.Handle("/api/trades/{trade_id}/counter", signedIn(handlers.CounterTrade)).Methods("POST")
+	r.Handle("/api/trades/{trade_id}/accept", signedIn(handlers.AcceptTrade)).Methods("POST")
+	r.Handle("/api/trades/{trade_id}/decline", signedIn(handlers.DeclineTrade)).Methods("POST")
+	r.Handle("/api/trades/{trade_id}/cancel", signedIn(handlers.CancelTrade)).Methods("POST")
+	r.Handle("/api/trades/{trade_id}/complete", signedIn(handlers.CompleteTrade)).Methods("POST")
+
+	// Marketplace listings; browsing is public, selling acts for the signed-in user
+	r.Handle("/api/listings", publicLimiter.Middleware(http.HandlerFunc(handlers.SearchListings))).Methods("GET")
+	r.Handle("/api/listings", signedIn(handlers.CreateListing)).Methods("POST")
+	r.Handle("/api/listings/mine", signedIn(handlers.GetMyListings)).Methods("GET")
+	r.Handle("/api/listings/{listing_id}", publicLimiter.Middleware(http.HandlerFunc(handlers.GetListing))).Methods("GET")
+	r.Handle("/api/listings/{listing_id}", signedIn(handlers.UpdateListing)).Methods("PUT")
+	r.Handle("/api/listings/{listing_id}", signedIn(handlers.WithdrawListing)).Methods("DELETE")
+
+	// Orders from cart checkouts, for the buyer or seller
+	r.Handle("/api/orders", signedIn(handlers.GetOrders)).Methods("GET")
+	r.Handle("/api/orders/{order_id}", signedIn(handlers.GetOrder)).Methods("GET")
+	r.Handle("/api/orders/{order_id}/status", signedIn(handlers.UpdateOrderStatus)).Methods("PUT")
+
+	// Trash
+	r.Handle("/api/trash/{user_id}", owned(handlers.GetTrashByUserID)).Methods("GET")
+	r.Handle("/api/trash/{user_id}/collections/{collection_id}/restore", owned(handlers.RestoreCollection)).Methods("POST")
+	r.Handle("/api/trash/{user_id}/copies/{user_item_id}/restore", owned(handlers.RestoreCopy)).Methods("POST")
+
+	// Want list and price alerts
+	r.Handle("/api/wants/{user_id}", owned(handlers.GetWantsByUserID)).Methods("GET")
+	r.Handle("/api/wants/{user_id}", owned(handlers.AddWant)).Methods("POST")
+	r.Handle("/api/wants/{user_id}/{want_id}", owned(handlers.UpdateWant)).Methods("PUT")
+	r.Handle("/api/wants/{user_id}/{want_id}", owned(handlers.RemoveWant)).Methods("DELETE")
+	r.Handle("/api/alerts/{user_id}", owned(handlers.GetAlertsByUserID)).Methods("GET")
+	r.Handle("/api/alerts/{user_id}/{alert_id}/dismiss", owned(handlers.DismissAlert)).Methods("POST")
 
 	// Cart endpoints
-	r.HandleFunc("/api/cart/{user_id}", handlers.GetCart).Methods("GET")
-	r.HandleFunc("/api/cart/{user_id}/add", handlers.AddToCart).Methods("POST")
-	r.HandleFunc("/api/cart/{user_id}/update", handlers.UpdateCartItem).Methods("PUT")
-	r.HandleFunc("/api/cart/{user_id}/remove", handlers.RemoveFromCart).Methods("DELETE")
+	r.Handle("/api/cart/{user_id}", owned(handlers.GetCart)).Methods("GET")
+	r.Handle("/api/cart/{user_id}/add", owned(handlers.AddToCart)).Methods("POST")
+	r.Handle("/api/cart/{user_id}/update", owned(handlers.UpdateCartItem)).Methods("PUT")
+	r.Handle("/api/cart/{user_id}/remove", owned(handlers.RemoveFromCart)).Methods("DELETE")
+	r.Handle("/api/cart/{user_id}/checkout", owned(handlers.Checkout)).Methods("POST")
 
 	// Serve images from the "images" directory
 	r.PathPrefix("/images/").Handler(http.StripPrefix("/images/", http.FileServer(http.Dir("./images"))))
@@ -149,19 +359,82 @@ func main() {
 	// Create a new CORS handler
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000"}, // Allow requests from your frontend
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"}, // Allow all headers
 		AllowCredentials: true,
+		ExposedHeaders:   []string{"X-Request-ID"},
 	})
 
 	// Wrap your router with the CORS handler
 	handler := c.Handler(r)
 
-	r.HandleFunc("/api/item-market-price", func(w http.ResponseWriter, r *http.Request) {
+	// Market price lookups can trigger outbound scrapes
+	r.Handle("/api/item-market-price", marketPriceLimiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Println("Endpoint hit: GET /api/item-market-price")
 		handlers.GetMarketPriceHandler(w, r)
-	}).Methods("GET")
+	}))).Methods("GET")
 
 	log.Println("Server is running on :8000")
 	log.Fatal(http.ListenAndServe(":8000", handler))
 }
+
+// notifierFromEnv builds the notification channels that are configured:
+// email through SMTP_ADDR and a signed webhook through WEBHOOK_URL. Webhooks
+// never receive password reset or verification links.
+func notifierFromEnv() notify.Notifier {
+	var notifiers notify.Multi
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		notifiers = append(notifiers, &notify.SMTP{
+			Addr:     addr,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		})
+		log.Printf("Email notifications enabled via %s", addr)
+	}
+	if url := os.Getenv("WEBHOOK_URL"); url != "" {
+		webhook := &notify.Webhook{URL: url, Secret: os.Getenv("WEBHOOK_SECRET"), Log: services.WebhookDeliveryLog{}}
+		notifiers = append(notifiers, notify.Events(webhook, notify.EventPriceAlert, notify.EventOrderStatus, notify.EventTrade))
+		log.Printf("Webhook notifications enabled for %s", url)
+	}
+	if len(notifiers) == 0 {
+		return notify.Noop{}
+	}
+	return notifiers
+}
+
+// ssoConfigsFromEnv reads the OpenID Connect providers named in
+// OIDC_PROVIDERS. Each provider NAME is configured by OIDC_NAME_ISSUER,
+// OIDC_NAME_CLIENT_ID, OIDC_NAME_CLIENT_SECRET and optionally
+// OIDC_NAME_DISPLAY_NAME, OIDC_NAME_SCOPES (space separated) and
+// OIDC_NAME_REDIRECT_URL, which defaults to the callback under API_URL.
+func ssoConfigsFromEnv() []sso.Config {
+	apiURL := strings.TrimRight(os.Getenv("API_URL"), "/")
+	if apiURL == "" {
+		apiURL = "http://localhost:8000"
+	}
+
+	var configs []sso.Config
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		config := sso.Config{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if config.RedirectURL == "" {
+			config.RedirectURL = apiURL + "/api/oidc/" + name + "/callback"
+		}
+		configs = append(configs, config)
+		log.Printf("Sign-in with %s enabled via %s", name, config.Issuer)
+	}
+	return configs
+}
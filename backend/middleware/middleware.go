@@ -1,41 +1,159 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
-	"github.com/CatsMeow492/PokemonCollection/handlers"
-
-	"github.com/dgrijalva/jwt-go"
+	"github.com/CatsMeow492/PokemonCollection/audit"
+	"github.com/CatsMeow492/PokemonCollection/auth"
+	"github.com/CatsMeow492/PokemonCollection/services"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
-func Auth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("token")
-		if err != nil {
-			if err == http.ErrNoCookie {
+// Auth requires a valid access token or API key, from an "Authorization:
+// Bearer" header or the token cookie, and passes its claims on in the
+// request context. Read-only API keys are refused on requests that change
+// anything.
+func Auth(tokens auth.TokenService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := authenticate(tokens, r)
+			if err != nil {
+				if !errors.Is(err, auth.ErrInvalidToken) {
+					http.Error(w, "Error checking credentials", http.StatusInternalServerError)
+					return
+				}
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
-			http.Error(w, "Bad request", http.StatusBadRequest)
-			return
-		}
+			if !claims.ScopeAllows(r.Method) {
+				http.Error(w, "Forbidden: read-only API key", http.StatusForbidden)
+				return
+			}
 
-		tokenStr := cookie.Value
-		claims := &handlers.Claims{}
+			next.ServeHTTP(w, r.WithContext(auth.ContextWithClaims(r.Context(), claims)))
+		})
+	}
+}
 
-		tkn, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return handlers.jwtKey, nil
+// OptionalAuth passes on the claims of a valid access token or API key when
+// the request has one, so anonymous routes still know who is calling.
+// Missing or invalid credentials are ignored, but a valid read-only API key
+// can't be used to change anything.
+func OptionalAuth(tokens auth.TokenService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if claims, err := authenticate(tokens, r); err == nil {
+				if !claims.ScopeAllows(r.Method) {
+					http.Error(w, "Forbidden: read-only API key", http.StatusForbidden)
+					return
+				}
+				r = r.WithContext(auth.ContextWithClaims(r.Context(), claims))
+			}
+			next.ServeHTTP(w, r)
 		})
-		if err != nil {
-			if err == jwt.ErrSignatureInvalid {
+	}
+}
+
+// authenticate checks the request's credentials: API keys are recognised by
+// their prefix, anything else must be an access token.
+func authenticate(tokens auth.TokenService, r *http.Request) (*auth.Claims, error) {
+	tokenStr := accessToken(r)
+	if tokenStr == "" {
+		return nil, auth.ErrInvalidToken
+	}
+	if strings.HasPrefix(tokenStr, auth.APIKeyPrefix) {
+		return services.AuthenticateAPIKey(tokenStr)
+	}
+	return tokens.Parse(tokenStr)
+}
+
+func accessToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	if cookie, err := r.Cookie("token"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// RequestID tags each request with an ID, taken from a well-formed
+// X-Request-ID header or generated, echoes it in the response and stores it
+// in the request context for the audit log.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		next.ServeHTTP(w, r.WithContext(audit.WithRequestID(r.Context(), requestID)))
+	})
+}
+
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > 64 {
+		return false
+	}
+	for _, c := range requestID {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// Require only lets through users whose role grants permission. It goes
+// inside Auth. The role is read fresh from the database rather than trusted
+// from the token so revoked roles and deactivated accounts stop working at
+// once.
+func Require(permission auth.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := auth.ClaimsFromContext(r.Context())
+			if claims == nil {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
-			http.Error(w, "Bad request", http.StatusBadRequest)
+
+			role, active, err := services.GetUserRole(claims.UserID)
+			if err != nil && !errors.Is(err, services.ErrUserNotFound) {
+				log.Printf("Error looking up role for user %d: %v", claims.UserID, err)
+				http.Error(w, "Error checking permissions", http.StatusInternalServerError)
+				return
+			}
+			if err != nil || !active || !auth.Can(role, permission) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Owner only lets users at their own data: the user_id route variable, or
+// the user_id query parameter on routes without one, must be the signed-in
+// user. It goes inside Auth.
+func Owner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := auth.ClaimsFromContext(r.Context())
+		if claims == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		if !tkn.Valid {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+
+		userID, ok := mux.Vars(r)["user_id"]
+		if !ok {
+			userID = r.URL.Query().Get("user_id")
+		}
+		if userID != strconv.Itoa(claims.UserID) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// AdminUser is a user as support staff see it, with account state that the
+// user's own profile doesn't show.
+type AdminUser struct {
+	ID            int        `json:"id"`
+	Username      string     `json:"username"`
+	Email         string     `json:"email"`
+	FirstName     string     `json:"first_name"`
+	LastName      string     `json:"last_name"`
+	Role          string     `json:"role"`
+	IsActive      bool       `json:"is_active"`
+	EmailVerified bool       `json:"email_verified"`
+	Joined        time.Time  `json:"joined"`
+	LastLogin     *time.Time `json:"last_login"`
+	FailedLogins  int        `json:"failed_logins"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+// UserSearch filters the admin user list. Query matches username, email or
+// name; Role and Active are ignored when empty or nil.
+type UserSearch struct {
+	Query  string
+	Role   string
+	Active *bool
+	Limit  int
+	Offset int
+}
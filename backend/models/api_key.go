@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// APIKey is a personal API key as its owner sees it. The key itself is only
+// shown once, when it is created; Prefix identifies it afterwards.
+type APIKey struct {
+	KeyID      int        `json:"key_id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// NewAPIKey is a just-created API key, including the key itself.
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
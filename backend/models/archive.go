@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ArchiveVersion is the current version of the collection archive format.
+// Importers accept any version up to and including it.
+const ArchiveVersion = 1
+
+// CollectionArchive is a portable backup of one collection: every copy with
+// its grade, condition and image, plus the ledger history of those copies.
+// UserItemID and EntryID values are only meaningful within the archive.
+type CollectionArchive struct {
+	Version        int           `json:"version"`
+	ExportedAt     time.Time     `json:"exported_at"`
+	CollectionName string        `json:"collection_name"`
+	Cards          []Card        `json:"cards"`
+	Items          []Item        `json:"items"`
+	Ledger         []LedgerEntry `json:"ledger"`
+}
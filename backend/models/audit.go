@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry is one recorded data change. Before and After are the target's
+// state around the change, null when it didn't exist on that side.
+type AuditEntry struct {
+	AuditID      int64           `json:"audit_id"`
+	ActorID      *int            `json:"actor_id"`
+	UserID       *int            `json:"user_id"`
+	Action       string          `json:"action"`
+	TargetType   string          `json:"target_type"`
+	TargetID     string          `json:"target_id"`
+	CollectionID *int            `json:"collection_id"`
+	Before       json.RawMessage `json:"before"`
+	After        json.RawMessage `json:"after"`
+	RequestID    string          `json:"request_id"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// AuditSearch filters the audit log. Zero values are ignored.
+type AuditSearch struct {
+	UserID       int
+	ActorID      int
+	Action       string
+	TargetType   string
+	TargetID     string
+	CollectionID int
+	RequestID    string
+	Since        *time.Time
+	Until        *time.Time
+	Limit        int
+	Offset       int
+}
@@ -0,0 +1,28 @@
+package models
+
+// CardUpdate changes the quantity, grade or purchase price of one copy in a
+// batch. Nil fields are left as they are.
+type CardUpdate struct {
+	CardID        string      `json:"card_id"`
+	UserItemID    int         `json:"user_item_id"`
+	Quantity      *int        `json:"quantity,omitempty"`
+	Grade         interface{} `json:"grade,omitempty"`
+	PurchasePrice *float64    `json:"purchase_price,omitempty"`
+}
+
+// CardRef names the copies a batch removal applies to: one copy when
+// UserItemID is set, otherwise every copy of CardID.
+type CardRef struct {
+	CardID     string `json:"card_id"`
+	UserItemID int    `json:"user_item_id"`
+}
+
+// BatchResult reports the outcome of one row of a batch request. Index is the
+// row's position in the request.
+type BatchResult struct {
+	Index      int    `json:"index"`
+	Success    bool   `json:"success"`
+	UserItemID int    `json:"user_item_id,omitempty"`
+	Card       *Card  `json:"card,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
@@ -1,11 +1,15 @@
 package models
 
+// CartItem is a shop product or, when ListingID is set, a marketplace
+// listing with the chosen shipping option.
 type CartItem struct {
-	ProductID int    `json:"ProductID"`
-	Quantity  int    `json:"Quantity"`
-	Name      string `json:"Name"`
-	Price     string `json:"Price"`
-	Image     string `json:"Image"`
+	ProductID        int    `json:"ProductID"`
+	ListingID        int    `json:"ListingID,omitempty"`
+	ShippingOptionID int    `json:"ShippingOptionID,omitempty"`
+	Quantity         int    `json:"Quantity"`
+	Name             string `json:"Name"`
+	Price            string `json:"Price"`
+	Image            string `json:"Image"`
 }
 
 type Cart struct {
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Conditions a raw (ungraded) card can be recorded in, best to worst.
+const (
+	ConditionMint             = "Mint"
+	ConditionNearMint         = "Near Mint"
+	ConditionLightlyPlayed    = "Lightly Played"
+	ConditionModeratelyPlayed = "Moderately Played"
+	ConditionHeavilyPlayed    = "Heavily Played"
+	ConditionDamaged          = "Damaged"
+)
+
+// Finishes and print variants a card can be recorded as.
+const (
+	FinishHolo         = "Holo"
+	FinishReverseHolo  = "Reverse Holo"
+	FinishFirstEdition = "1st Edition"
+	FinishShadowless   = "Shadowless"
+	FinishUnlimited    = "Unlimited"
+)
+
+const DefaultLanguage = "English"
+
+var Conditions = []string{
+	ConditionMint,
+	ConditionNearMint,
+	ConditionLightlyPlayed,
+	ConditionModeratelyPlayed,
+	ConditionHeavilyPlayed,
+	ConditionDamaged,
+}
+
+var Finishes = []string{
+	FinishHolo,
+	FinishReverseHolo,
+	FinishFirstEdition,
+	FinishShadowless,
+	FinishUnlimited,
+}
+
+var Languages = []string{
+	"English",
+	"Japanese",
+	"Korean",
+	"Chinese",
+	"French",
+	"German",
+	"Italian",
+	"Spanish",
+	"Portuguese",
+}
+
+// NormalizeCondition matches a condition case-insensitively, also accepting the
+// usual abbreviations (NM, LP, ...). It returns "" and false for unknown values.
+func NormalizeCondition(condition string) (string, bool) {
+	switch strings.ToUpper(strings.TrimSpace(condition)) {
+	case "M", "MT":
+		return ConditionMint, true
+	case "NM":
+		return ConditionNearMint, true
+	case "LP":
+		return ConditionLightlyPlayed, true
+	case "MP":
+		return ConditionModeratelyPlayed, true
+	case "HP":
+		return ConditionHeavilyPlayed, true
+	case "DMG":
+		return ConditionDamaged, true
+	}
+	return matchOption(Conditions, condition)
+}
+
+func NormalizeFinish(finish string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(finish)) {
+	case "reverse", "reverse holofoil":
+		return FinishReverseHolo, true
+	case "holofoil":
+		return FinishHolo, true
+	case "1st", "first edition":
+		return FinishFirstEdition, true
+	}
+	return matchOption(Finishes, finish)
+}
+
+func NormalizeLanguage(language string) (string, bool) {
+	return matchOption(Languages, language)
+}
+
+// NormalizeRawAttributes validates the condition, language and finish of an
+// owned copy. Condition and finish may be empty (graded slabs carry a grade
+// instead); an empty language defaults to DefaultLanguage.
+func NormalizeRawAttributes(condition, language, finish string) (string, string, string, error) {
+	normalizedCondition, normalizedLanguage, normalizedFinish := "", DefaultLanguage, ""
+	var ok bool
+	if strings.TrimSpace(condition) != "" {
+		if normalizedCondition, ok = NormalizeCondition(condition); !ok {
+			return "", "", "", fmt.Errorf("unknown condition: %q", condition)
+		}
+	}
+	if strings.TrimSpace(language) != "" {
+		if normalizedLanguage, ok = NormalizeLanguage(language); !ok {
+			return "", "", "", fmt.Errorf("unknown language: %q", language)
+		}
+	}
+	if strings.TrimSpace(finish) != "" {
+		if normalizedFinish, ok = NormalizeFinish(finish); !ok {
+			return "", "", "", fmt.Errorf("unknown finish: %q", finish)
+		}
+	}
+	return normalizedCondition, normalizedLanguage, normalizedFinish, nil
+}
+
+// ConditionAbbreviation returns the short form sellers use for a condition,
+// such as "NM", so market prices can match it in sold listing titles.
+func ConditionAbbreviation(condition string) string {
+	switch condition {
+	case ConditionMint:
+		return "M"
+	case ConditionNearMint:
+		return "NM"
+	case ConditionLightlyPlayed:
+		return "LP"
+	case ConditionModeratelyPlayed:
+		return "MP"
+	case ConditionHeavilyPlayed:
+		return "HP"
+	case ConditionDamaged:
+		return "DMG"
+	}
+	return ""
+}
+
+func matchOption(options []string, value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	for _, option := range options {
+		if strings.EqualFold(option, value) {
+			return option, true
+		}
+	}
+	return "", false
+}
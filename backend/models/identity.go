@@ -0,0 +1,13 @@
+package models
+
+// IdentityLogin is the account an external identity signed in to. Created is
+// set when the account was made for the identity and Linked when the
+// identity was attached to an existing account by email.
+type IdentityLogin struct {
+	UserID        int
+	Username      string
+	Active        bool
+	EmailVerified bool
+	Created       bool
+	Linked        bool
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Import row statuses reported by a CSV import preview.
+const (
+	ImportMatched   = "matched"
+	ImportAmbiguous = "ambiguous"
+	ImportNotFound  = "not_found"
+	ImportInvalid   = "invalid"
+	ImportImported  = "imported"
+	ImportFailed    = "failed"
+)
+
+// Fields a CSV import can map columns onto.
+const (
+	ImportFieldName          = "name"
+	ImportFieldSet           = "set"
+	ImportFieldNumber        = "number"
+	ImportFieldGrade         = "grade"
+	ImportFieldCondition     = "condition"
+	ImportFieldPurchasePrice = "purchase_price"
+	ImportFieldQuantity      = "quantity"
+	ImportFieldDate          = "date"
+	ImportFieldLanguage      = "language"
+	ImportFieldFinish        = "finish"
+	ImportFieldNotes         = "notes"
+)
+
+var ImportFields = []string{
+	ImportFieldName, ImportFieldSet, ImportFieldNumber, ImportFieldGrade,
+	ImportFieldCondition, ImportFieldPurchasePrice, ImportFieldQuantity, ImportFieldDate,
+	ImportFieldLanguage, ImportFieldFinish, ImportFieldNotes,
+}
+
+// ImportMapping maps import fields to the CSV column headers holding them.
+type ImportMapping map[string]string
+
+// ImportRow is one data line of an import file and how it resolved against
+// the card catalog. Line is the 1-based line number in the file.
+type ImportRow struct {
+	Line       int    `json:"line"`
+	Number     string `json:"number,omitempty"`
+	Card       Card   `json:"card"`
+	Status     string `json:"status"`
+	Candidates []Card `json:"candidates,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ImportReport summarizes a preview or committed import.
+type ImportReport struct {
+	DryRun    bool        `json:"dry_run"`
+	Rows      []ImportRow `json:"rows"`
+	Matched   int         `json:"matched"`
+	Ambiguous int         `json:"ambiguous"`
+	NotFound  int         `json:"not_found"`
+	Invalid   int         `json:"invalid"`
+	Imported  int         `json:"imported"`
+	Failed    int         `json:"failed"`
+}
+
+// importDateLayouts are the date formats accepted for acquisition dates.
+var importDateLayouts = []string{"2006-01-02", "01/02/2006", "1/2/2006", "2006-01-02 15:04:05", time.RFC3339}
+
+// ParseImportGrade reads a grade as the add-card form stores it: ungraded
+// cards as "Ungraded", bare numbers as numbers and anything else (e.g.
+// "PSA 10") as written.
+func ParseImportGrade(value string) interface{} {
+	if value == "" || strings.EqualFold(value, "ungraded") || strings.EqualFold(value, "raw") {
+		return "Ungraded"
+	}
+	if grade, err := strconv.Atoi(value); err == nil {
+		return grade
+	}
+	return value
+}
+
+// ParseImportQuantity reads a positive whole quantity, defaulting blank to 1.
+func ParseImportQuantity(value string) (int, error) {
+	if value == "" {
+		return 1, nil
+	}
+	quantity, err := strconv.Atoi(value)
+	if err != nil || quantity <= 0 {
+		return 0, fmt.Errorf("invalid quantity %q", value)
+	}
+	return quantity, nil
+}
+
+// ParseImportPrice reads a price, ignoring currency symbols and thousands
+// separators. Blank is zero.
+func ParseImportPrice(value string) (float64, error) {
+	cleaned := strings.NewReplacer("$", "", "€", "", "£", "", ",", "").Replace(value)
+	if cleaned == "" {
+		return 0, nil
+	}
+	price, err := strconv.ParseFloat(cleaned, 64)
+	if err != nil || price < 0 {
+		return 0, fmt.Errorf("invalid price %q", value)
+	}
+	return price, nil
+}
+
+// ParseImportDate reads an acquisition date. Blank returns nil.
+func ParseImportDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid date %q", value)
+}
@@ -0,0 +1,89 @@
+package models
+
+import "testing"
+
+func TestParseImportGrade(t *testing.T) {
+	tests := []struct {
+		value string
+		want  interface{}
+	}{
+		{"", "Ungraded"},
+		{"raw", "Ungraded"},
+		{"UNGRADED", "Ungraded"},
+		{"9", 9},
+		{"PSA 10", "PSA 10"},
+	}
+	for _, tt := range tests {
+		if got := ParseImportGrade(tt.value); got != tt.want {
+			t.Errorf("ParseImportGrade(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseImportPrice(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"$1,250.00", 1250, false},
+		{"€3.50", 3.5, false},
+		{"-1", 0, true},
+		{"free", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseImportPrice(tt.value)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseImportPrice(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseImportQuantity(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", 1, false},
+		{"3", 3, false},
+		{"0", 0, true},
+		{"two", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseImportQuantity(tt.value)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseImportQuantity(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseImportDate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"2024-01-15", "2024-01-15", false},
+		{"01/15/2024", "2024-01-15", false},
+		{"1/5/2024", "2024-01-05", false},
+		{"2024-01-15 10:30:00", "2024-01-15", false},
+		{"2023/13/40", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseImportDate(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseImportDate(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		formatted := ""
+		if got != nil {
+			formatted = got.Format("2006-01-02")
+		}
+		if formatted != tt.want {
+			t.Errorf("ParseImportDate(%q) = %q, want %q", tt.value, formatted, tt.want)
+		}
+	}
+}
@@ -1,6 +1,12 @@
 package models
 
+import "time"
+
+// Item is one owned copy (or lot of identical copies) of a catalog item. Each
+// copy keeps its own UserItemID, so owning the same card twice yields two Items
+// with the same ID.
 type Item struct {
+	UserItemID    int         `json:"user_item_id"`
 	ID            string      `json:"id"`
 	Name          string      `json:"name"`
 	Edition       string      `json:"edition"`
@@ -10,6 +16,23 @@ type Item struct {
 	PurchasePrice float64     `json:"purchase_price"`
 	Quantity      int         `json:"quantity"`
 	Type          string      `json:"type"`
+	Condition     string      `json:"condition"`
+	Language      string      `json:"language"`
+	Finish        string      `json:"finish"`
+	AcquiredAt    *time.Time  `json:"acquired_at,omitempty"`
+	Notes         string      `json:"notes"`
 }
 
 type Card Item
+
+// CardSummary aggregates every copy of one catalog card held in a collection.
+type CardSummary struct {
+	ID            string  `json:"id"`
+	Name          string  `json:"name"`
+	Edition       string  `json:"edition"`
+	Set           string  `json:"set"`
+	Image         string  `json:"image"`
+	TotalQuantity int     `json:"total_quantity"`
+	TotalCost     float64 `json:"total_cost"`
+	Copies        []Card  `json:"copies"`
+}
@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// Ledger entry types. Acquisitions open cost lots; disposals consume them.
+const (
+	LedgerBuy      = "buy"
+	LedgerSell     = "sell"
+	LedgerTradeIn  = "trade_in"
+	LedgerTradeOut = "trade_out"
+	LedgerGiftIn   = "gift_in"
+	LedgerGiftOut  = "gift_out"
+	LedgerGrading  = "grading"
+)
+
+// LedgerRemoval closes the open lots of a copy moved to the trash, so later
+// disposals don't draw cost from cards that are gone. It is deleted again if
+// the copy is restored, and can't be recorded directly.
+const LedgerRemoval = "removal"
+
+// Cost basis methods for disposals.
+const (
+	CostBasisFIFO     = "fifo"
+	CostBasisSpecific = "specific"
+)
+
+// LedgerEntry records one acquisition, disposal or grading submission of an
+// owned copy. Price is per unit; Fees and Shipping are totals for the entry.
+type LedgerEntry struct {
+	EntryID      int             `json:"entry_id"`
+	UserItemID   *int            `json:"user_item_id,omitempty"`
+	ItemID       string          `json:"item_id"`
+	EntryType    string          `json:"entry_type"`
+	Quantity     int             `json:"quantity"`
+	Price        float64         `json:"price"`
+	Fees         float64         `json:"fees"`
+	Shipping     float64         `json:"shipping"`
+	Counterparty string          `json:"counterparty"`
+	Notes        string          `json:"notes"`
+	CostBasis    *float64        `json:"cost_basis,omitempty"`
+	RealizedGain *float64        `json:"realized_gain,omitempty"`
+	OccurredAt   time.Time       `json:"occurred_at"`
+	Allocations  []LotAllocation `json:"allocations,omitempty"`
+}
+
+// LotAllocation is the part of an acquisition lot consumed by a disposal.
+type LotAllocation struct {
+	LotEntryID int     `json:"lot_entry_id"`
+	Quantity   int     `json:"quantity"`
+	Cost       float64 `json:"cost"`
+}
+
+type Ledger struct {
+	Entries      []LedgerEntry `json:"entries"`
+	RealizedGain float64       `json:"realized_gain"`
+}
+
+func IsAcquisition(entryType string) bool {
+	return entryType == LedgerBuy || entryType == LedgerTradeIn || entryType == LedgerGiftIn
+}
+
+func IsDisposal(entryType string) bool {
+	return entryType == LedgerSell || entryType == LedgerTradeOut || entryType == LedgerGiftOut
+}
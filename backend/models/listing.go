@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+// Listing states. Active listings are for sale while their copy is still
+// held; Available says whether it is.
+const (
+	ListingActive    = "active"
+	ListingSold      = "sold"
+	ListingWithdrawn = "withdrawn"
+)
+
+// Listing is an owned copy (or units of one) offered for sale on the
+// marketplace. Price is the asking price for all Quantity units. The card's
+// attributes are those of the copy when it was listed.
+type Listing struct {
+	ListingID       int              `json:"listing_id"`
+	SellerID        int              `json:"seller_id"`
+	Seller          string           `json:"seller"`
+	UserItemID      int              `json:"user_item_id"`
+	ItemID          string           `json:"item_id"`
+	Name            string           `json:"name"`
+	Edition         string           `json:"edition"`
+	Set             string           `json:"set"`
+	Image           string           `json:"image"`
+	Grade           interface{}      `json:"grade"`
+	Condition       string           `json:"condition"`
+	Language        string           `json:"language"`
+	Finish          string           `json:"finish"`
+	Quantity        int              `json:"quantity"`
+	Price           float64          `json:"price"`
+	Description     string           `json:"description"`
+	Status          string           `json:"status"`
+	Available       bool             `json:"available"`
+	Photos          []string         `json:"photos"`
+	ShippingOptions []ShippingOption `json:"shipping_options"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+	SoldAt          *time.Time       `json:"sold_at,omitempty"`
+}
+
+type ShippingOption struct {
+	OptionID int     `json:"option_id"`
+	Name     string  `json:"name"`
+	Price    float64 `json:"price"`
+}
+
+// ListingRequest creates or replaces a listing. Photos are image URLs.
+type ListingRequest struct {
+	UserItemID      int              `json:"user_item_id"`
+	Quantity        int              `json:"quantity"`
+	Price           float64          `json:"price"`
+	Description     string           `json:"description"`
+	Photos          []string         `json:"photos"`
+	ShippingOptions []ShippingOption `json:"shipping_options"`
+}
+
+// ListingSearch filters the marketplace. Query matches card names; empty
+// fields match everything.
+type ListingSearch struct {
+	Query     string
+	ItemID    string
+	Set       string
+	Grade     string
+	Condition string
+	Seller    string
+	MinPrice  float64
+	MaxPrice  float64
+	Sort      string
+	Limit     int
+	Offset    int
+}
+
+// Sort orders for ListingSearch.
+const (
+	ListingSortNewest    = "newest"
+	ListingSortPriceAsc  = "price_asc"
+	ListingSortPriceDesc = "price_desc"
+)
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Order states. Sellers mark orders shipped and buyers mark them delivered.
+const (
+	OrderPlaced    = "placed"
+	OrderShipped   = "shipped"
+	OrderDelivered = "delivered"
+)
+
+// Order is one checkout's purchases from one seller, or from the shop when
+// SellerID is nil.
+type Order struct {
+	OrderID   int         `json:"order_id"`
+	BuyerID   int         `json:"buyer_id"`
+	Buyer     string      `json:"buyer"`
+	SellerID  *int        `json:"seller_id"`
+	Seller    string      `json:"seller"`
+	Status    string      `json:"status"`
+	Items     []OrderItem `json:"items"`
+	Subtotal  float64     `json:"subtotal"`
+	Shipping  float64     `json:"shipping"`
+	Total     float64     `json:"total"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// OrderItem is a shop product or marketplace listing in an order. Price is
+// for all Quantity units. UserItemID is the buyer's copy of a listed card
+// when it was added to one of their collections.
+type OrderItem struct {
+	ListingID      *int    `json:"listing_id,omitempty"`
+	ProductID      *int    `json:"product_id,omitempty"`
+	Name           string  `json:"name"`
+	Image          string  `json:"image"`
+	Quantity       int     `json:"quantity"`
+	Price          float64 `json:"price"`
+	ShippingOption string  `json:"shipping_option"`
+	ShippingPrice  float64 `json:"shipping_price"`
+	UserItemID     *int    `json:"user_item_id,omitempty"`
+}
+
+// CheckoutLine is one cart line being bought: a listing, with the chosen
+// shipping option, or a shop product priced from the catalog.
+type CheckoutLine struct {
+	ListingID        int
+	ShippingOptionID int
+	ProductID        int
+	Name             string
+	Image            string
+	Quantity         int
+	UnitPrice        float64
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Price sources a user can prefer for valuations.
+const (
+	PriceSourceEbay      = "ebay"
+	PriceSourceTCGplayer = "tcgplayer"
+)
+
+// DefaultCurrency is used until a user picks another.
+const DefaultCurrency = "USD"
+
+// Currencies lists the currency codes a user can choose to see prices in.
+var Currencies = []string{"USD", "EUR", "GBP", "CAD", "AUD", "JPY"}
+
+// Profile is the part of a user they can see and edit. Unlike User it never
+// carries the password hash.
+type Profile struct {
+	ID             string          `json:"id"`
+	Username       string          `json:"username"`
+	FirstName      string          `json:"first_name"`
+	LastName       string          `json:"last_name"`
+	Email          string          `json:"email"`
+	ProfilePicture string          `json:"profile_picture"`
+	Joined         time.Time       `json:"joined"`
+	LastLogin      *time.Time      `json:"last_login"`
+	IsSubscribed   bool            `json:"is_subscribed"`
+	Preferences    UserPreferences `json:"preferences"`
+}
+
+// UserPreferences are a user's settings. DefaultCollection is a collection
+// name, empty when none is set.
+type UserPreferences struct {
+	DefaultCurrency   string `json:"default_currency"`
+	DefaultCollection string `json:"default_collection"`
+	PriceSource       string `json:"price_source"`
+	PublicProfile     bool   `json:"public_profile"`
+}
+
+// ProfileUpdate is a partial update of a profile; nil fields are left as
+// they are.
+type ProfileUpdate struct {
+	Username       *string            `json:"username"`
+	FirstName      *string            `json:"first_name"`
+	LastName       *string            `json:"last_name"`
+	Email          *string            `json:"email"`
+	ProfilePicture *string            `json:"profile_picture"`
+	Preferences    *PreferencesUpdate `json:"preferences"`
+}
+
+type PreferencesUpdate struct {
+	DefaultCurrency   *string `json:"default_currency"`
+	DefaultCollection *string `json:"default_collection"`
+	PriceSource       *string `json:"price_source"`
+	PublicProfile     *bool   `json:"public_profile"`
+}
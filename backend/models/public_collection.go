@@ -0,0 +1,35 @@
+package models
+
+// PublicCollection is a shared collection as anyone with its link sees it.
+// It leaves out everything private to the owner: purchase prices, notes,
+// acquisition dates and copy IDs. Owner is only given when the owner has a
+// public profile.
+type PublicCollection struct {
+	Slug           string       `json:"slug"`
+	CollectionName string       `json:"collection_name"`
+	Visibility     string       `json:"visibility"`
+	Owner          string       `json:"owner,omitempty"`
+	Cards          []PublicCard `json:"cards"`
+}
+
+// PublicCard is one owned copy (or lot) in a PublicCollection.
+type PublicCard struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	Edition   string      `json:"edition"`
+	Set       string      `json:"set"`
+	Image     string      `json:"image"`
+	Type      string      `json:"type"`
+	Grade     interface{} `json:"grade"`
+	Quantity  int         `json:"quantity"`
+	Condition string      `json:"condition"`
+	Language  string      `json:"language"`
+	Finish    string      `json:"finish"`
+}
+
+// PublicCollectionSummary lists a public collection on its owner's profile.
+type PublicCollectionSummary struct {
+	Slug           string `json:"slug"`
+	CollectionName string `json:"collection_name"`
+	CardCount      int    `json:"card_count"`
+}
@@ -0,0 +1,24 @@
+package models
+
+// SetProgress reports how much of a set a user owns. With Variants set, each
+// reverse holo and 1st edition print counts as its own slot alongside the
+// base card.
+type SetProgress struct {
+	SetID    string        `json:"set_id"`
+	SetName  string        `json:"set_name"`
+	Variants bool          `json:"variants"`
+	Owned    int           `json:"owned"`
+	Total    int           `json:"total"`
+	Percent  float64       `json:"percent"`
+	Missing  []MissingCard `json:"missing"`
+}
+
+// MissingCard is a set slot the user does not own. Variant is empty for the
+// base print.
+type MissingCard struct {
+	ID      string `json:"id"`
+	Number  string `json:"number"`
+	Name    string `json:"name"`
+	Image   string `json:"image"`
+	Variant string `json:"variant,omitempty"`
+}
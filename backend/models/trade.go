@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+// Trade states. A proposal or counter-offer waits on the other party, who can
+// accept, decline or counter it. Accepted trades complete when either party
+// confirms the exchange; until then either can cancel.
+const (
+	TradeProposed  = "proposed"
+	TradeCountered = "countered"
+	TradeAccepted  = "accepted"
+	TradeDeclined  = "declined"
+	TradeCompleted = "completed"
+	TradeCancelled = "cancelled"
+)
+
+// Trade is an exchange of copies, and optionally cash, between two users.
+type Trade struct {
+	TradeID        int        `json:"trade_id"`
+	Status         string     `json:"status"`
+	AwaitingUserID *int       `json:"awaiting_user_id"`
+	Message        string     `json:"message"`
+	Proposer       TradeSide  `json:"proposer"`
+	Recipient      TradeSide  `json:"recipient"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
+// TradeSide is what one party gives. EstimatedValue is the market value of
+// its copies plus its cash; copies without market data count as nothing and
+// are counted in UnpricedItems.
+type TradeSide struct {
+	UserID         int         `json:"user_id"`
+	Username       string      `json:"username"`
+	CollectionID   *int        `json:"collection_id"`
+	Items          []TradeItem `json:"items"`
+	Cash           float64     `json:"cash"`
+	EstimatedValue float64     `json:"estimated_value"`
+	UnpricedItems  int         `json:"unpriced_items"`
+}
+
+// TradeItem is units of one copy given in a trade. UnitValue is the market
+// price per unit, nil when there is no market data for the copy.
+type TradeItem struct {
+	UserItemID int         `json:"user_item_id"`
+	ItemID     string      `json:"item_id"`
+	Name       string      `json:"name"`
+	Edition    string      `json:"edition"`
+	Set        string      `json:"set"`
+	Image      string      `json:"image"`
+	Grade      interface{} `json:"grade"`
+	Condition  string      `json:"condition"`
+	Language   string      `json:"language"`
+	Finish     string      `json:"finish"`
+	Quantity   int         `json:"quantity"`
+	UnitValue  *float64    `json:"unit_value"`
+}
+
+// TradeOffer is a proposal or counter-offer, from the point of view of the
+// user making it: Give are their own copies, Receive the other party's, and
+// Cash is what they pay (negative to ask for cash). CollectionID is where
+// the copies they receive should go.
+type TradeOffer struct {
+	Recipient    string             `json:"recipient"`
+	Give         []TradeItemRequest `json:"give"`
+	Receive      []TradeItemRequest `json:"receive"`
+	Cash         float64            `json:"cash"`
+	Message      string             `json:"message"`
+	CollectionID *int               `json:"collection_id"`
+}
+
+type TradeItemRequest struct {
+	UserItemID int `json:"user_item_id"`
+	Quantity   int `json:"quantity"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// TrashedCollection is a soft-deleted collection awaiting restore or purge.
+type TrashedCollection struct {
+	CollectionID   int       `json:"collection_id"`
+	CollectionName string    `json:"collection_name"`
+	DeletedAt      time.Time `json:"deleted_at"`
+	ItemCount      int       `json:"item_count"`
+}
+
+// TrashedCopy is a card or item copy removed on its own from a collection.
+type TrashedCopy struct {
+	Card
+	CollectionID   int       `json:"collection_id"`
+	CollectionName string    `json:"collection_name"`
+	DeletedAt      time.Time `json:"deleted_at"`
+}
+
+type Trash struct {
+	Collections []TrashedCollection `json:"collections"`
+	Copies      []TrashedCopy       `json:"copies"`
+}
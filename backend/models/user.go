@@ -1,10 +1,6 @@
 package models
 
-import (
-	"time"
-
-	"github.com/dgrijalva/jwt-go"
-)
+import "time"
 
 type User struct {
 	ID             string    `json:"id"`
@@ -20,8 +16,3 @@ type User struct {
 	IsAdmin        bool      `json:"is_admin"`
 	IsSubscribed   bool      `json:"is_subscribed"`
 }
-
-type Claims struct {
-	Username string `json:"username"`
-	jwt.StandardClaims
-}
@@ -4,9 +4,19 @@ import (
 	"github.com/CatsMeow492/PokemonCollection/database"
 )
 
+// Collection visibilities. Unlisted collections can be read by anyone with
+// their share link; public ones are also listed on the owner's profile.
+const (
+	VisibilityPrivate  = "private"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPublic   = "public"
+)
+
 type Collection struct {
 	CollectionID   int    `json:"collection_id"`
 	CollectionName string `json:"collection_name"`
+	Visibility     string `json:"visibility,omitempty"`
+	ShareSlug      string `json:"share_slug,omitempty"`
 	Cards          []Card `json:"cards"`
 	Items          []Item `json:"items"`
 }
@@ -18,7 +28,7 @@ func FetchCollectionsByUserID(userID string) ([]Collection, error) {
 	rows, err := database.DB.Query(`
 		SELECT collection_id, collection_name 
 		FROM Collections 
-		WHERE user_id = $1`, userID)
+		WHERE user_id = $1 AND deleted_at IS NULL`, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -36,7 +46,7 @@ func FetchCollectionsByUserID(userID string) ([]Collection, error) {
 			SELECT i.item_id, i.name, i.edition, i.set, i.image, ui.grade, ui.price, ui.quantity
 			FROM UserItems ui
 			JOIN Items i ON ui.item_id = i.item_id
-			WHERE ui.collection_id = $1`, collection.CollectionID)
+			WHERE ui.collection_id = $1 AND ui.deleted_at IS NULL`, collection.CollectionID)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Want is a card a user is looking to buy at or below MaxPrice. Empty Grade,
+// Condition, Language or Finish match any market for the card.
+type Want struct {
+	WantID    int       `json:"want_id"`
+	ItemID    string    `json:"item_id"`
+	Name      string    `json:"name"`
+	Edition   string    `json:"edition"`
+	Image     string    `json:"image"`
+	Grade     string    `json:"grade"`
+	Condition string    `json:"condition"`
+	Language  string    `json:"language"`
+	Finish    string    `json:"finish"`
+	MaxPrice  float64   `json:"max_price"`
+	Notes     string    `json:"notes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PriceAlert records a market price that met a want.
+type PriceAlert struct {
+	AlertID     int        `json:"alert_id"`
+	WantID      int        `json:"want_id"`
+	UserID      int        `json:"user_id"`
+	ItemID      string     `json:"item_id"`
+	Name        string     `json:"name"`
+	Grade       string     `json:"grade"`
+	Price       float64    `json:"price"`
+	MaxPrice    float64    `json:"max_price"`
+	TriggeredAt time.Time  `json:"triggered_at"`
+	DismissedAt *time.Time `json:"dismissed_at,omitempty"`
+}
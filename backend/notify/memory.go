@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory keeps every message it is given, for tests and local development.
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *Memory) Notify(_ context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of the messages received so far.
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
+
+// MemoryDeliveryLog keeps webhook delivery attempts in memory.
+type MemoryDeliveryLog struct {
+	mu         sync.Mutex
+	deliveries []Delivery
+}
+
+func (l *MemoryDeliveryLog) RecordDelivery(delivery Delivery) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deliveries = append(l.deliveries, delivery)
+	return nil
+}
+
+// Deliveries returns a copy of the attempts recorded so far.
+func (l *MemoryDeliveryLog) Deliveries() []Delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Delivery(nil), l.deliveries...)
+}
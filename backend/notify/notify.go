@@ -0,0 +1,77 @@
+// Package notify delivers user notifications such as price alerts, order
+// status changes and password resets. Each channel is a Notifier; channels are
+// combined with Multi and limited to some events with Events.
+package notify
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Events that produce notifications.
+const (
+	EventPriceAlert    = "price_alert"
+	EventOrderStatus   = "order_status"
+	EventTrade         = "trade"
+	EventPasswordReset = "password_reset"
+	EventVerifyEmail   = "verify_email"
+)
+
+// Message is one notification to one user. To is the user's email address
+// and is left out of webhook payloads.
+type Message struct {
+	Event   string                 `json:"event"`
+	UserID  int                    `json:"user_id"`
+	To      string                 `json:"-"`
+	Subject string                 `json:"subject"`
+	Body    string                 `json:"body"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+	SentAt  time.Time              `json:"sent_at"`
+}
+
+// Notifier delivers messages over one channel.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Multi delivers each message to every notifier in turn and returns their
+// errors joined.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, msg Message) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Events wraps a notifier so it only receives the listed events. It keeps
+// secrets such as reset links off channels like third-party webhooks.
+func Events(notifier Notifier, events ...string) Notifier {
+	allowed := make(map[string]bool, len(events))
+	for _, event := range events {
+		allowed[event] = true
+	}
+	return eventFilter{notifier: notifier, allowed: allowed}
+}
+
+type eventFilter struct {
+	notifier Notifier
+	allowed  map[string]bool
+}
+
+func (f eventFilter) Notify(ctx context.Context, msg Message) error {
+	if !f.allowed[msg.Event] {
+		return nil
+	}
+	return f.notifier.Notify(ctx, msg)
+}
+
+// Noop discards every message. It is the default when nothing is configured.
+type Noop struct{}
+
+func (Noop) Notify(context.Context, Message) error { return nil }
@@ -0,0 +1,88 @@
+package notifytest
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/CatsMeow492/PokemonCollection/notify"
+)
+
+// Received is one webhook delivery that reached a Receiver.
+type Received struct {
+	DeliveryID string
+	Event      string
+	Message    notify.Message
+}
+
+// Receiver is an httptest server that accepts notify webhooks. Deliveries
+// with a bad signature get 401. The first FailFirst requests get 503 so
+// retries can be exercised.
+type Receiver struct {
+	*httptest.Server
+	Secret    string
+	FailFirst int
+
+	mu       sync.Mutex
+	requests int
+	received []Received
+}
+
+// NewReceiver starts a receiver that checks signatures against secret.
+func NewReceiver(secret string) *Receiver {
+	receiver := &Receiver{Secret: secret}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(receiver.handle))
+	return receiver
+}
+
+// Received returns a copy of the deliveries accepted so far.
+func (rc *Receiver) Received() []Received {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]Received(nil), rc.received...)
+}
+
+// Requests returns how many requests arrived, including failed ones.
+func (rc *Receiver) Requests() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.requests
+}
+
+func (rc *Receiver) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading body", http.StatusBadRequest)
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests++
+	if rc.requests <= rc.FailFirst {
+		http.Error(w, "Failing on purpose", http.StatusServiceUnavailable)
+		return
+	}
+
+	expected := notify.Sign(rc.Secret, r.Header.Get(notify.TimestampHeader), body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(notify.SignatureHeader))) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var msg notify.Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	rc.received = append(rc.received, Received{
+		DeliveryID: r.Header.Get(notify.DeliveryHeader),
+		Event:      r.Header.Get(notify.EventHeader),
+		Message:    msg,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
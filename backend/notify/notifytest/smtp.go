@@ -0,0 +1,159 @@
+// Package notifytest provides local stand-ins for the services notify talks
+// to: a minimal SMTP server that captures mail, in the spirit of MailHog, and
+// an httptest webhook receiver that checks signatures.
+package notifytest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Mail is one message accepted by an SMTPServer.
+type Mail struct {
+	From string
+	To   []string
+	Data string
+}
+
+// SMTPServer accepts mail on a local port and keeps it in memory. It speaks
+// just enough SMTP for net/smtp: EHLO/HELO, AUTH PLAIN, MAIL, RCPT, DATA,
+// RSET, NOOP and QUIT. There is no TLS, so use it with net/smtp only on
+// localhost, where PlainAuth allows plaintext.
+type SMTPServer struct {
+	Addr string
+
+	listener net.Listener
+	mu       sync.Mutex
+	mail     []Mail
+	wg       sync.WaitGroup
+}
+
+// NewSMTPServer starts a server on a random localhost port.
+func NewSMTPServer() (*SMTPServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &SMTPServer{Addr: listener.Addr().String(), listener: listener}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Mail returns a copy of the messages accepted so far.
+func (s *SMTPServer) Mail() []Mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Mail(nil), s.mail...)
+}
+
+// Close stops accepting connections and waits for open ones to finish.
+func (s *SMTPServer) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *SMTPServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *SMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	reply("220 notifytest ESMTP ready")
+	var current Mail
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(line)
+		if i := strings.IndexByte(verb, ' '); i >= 0 {
+			verb = verb[:i]
+		}
+
+		switch verb {
+		case "EHLO":
+			reply("250-notifytest")
+			reply("250 AUTH PLAIN")
+		case "HELO":
+			reply("250 notifytest")
+		case "AUTH":
+			reply("235 Authentication successful")
+		case "MAIL":
+			current = Mail{From: addressArg(line)}
+			reply("250 OK")
+		case "RCPT":
+			current.To = append(current.To, addressArg(line))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			data, err := readData(reader)
+			if err != nil {
+				return
+			}
+			current.Data = data
+			s.mu.Lock()
+			s.mail = append(s.mail, current)
+			s.mu.Unlock()
+			current = Mail{}
+			reply("250 OK")
+		case "RSET":
+			current = Mail{}
+			reply("250 OK")
+		case "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// addressArg returns the address in "MAIL FROM:<a@b>" or "RCPT TO:<a@b>".
+func addressArg(line string) string {
+	start, end := strings.IndexByte(line, '<'), strings.LastIndexByte(line, '>')
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
+
+// readData reads a DATA section up to the lone "." line, undoing dot-stuffing.
+func readData(reader *bufio.Reader) (string, error) {
+	var b strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		trimmed := strings.TrimRight(line, "\r\n")
+		if trimmed == "." {
+			return b.String(), nil
+		}
+		b.WriteString(strings.TrimPrefix(trimmed, "."))
+		b.WriteString("\r\n")
+	}
+}
@@ -0,0 +1,73 @@
+package notify_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/CatsMeow492/PokemonCollection/notify"
+	"github.com/CatsMeow492/PokemonCollection/notify/notifytest"
+)
+
+func newSMTP(t *testing.T) (*notify.SMTP, *notifytest.SMTPServer) {
+	t.Helper()
+	server, err := notifytest.NewSMTPServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return &notify.SMTP{Addr: server.Addr, Username: "mailer", Password: "secret", From: "alerts@example.com"}, server
+}
+
+func TestSMTPComposesMessage(t *testing.T) {
+	mailer, server := newSMTP(t)
+	err := mailer.Notify(context.Background(), notify.Message{
+		Event:   notify.EventPasswordReset,
+		To:      "ash@example.com",
+		Subject: "Reset your password\r\nBcc: eve@example.com",
+		Body:    "Open this link:\n\n.https://example.com/reset",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail := server.Mail()
+	if len(mail) != 1 {
+		t.Fatalf("server got %d messages, want 1", len(mail))
+	}
+	got := mail[0]
+	if got.From != "alerts@example.com" || len(got.To) != 1 || got.To[0] != "ash@example.com" {
+		t.Errorf("envelope from %q to %q", got.From, got.To)
+	}
+
+	header, body, ok := strings.Cut(got.Data, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("no blank line between header and body: %q", got.Data)
+	}
+	for _, want := range []string{
+		"From: alerts@example.com",
+		"To: ash@example.com",
+		"Subject: Reset your passwordBcc: eve@example.com",
+		"Content-Type: text/plain; charset=UTF-8",
+	} {
+		if !strings.Contains(header, want+"\r\n") && !strings.HasSuffix(header, want) {
+			t.Errorf("header is missing %q:\n%s", want, header)
+		}
+	}
+	if strings.Contains(header, "\r\nBcc:") {
+		t.Errorf("subject injected a header:\n%s", header)
+	}
+	if want := "Open this link:\r\n\r\n.https://example.com/reset\r\n"; body != want {
+		t.Errorf("body %q, want %q", body, want)
+	}
+}
+
+func TestSMTPSkipsMessagesWithoutAddress(t *testing.T) {
+	mailer, server := newSMTP(t)
+	if err := mailer.Notify(context.Background(), notify.Message{Event: notify.EventTrade, Subject: "Trade #1"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(server.Mail()); n != 0 {
+		t.Errorf("server got %d messages, want 0", n)
+	}
+}
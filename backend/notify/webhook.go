@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Headers sent with every webhook delivery.
+const (
+	SignatureHeader = "X-Signature-256"
+	TimestampHeader = "X-Timestamp"
+	EventHeader     = "X-Event"
+	DeliveryHeader  = "X-Delivery-ID"
+)
+
+// Delivery is one attempt to deliver a webhook.
+type Delivery struct {
+	DeliveryID string    `json:"delivery_id"`
+	Event      string    `json:"event"`
+	URL        string    `json:"url"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Succeeded  bool      `json:"succeeded"`
+	AttemptAt  time.Time `json:"attempted_at"`
+}
+
+// DeliveryLog records webhook delivery attempts.
+type DeliveryLog interface {
+	RecordDelivery(delivery Delivery) error
+}
+
+// Webhook POSTs messages as JSON to a URL, signed with an HMAC-SHA256 of the
+// timestamp and body. Failed deliveries are retried with exponential backoff
+// on network errors, 408, 429 and 5xx responses. Every attempt goes to Log
+// when one is set.
+type Webhook struct {
+	URL         string
+	Secret      string
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     time.Duration
+	Log         DeliveryLog
+}
+
+// Sign returns the signature header value for a delivery. Receivers compute
+// it over the X-Timestamp header, a dot and the raw body, and compare.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhook) Notify(ctx context.Context, msg Message) error {
+	if msg.SentAt.IsZero() {
+		msg.SentAt = time.Now().UTC()
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	attempts := w.MaxAttempts
+	if attempts <= 0 {
+		attempts = 5
+	}
+	backoff := w.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	deliveryID := uuid.New().String()
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(backoff << (attempt - 2)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		statusCode, err := w.deliver(ctx, client, deliveryID, msg.Event, body)
+		delivery := Delivery{
+			DeliveryID: deliveryID,
+			Event:      msg.Event,
+			URL:        w.URL,
+			Attempt:    attempt,
+			StatusCode: statusCode,
+			Succeeded:  err == nil,
+			AttemptAt:  time.Now().UTC(),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if w.Log != nil {
+			if logErr := w.Log.RecordDelivery(delivery); logErr != nil {
+				log.Printf("Error recording webhook delivery %s: %v", deliveryID, logErr)
+			}
+		}
+
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retryable(statusCode) {
+			break
+		}
+	}
+	return fmt.Errorf("webhook delivery %s failed: %w", deliveryID, lastErr)
+}
+
+func (w *Webhook) deliver(ctx context.Context, client *http.Client, deliveryID string, event string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(SignatureHeader, Sign(w.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("received status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryable reports whether a failed attempt is worth repeating. Zero means
+// no response was received.
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusRequestTimeout ||
+		statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
@@ -0,0 +1,125 @@
+package notify_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/notify"
+	"github.com/CatsMeow492/PokemonCollection/notify/notifytest"
+)
+
+func newWebhook(t *testing.T, receiver *notifytest.Receiver, secret string) (*notify.Webhook, *notify.MemoryDeliveryLog) {
+	t.Helper()
+	t.Cleanup(receiver.Close)
+	deliveries := &notify.MemoryDeliveryLog{}
+	return &notify.Webhook{
+		URL:         receiver.URL,
+		Secret:      secret,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		Log:         deliveries,
+	}, deliveries
+}
+
+var priceAlert = notify.Message{
+	Event:   notify.EventPriceAlert,
+	UserID:  7,
+	To:      "ash@example.com",
+	Subject: "Price alert",
+	Body:    "Charizard is now $12.50",
+}
+
+func TestWebhookSignsDelivery(t *testing.T) {
+	receiver := notifytest.NewReceiver("hook-secret")
+	webhook, deliveries := newWebhook(t, receiver, "hook-secret")
+
+	if err := webhook.Notify(context.Background(), priceAlert); err != nil {
+		t.Fatal(err)
+	}
+
+	received := receiver.Received()
+	if len(received) != 1 {
+		t.Fatalf("received %d deliveries, want 1", len(received))
+	}
+	got := received[0]
+	if got.Event != notify.EventPriceAlert || got.Message.Subject != priceAlert.Subject || got.Message.UserID != priceAlert.UserID {
+		t.Errorf("received %+v", got)
+	}
+	if got.Message.To != "" {
+		t.Errorf("payload carried the address %q", got.Message.To)
+	}
+
+	log := deliveries.Deliveries()
+	if len(log) != 1 || !log[0].Succeeded || log[0].DeliveryID != got.DeliveryID || log[0].StatusCode != 204 {
+		t.Errorf("delivery log %+v", log)
+	}
+}
+
+func TestWebhookWrongSecretIsNotRetried(t *testing.T) {
+	receiver := notifytest.NewReceiver("hook-secret")
+	webhook, deliveries := newWebhook(t, receiver, "another-secret")
+
+	if err := webhook.Notify(context.Background(), priceAlert); err == nil {
+		t.Fatal("delivery with the wrong secret succeeded")
+	}
+	if n := receiver.Requests(); n != 1 {
+		t.Errorf("receiver got %d requests, want 1", n)
+	}
+	if n := len(receiver.Received()); n != 0 {
+		t.Errorf("receiver accepted %d deliveries", n)
+	}
+	log := deliveries.Deliveries()
+	if len(log) != 1 || log[0].Succeeded || log[0].StatusCode != 401 || log[0].Error == "" {
+		t.Errorf("delivery log %+v", log)
+	}
+}
+
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	receiver := notifytest.NewReceiver("hook-secret")
+	receiver.FailFirst = 2
+	webhook, deliveries := newWebhook(t, receiver, "hook-secret")
+	webhook.Backoff = 20 * time.Millisecond
+
+	start := time.Now()
+	if err := webhook.Notify(context.Background(), priceAlert); err != nil {
+		t.Fatal(err)
+	}
+	// Waits of one and then two backoffs come before the second and third
+	// attempts
+	if elapsed := time.Since(start); elapsed < 3*webhook.Backoff {
+		t.Errorf("delivered after %s, want at least %s", elapsed, 3*webhook.Backoff)
+	}
+
+	log := deliveries.Deliveries()
+	if len(log) != 3 {
+		t.Fatalf("logged %d attempts, want 3: %+v", len(log), log)
+	}
+	for i, delivery := range log {
+		if delivery.Attempt != i+1 || delivery.DeliveryID != log[0].DeliveryID {
+			t.Errorf("attempt %d logged as %+v", i+1, delivery)
+		}
+		if succeeded := i == 2; delivery.Succeeded != succeeded {
+			t.Errorf("attempt %d succeeded = %t, want %t", i+1, delivery.Succeeded, succeeded)
+		}
+	}
+	if log[0].StatusCode != 503 {
+		t.Errorf("first attempt status %d, want 503", log[0].StatusCode)
+	}
+}
+
+func TestWebhookGivesUpAfterMaxAttempts(t *testing.T) {
+	receiver := notifytest.NewReceiver("hook-secret")
+	receiver.FailFirst = 10
+	webhook, deliveries := newWebhook(t, receiver, "hook-secret")
+
+	if err := webhook.Notify(context.Background(), priceAlert); err == nil {
+		t.Fatal("delivery succeeded against a failing receiver")
+	}
+	if n := receiver.Requests(); n != webhook.MaxAttempts {
+		t.Errorf("receiver got %d requests, want %d", n, webhook.MaxAttempts)
+	}
+	if n := len(deliveries.Deliveries()); n != webhook.MaxAttempts {
+		t.Errorf("logged %d attempts, want %d", n, webhook.MaxAttempts)
+	}
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	refill  time.Duration
+	burst   int
+}
+
+// full reports whether the bucket has refilled completely by now, at which
+// point it's the same as a new bucket and can be dropped.
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+float64(now.Sub(b.updated))/float64(b.refill) >= float64(b.burst)
+}
+
+// MemoryStore keeps buckets in memory. Full buckets are swept periodically
+// so idle clients don't accumulate.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+const sweepInterval = time.Minute
+
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, b := range s.buckets {
+			if b.full(now) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.refill, b.burst = limit.Refill, limit.Burst
+
+	b.tokens += float64(now.Sub(b.updated)) / float64(limit.Refill)
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	return false, time.Duration((1 - b.tokens) * float64(limit.Refill)), nil
+}
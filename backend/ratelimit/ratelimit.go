@@ -0,0 +1,92 @@
+// Package ratelimit limits how often a client may hit an endpoint using token
+// buckets. Buckets live in a Store so they can be shared between instances;
+// MemoryStore keeps them in process.
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limit is a token bucket: it holds up to Burst tokens and regains one every
+// Refill.
+type Limit struct {
+	Burst  int
+	Refill time.Duration
+}
+
+// PerHour returns a limit of n requests an hour that may all come at once.
+func PerHour(n int) Limit {
+	return Limit{Burst: n, Refill: time.Hour / time.Duration(n)}
+}
+
+// PerMinute returns a limit of n requests a minute that may all come at once.
+func PerMinute(n int) Limit {
+	return Limit{Burst: n, Refill: time.Minute / time.Duration(n)}
+}
+
+// Store keeps token buckets. Take removes a token from the bucket for key if
+// one is available and otherwise reports how long until one will be.
+type Store interface {
+	Take(key string, limit Limit, now time.Time) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// Limiter applies one limit to keys within a namespace, so the same store can
+// back several limiters.
+type Limiter struct {
+	Name  string
+	Limit Limit
+	Store Store
+}
+
+func New(name string, limit Limit, store Store) *Limiter {
+	return &Limiter{Name: name, Limit: limit, Store: store}
+}
+
+// Allow takes a token for key. Store errors fail open so an unavailable store
+// doesn't take the endpoint down with it.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	allowed, retryAfter, err := l.Store.Take(l.Name+":"+key, l.Limit, time.Now())
+	if err != nil {
+		log.Printf("Error checking %s rate limit: %v", l.Name, err)
+		return true, 0
+	}
+	return allowed, retryAfter
+}
+
+// Middleware rejects requests over the limit for their client IP with 429
+// and a Retry-After header.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allowed, retryAfter := l.Allow(ClientIP(r)); !allowed {
+			TooManyRequests(w, retryAfter)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TooManyRequests writes a 429 response telling the client when to retry.
+func TooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, fmt.Sprintf("Too many requests; retry in %d seconds", seconds), http.StatusTooManyRequests)
+}
+
+// ClientIP returns the address the request came from. Forwarding headers are
+// ignored because they are set by the client unless a proxy overwrites them.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -11,17 +11,127 @@ CREATE TABLE Users (
     last_login TIMESTAMP,
     is_active BOOLEAN DEFAULT TRUE,
     is_admin BOOLEAN DEFAULT FALSE,
-    is_subscribed BOOLEAN DEFAULT FALSE
+    is_subscribed BOOLEAN DEFAULT FALSE,
+    email_verified BOOLEAN DEFAULT FALSE,
+    failed_logins INT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP,
+    -- admin, moderator or user. is_admin predates roles and still grants admin.
+    role VARCHAR(20) NOT NULL DEFAULT 'user'
 );
 
+-- LoginAttempts Table
+-- Every login attempt, successful or not. user_id is NULL when the username
+-- or email didn't match an account.
+CREATE TABLE LoginAttempts (
+    attempt_id SERIAL PRIMARY KEY,
+    user_id INT,
+    username VARCHAR(100) NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    succeeded BOOLEAN NOT NULL,
+    reason VARCHAR(20),
+    attempted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(user_id)
+);
+CREATE INDEX loginattempts_user_idx ON LoginAttempts (user_id, attempted_at);
+CREATE INDEX loginattempts_ip_idx ON LoginAttempts (ip_address, attempted_at);
+
+-- UserTokens Table
+-- Single-use password reset and email verification tokens. Only a SHA-256
+-- hash of each token is stored.
+CREATE TABLE UserTokens (
+    token_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    purpose VARCHAR(20) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(user_id)
+);
+CREATE INDEX usertokens_user_idx ON UserTokens (user_id, purpose);
+
+-- RefreshTokens Table
+-- Refresh tokens are stored hashed and rotated on every use. Tokens rotated
+-- from the same login share a family_id so a session is revoked as a whole.
+CREATE TABLE RefreshTokens (
+    token_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    family_id UUID NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    rotated_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(user_id)
+);
+CREATE INDEX refreshtokens_user_idx ON RefreshTokens (user_id);
+CREATE INDEX refreshtokens_family_idx ON RefreshTokens (family_id);
+
+-- UserIdentities Table
+-- Accounts at external OpenID Connect providers linked to a user. subject is
+-- the provider's stable ID for the account; email is what it last reported.
+CREATE TABLE UserIdentities (
+    identity_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(100),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP,
+    UNIQUE (provider, subject),
+    FOREIGN KEY (user_id) REFERENCES Users(user_id) ON DELETE CASCADE
+);
+CREATE INDEX useridentities_user_idx ON UserIdentities (user_id);
+
+-- ApiKeys Table
+-- Personal API keys for scripts. Only a SHA-256 hash of each key is stored;
+-- key_prefix is its first characters, shown so users can tell keys apart.
+-- scope is read or write.
+CREATE TABLE ApiKeys (
+    key_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    scope VARCHAR(10) NOT NULL,
+    key_prefix VARCHAR(20) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(user_id) ON DELETE CASCADE
+);
+CREATE INDEX apikeys_user_idx ON ApiKeys (user_id);
+
 -- Collections Table
+-- visibility is private, unlisted (readable by anyone with the share_slug
+-- link) or public (also listed on the owner's public profile). share_slug is
+-- set while the collection is shared.
 CREATE TABLE Collections (
     collection_id SERIAL PRIMARY KEY,
     user_id INT NOT NULL,
     collection_name VARCHAR(100) NOT NULL,
+    visibility VARCHAR(10) NOT NULL DEFAULT 'private',
+    share_slug VARCHAR(32) UNIQUE,
+    deleted_at TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES Users(user_id)
 );
 
+-- Names only need to be unique among live collections so a deleted collection
+-- doesn't block reusing its name.
+CREATE UNIQUE INDEX collections_user_name_key ON Collections (user_id, collection_name) WHERE deleted_at IS NULL;
+
+-- UserPreferences Table
+-- One row per user once they change a setting; missing rows mean defaults.
+CREATE TABLE UserPreferences (
+    user_id INT PRIMARY KEY,
+    default_currency VARCHAR(3) NOT NULL DEFAULT 'USD',
+    default_collection_id INT,
+    price_source VARCHAR(20) NOT NULL DEFAULT 'ebay',
+    public_profile BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(user_id),
+    FOREIGN KEY (default_collection_id) REFERENCES Collections(collection_id) ON DELETE SET NULL
+);
+
 -- Items Table
 CREATE TABLE Items (
     item_id VARCHAR(50) PRIMARY KEY,
@@ -40,19 +150,287 @@ CREATE TABLE UserItems (
     grade VARCHAR(50),
     price DECIMAL(10,2),
     quantity INT DEFAULT 1,
+    condition VARCHAR(50),
+    language VARCHAR(50) DEFAULT 'English',
+    finish VARCHAR(50),
+    acquired_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    notes TEXT,
+    deleted_at TIMESTAMP,
     FOREIGN KEY (collection_id) REFERENCES Collections(collection_id),
     FOREIGN KEY (item_id) REFERENCES Items(item_id)
 );
 
+-- Each UserItems row is one owned copy (or lot), so a collection may hold the
+-- same item_id several times.
+CREATE INDEX useritems_collection_item_idx ON UserItems (collection_id, item_id);
+
+-- LedgerEntries Table
+-- Acquisitions (buy, trade_in, gift_in) open cost lots, disposals (sell,
+-- trade_out, gift_out) consume them, grading adds to a copy's cost. A removal
+-- closes the lots of a trashed copy until it is restored. user_item_id has no
+-- foreign key so history survives the copy being removed.
+CREATE TABLE LedgerEntries (
+    entry_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    user_item_id INT,
+    item_id VARCHAR(50) NOT NULL,
+    entry_type VARCHAR(20) NOT NULL,
+    quantity INT NOT NULL DEFAULT 1,
+    price DECIMAL(10,2) DEFAULT 0,
+    fees DECIMAL(10,2) DEFAULT 0,
+    shipping DECIMAL(10,2) DEFAULT 0,
+    counterparty VARCHAR(100),
+    notes TEXT,
+    cost_basis DECIMAL(10,2),
+    realized_gain DECIMAL(10,2),
+    occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(user_id),
+    FOREIGN KEY (item_id) REFERENCES Items(item_id)
+);
+CREATE INDEX ledgerentries_user_item_idx ON LedgerEntries (user_id, item_id, occurred_at);
+
+-- LedgerAllocations Table
+-- Which acquisition lots a disposal consumed, and at what cost.
+CREATE TABLE LedgerAllocations (
+    allocation_id SERIAL PRIMARY KEY,
+    disposal_entry_id INT NOT NULL,
+    lot_entry_id INT NOT NULL,
+    quantity INT NOT NULL,
+    cost DECIMAL(10,2) NOT NULL,
+    FOREIGN KEY (disposal_entry_id) REFERENCES LedgerEntries(entry_id),
+    FOREIGN KEY (lot_entry_id) REFERENCES LedgerEntries(entry_id)
+);
+
 -- MarketData Table
 CREATE TABLE MarketData (
     market_data_id SERIAL PRIMARY KEY,
     item_id VARCHAR(50) NOT NULL,
+    name VARCHAR(100),
+    edition VARCHAR(100),
+    grade VARCHAR(50),
+    type VARCHAR(50),
+    condition VARCHAR(50),
+    language VARCHAR(50),
+    finish VARCHAR(50),
     price DECIMAL(10,2),
+    market_value DECIMAL(10,2),
+    last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     fetched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (item_id) REFERENCES Items(item_id)
 );
 
+-- Trades Table
+-- A proposed exchange of copies between two users. awaiting_user_id is the
+-- party who has to answer the latest offer. cash_amount is paid by the
+-- proposer to the recipient, or the other way round when negative. Each
+-- party's collection_id is where the copies they receive go.
+CREATE TABLE Trades (
+    trade_id SERIAL PRIMARY KEY,
+    proposer_id INT NOT NULL,
+    recipient_id INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'proposed',
+    awaiting_user_id INT,
+    cash_amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+    message TEXT,
+    proposer_collection_id INT,
+    recipient_collection_id INT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP,
+    FOREIGN KEY (proposer_id) REFERENCES Users(user_id),
+    FOREIGN KEY (recipient_id) REFERENCES Users(user_id)
+);
+CREATE INDEX trades_proposer_idx ON Trades (proposer_id, updated_at);
+CREATE INDEX trades_recipient_idx ON Trades (recipient_id, updated_at);
+
+-- TradeItems Table
+-- The copies in a trade's current offer. owner_id is the party giving the
+-- copy. Copies aren't reserved; they are checked again when the trade is
+-- accepted and when it completes. The copy's attributes are kept so the trade
+-- can still be shown after the copy has changed hands, and unit_value is the
+-- market value it was traded at.
+CREATE TABLE TradeItems (
+    trade_id INT NOT NULL,
+    user_item_id INT NOT NULL,
+    owner_id INT NOT NULL,
+    item_id VARCHAR(50) NOT NULL,
+    grade VARCHAR(50),
+    condition VARCHAR(50),
+    language VARCHAR(50),
+    finish VARCHAR(50),
+    quantity INT NOT NULL DEFAULT 1,
+    unit_value DECIMAL(10,2),
+    PRIMARY KEY (trade_id, user_item_id),
+    FOREIGN KEY (trade_id) REFERENCES Trades(trade_id) ON DELETE CASCADE,
+    FOREIGN KEY (item_id) REFERENCES Items(item_id)
+);
+
+-- Listings Table
+-- Copies offered for sale on the marketplace. price is for all quantity
+-- units. The copy's attributes are kept so sold listings can still be shown;
+-- user_item_id has no foreign key for the same reason. An active listing is
+-- only for sale while the seller still holds the copy.
+CREATE TABLE Listings (
+    listing_id SERIAL PRIMARY KEY,
+    seller_id INT NOT NULL,
+    user_item_id INT NOT NULL,
+    item_id VARCHAR(50) NOT NULL,
+    grade VARCHAR(50),
+    condition VARCHAR(50),
+    language VARCHAR(50),
+    finish VARCHAR(50),
+    quantity INT NOT NULL DEFAULT 1,
+    price DECIMAL(10,2) NOT NULL,
+    description TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sold_at TIMESTAMP,
+    FOREIGN KEY (seller_id) REFERENCES Users(user_id),
+    FOREIGN KEY (item_id) REFERENCES Items(item_id)
+);
+CREATE UNIQUE INDEX listings_active_copy_key ON Listings (user_item_id) WHERE status = 'active';
+CREATE INDEX listings_status_idx ON Listings (status, created_at);
+CREATE INDEX listings_seller_idx ON Listings (seller_id, created_at);
+
+-- ListingPhotos Table
+-- Condition photos of a listed copy, by URL, in display order.
+CREATE TABLE ListingPhotos (
+    photo_id SERIAL PRIMARY KEY,
+    listing_id INT NOT NULL,
+    url VARCHAR(500) NOT NULL,
+    position INT NOT NULL,
+    FOREIGN KEY (listing_id) REFERENCES Listings(listing_id) ON DELETE CASCADE
+);
+
+-- ListingShippingOptions Table
+CREATE TABLE ListingShippingOptions (
+    option_id SERIAL PRIMARY KEY,
+    listing_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    price DECIMAL(10,2) NOT NULL DEFAULT 0,
+    FOREIGN KEY (listing_id) REFERENCES Listings(listing_id) ON DELETE CASCADE
+);
+
+-- Orders Table
+-- One checkout's purchases from one seller; seller_id is NULL for shop
+-- products.
+CREATE TABLE Orders (
+    order_id SERIAL PRIMARY KEY,
+    buyer_id INT NOT NULL,
+    seller_id INT,
+    status VARCHAR(20) NOT NULL DEFAULT 'placed',
+    subtotal DECIMAL(10,2) NOT NULL DEFAULT 0,
+    shipping DECIMAL(10,2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (buyer_id) REFERENCES Users(user_id),
+    FOREIGN KEY (seller_id) REFERENCES Users(user_id)
+);
+CREATE INDEX orders_buyer_idx ON Orders (buyer_id, created_at);
+CREATE INDEX orders_seller_idx ON Orders (seller_id, created_at);
+
+-- OrderItems Table
+-- A listing or shop product in an order. user_item_id is the buyer's copy of
+-- a listed card when it was added to one of their collections.
+CREATE TABLE OrderItems (
+    order_item_id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL,
+    listing_id INT,
+    product_id INT,
+    name VARCHAR(100) NOT NULL,
+    image VARCHAR(255),
+    quantity INT NOT NULL DEFAULT 1,
+    price DECIMAL(10,2) NOT NULL,
+    shipping_option VARCHAR(100),
+    shipping_price DECIMAL(10,2) NOT NULL DEFAULT 0,
+    user_item_id INT,
+    FOREIGN KEY (order_id) REFERENCES Orders(order_id) ON DELETE CASCADE,
+    FOREIGN KEY (listing_id) REFERENCES Listings(listing_id)
+);
+
+-- WantList Table
+-- Cards a user is looking to buy. Empty grade, condition, language or finish
+-- match any market for the card.
+CREATE TABLE WantList (
+    want_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    item_id VARCHAR(50) NOT NULL,
+    grade VARCHAR(50),
+    condition VARCHAR(50),
+    language VARCHAR(50),
+    finish VARCHAR(50),
+    max_price DECIMAL(10,2) NOT NULL,
+    notes TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(user_id),
+    FOREIGN KEY (item_id) REFERENCES Items(item_id)
+);
+CREATE INDEX wantlist_item_idx ON WantList (item_id);
+
+-- PriceAlerts Table
+-- Raised when a refreshed market price falls to or below a want's max price.
+CREATE TABLE PriceAlerts (
+    alert_id SERIAL PRIMARY KEY,
+    want_id INT NOT NULL,
+    user_id INT NOT NULL,
+    item_id VARCHAR(50) NOT NULL,
+    price DECIMAL(10,2) NOT NULL,
+    max_price DECIMAL(10,2) NOT NULL,
+    triggered_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    dismissed_at TIMESTAMP,
+    FOREIGN KEY (want_id) REFERENCES WantList(want_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES Users(user_id)
+);
+CREATE INDEX pricealerts_user_idx ON PriceAlerts (user_id, triggered_at);
+
+-- WebhookDeliveries Table
+-- One row per webhook delivery attempt, retries included.
+CREATE TABLE WebhookDeliveries (
+    attempt_id SERIAL PRIMARY KEY,
+    delivery_id UUID NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    url VARCHAR(255) NOT NULL,
+    attempt INT NOT NULL,
+    status_code INT,
+    error TEXT,
+    succeeded BOOLEAN NOT NULL,
+    attempted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX webhookdeliveries_delivery_idx ON WebhookDeliveries (delivery_id);
+
+-- AuditLog Table
+-- One row per data change, written in the same transaction as the change.
+-- actor_id is whoever made the request (NULL for background jobs and
+-- unauthenticated calls); user_id owns the data that changed. There are no
+-- foreign keys so entries outlive the rows they describe.
+CREATE TABLE AuditLog (
+    audit_id BIGSERIAL PRIMARY KEY,
+    actor_id INT,
+    user_id INT,
+    action VARCHAR(50) NOT NULL,
+    target_type VARCHAR(30) NOT NULL,
+    target_id VARCHAR(100) NOT NULL,
+    collection_id INT,
+    before JSONB,
+    after JSONB,
+    request_id VARCHAR(64),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX auditlog_user_idx ON AuditLog (user_id, created_at);
+CREATE INDEX auditlog_target_idx ON AuditLog (target_type, target_id);
+CREATE INDEX auditlog_request_idx ON AuditLog (request_id);
+
+-- The audit log is append-only.
+CREATE FUNCTION auditlog_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'AuditLog is append-only';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER auditlog_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON AuditLog
+    FOR EACH STATEMENT EXECUTE FUNCTION auditlog_append_only();
+
 -- Products Table
 CREATE TABLE Products (
     product_id SERIAL PRIMARY KEY,
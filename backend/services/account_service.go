@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/audit"
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/notify"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidToken is returned for reset and verification tokens that are
+// unknown, expired or already used.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Purposes of rows in UserTokens.
+const (
+	tokenPasswordReset = "password_reset"
+	tokenVerifyEmail   = "verify_email"
+)
+
+const (
+	passwordResetTTL = time.Hour
+	verifyEmailTTL   = 48 * time.Hour
+)
+
+// maxTokenEmailsPerHour caps how many reset or verification emails can be
+// requested for one address in an hour, so the public endpoints can't be
+// used to flood an inbox.
+const maxTokenEmailsPerHour = 3
+
+// AppURL is the frontend that reset and verification links point to.
+var AppURL = "http://localhost:3000"
+
+// RequireEmailVerification makes Login refuse users who haven't verified
+// their email address.
+var RequireEmailVerification = false
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueUserToken creates a token for purpose, revoking any earlier unused
+// token with the same purpose so only the latest link works.
+func issueUserToken(userID int, purpose string, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE UserTokens SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+	`, userID, purpose)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO UserTokens (user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, purpose, hashToken(token), time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+// tokenEmailsExhausted reports whether the user has been sent as many tokens
+// for purpose in the last hour as maxTokenEmailsPerHour allows.
+func tokenEmailsExhausted(userID int, purpose string) (bool, error) {
+	var sent int
+	err := database.DB.QueryRow(`
+		SELECT COUNT(*) FROM UserTokens
+		WHERE user_id = $1 AND purpose = $2 AND created_at > CURRENT_TIMESTAMP - INTERVAL '1 hour'
+	`, userID, purpose).Scan(&sent)
+	if err != nil {
+		return false, err
+	}
+	return sent >= maxTokenEmailsPerHour, nil
+}
+
+// consumeUserToken marks a live token used and returns its user. Checking and
+// using it in one statement keeps it single-use under concurrent requests.
+func consumeUserToken(tx *sql.Tx, purpose string, token string) (int, error) {
+	var userID int
+	err := tx.QueryRow(`
+		UPDATE UserTokens SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+		RETURNING user_id
+	`, hashToken(token), purpose, time.Now()).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidToken
+	}
+	return userID, err
+}
+
+func appLink(path string, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", AppURL, path, url.QueryEscape(token))
+}
+
+// RequestPasswordReset emails a reset link to the user with this address.
+// Unknown addresses, and addresses sent too many links in the last hour, are
+// ignored so the endpoint doesn't reveal who has an account.
+func RequestPasswordReset(email string) error {
+	var userID int
+	err := database.DB.QueryRow(`SELECT user_id, email FROM Users WHERE LOWER(email) = LOWER($1)`, email).Scan(&userID, &email)
+	if err == sql.ErrNoRows {
+		log.Printf("Password reset requested for unknown email")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	exhausted, err := tokenEmailsExhausted(userID, tokenPasswordReset)
+	if err != nil {
+		return err
+	}
+	if exhausted {
+		log.Printf("Password reset for user %d skipped: too many requests", userID)
+		return nil
+	}
+
+	return sendPasswordReset(userID, email)
+}
+
+// sendPasswordReset issues a reset token and emails the link.
+func sendPasswordReset(userID int, email string) error {
+	token, err := issueUserToken(userID, tokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		log.Printf("Error issuing password reset token for user %d: %v", userID, err)
+		return err
+	}
+
+	link := appLink("/reset-password", token)
+	notifyUserAsync(userID, notify.Message{
+		Event:   notify.EventPasswordReset,
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("A password reset was requested for your account. To choose a new password, open this link within %d minutes:\n\n%s\n\nIf this wasn't you, you can ignore this email.",
+			int(passwordResetTTL.Minutes()), link),
+		Data: map[string]interface{}{"link": link},
+	})
+	log.Printf("Issued password reset token for user %d", userID)
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token, signs the user out
+// everywhere and lifts any lockout.
+func ResetPassword(ctx context.Context, token string, newPassword string) error {
+	if len(newPassword) < MinPasswordLength {
+		return fmt.Errorf("%w: password must be at least %d characters", ErrInvalidProfile, MinPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, tokenPasswordReset, token)
+	if err != nil {
+		return err
+	}
+	// Following the link proves the user controls the address
+	_, err = tx.Exec(`UPDATE Users SET password = $1, email_verified = TRUE WHERE user_id = $2`, string(hash), userID)
+	if err != nil {
+		log.Printf("Error resetting password for user %d: %v", userID, err)
+		return err
+	}
+	if err := revokeAllSessions(tx, userID); err != nil {
+		return err
+	}
+	if err := unlockAccount(tx, userID); err != nil {
+		return err
+	}
+	if err := recordUserChange(ctx, tx, audit.UserPassword, userID, nil, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Reset password for user %d", userID)
+	return nil
+}
+
+// SendVerificationEmail emails a verification link to a user's current
+// address.
+func SendVerificationEmail(userID int) error {
+	var email string
+	var verified bool
+	err := database.DB.QueryRow(`SELECT email, COALESCE(email_verified, FALSE) FROM Users WHERE user_id = $1`, userID).Scan(&email, &verified)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if verified {
+		return nil
+	}
+
+	token, err := issueUserToken(userID, tokenVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		log.Printf("Error issuing verification token for user %d: %v", userID, err)
+		return err
+	}
+
+	link := appLink("/verify-email", token)
+	notifyUserAsync(userID, notify.Message{
+		Event:   notify.EventVerifyEmail,
+		To:      email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Open this link within %d hours to verify your email address:\n\n%s", int(verifyEmailTTL.Hours()), link),
+		Data:    map[string]interface{}{"link": link},
+	})
+	log.Printf("Issued verification token for user %d", userID)
+	return nil
+}
+
+// ResendVerificationEmail sends a new verification link to the user with
+// this address. Like RequestPasswordReset it ignores unknown addresses and
+// addresses sent too many links in the last hour.
+func ResendVerificationEmail(email string) error {
+	var userID int
+	err := database.DB.QueryRow(`SELECT user_id FROM Users WHERE LOWER(email) = LOWER($1)`, email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	exhausted, err := tokenEmailsExhausted(userID, tokenVerifyEmail)
+	if err != nil {
+		return err
+	}
+	if exhausted {
+		log.Printf("Verification email for user %d skipped: too many requests", userID)
+		return nil
+	}
+	return SendVerificationEmail(userID)
+}
+
+// VerifyEmail marks a user's email verified using a verification token.
+func VerifyEmail(token string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, tokenVerifyEmail, token)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE Users SET email_verified = TRUE WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Verified email for user %d", userID)
+	return nil
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/CatsMeow492/PokemonCollection/audit"
+	"github.com/CatsMeow492/PokemonCollection/auth"
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+// ErrRefreshRunning is returned when a market refresh is requested while one
+// is already running.
+var ErrRefreshRunning = errors.New("a market refresh is already running")
+
+// ErrInvalidRole is returned for role names that aren't defined.
+var ErrInvalidRole = errors.New("invalid role")
+
+// MaxUserSearchLimit caps a page of the admin user list.
+const MaxUserSearchLimit = 200
+
+// roleExpr is a user's effective role.
+const roleExpr = `CASE WHEN COALESCE(u.is_admin, FALSE) THEN 'admin' ELSE u.role END`
+
+const adminUserColumns = `u.user_id, u.username, u.email, COALESCE(u.first_name, ''), COALESCE(u.last_name, ''),
+	` + roleExpr + `, COALESCE(u.is_active, TRUE), COALESCE(u.email_verified, FALSE), u.joined, u.last_login,
+	u.failed_logins, u.locked_until`
+
+func scanAdminUser(row rowScanner) (models.AdminUser, error) {
+	var user models.AdminUser
+	var lastLogin, lockedUntil sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName, &user.Role,
+		&user.IsActive, &user.EmailVerified, &user.Joined, &lastLogin, &user.FailedLogins, &lockedUntil)
+	if lastLogin.Valid {
+		user.LastLogin = &lastLogin.Time
+	}
+	if lockedUntil.Valid {
+		user.LockedUntil = &lockedUntil.Time
+	}
+	return user, err
+}
+
+// GetUserRole returns a user's effective role and whether their account is
+// active. Guards look it up on every request so role changes and
+// deactivations apply at once rather than when the access token expires.
+func GetUserRole(userID int) (string, bool, error) {
+	var role string
+	var active bool
+	err := database.DB.QueryRow(`
+		SELECT `+roleExpr+`, COALESCE(u.is_active, TRUE) FROM Users u WHERE u.user_id = $1
+	`, userID).Scan(&role, &active)
+	if err == sql.ErrNoRows {
+		return "", false, ErrUserNotFound
+	}
+	return role, active, err
+}
+
+// SearchUsers lists users matching search, ordered by user ID.
+func SearchUsers(search models.UserSearch) ([]models.AdminUser, error) {
+	if search.Limit <= 0 || search.Limit > MaxUserSearchLimit {
+		search.Limit = MaxUserSearchLimit
+	}
+	if search.Offset < 0 {
+		search.Offset = 0
+	}
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.TrimSpace(search.Query)) + "%"
+
+	rows, err := database.DB.Query(`
+		SELECT `+adminUserColumns+`
+		FROM Users u
+		WHERE (u.username ILIKE $1 OR u.email ILIKE $1 OR COALESCE(u.first_name, '') || ' ' || COALESCE(u.last_name, '') ILIKE $1)
+		AND ($2 = '' OR `+roleExpr+` = $2)
+		AND ($3::BOOLEAN IS NULL OR COALESCE(u.is_active, TRUE) = $3)
+		ORDER BY u.user_id
+		LIMIT $4 OFFSET $5
+	`, pattern, search.Role, search.Active, search.Limit, search.Offset)
+	if err != nil {
+		log.Printf("Error searching users: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.AdminUser{}
+	for rows.Next() {
+		user, err := scanAdminUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func GetAdminUser(userID string) (*models.AdminUser, error) {
+	user, err := scanAdminUser(database.DB.QueryRow(`SELECT `+adminUserColumns+` FROM Users u WHERE u.user_id = $1`, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetUserActive activates or deactivates an account. Deactivating signs the
+// user out everywhere; Login and token refresh refuse inactive accounts.
+func SetUserActive(ctx context.Context, userID string, active bool) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var wasActive bool
+	err = tx.QueryRow(`SELECT COALESCE(is_active, TRUE) FROM Users WHERE user_id = $1 FOR UPDATE`, userID).Scan(&wasActive)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE Users SET is_active = $1 WHERE user_id = $2`, active, userID); err != nil {
+		return err
+	}
+	if !active {
+		if err := revokeAllSessions(tx, userID); err != nil {
+			return err
+		}
+	}
+
+	action := audit.UserActivate
+	if !active {
+		action = audit.UserDeactivate
+	}
+	if err := recordUserChange(ctx, tx, action, userID, &userAuditState{Active: &wasActive}, &userAuditState{Active: &active}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Set user %s active: %t", userID, active)
+	return nil
+}
+
+// SetUserRole changes a user's role. Admin granted through the legacy
+// is_admin flag is cleared so the new role takes effect.
+func SetUserRole(ctx context.Context, userID string, role string) error {
+	if !auth.ValidRole(role) {
+		return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldRole string
+	var wasAdmin bool
+	err = tx.QueryRow(`SELECT role, COALESCE(is_admin, FALSE) FROM Users WHERE user_id = $1 FOR UPDATE`, userID).Scan(&oldRole, &wasAdmin)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// The legacy flag is what granted admin, so that is the role being replaced
+	if wasAdmin {
+		oldRole = auth.RoleAdmin
+	}
+	if _, err := tx.Exec(`UPDATE Users SET role = $1, is_admin = FALSE WHERE user_id = $2`, role, userID); err != nil {
+		return err
+	}
+	if err := recordUserChange(ctx, tx, audit.UserRole, userID, &userAuditState{Role: oldRole}, &userAuditState{Role: role}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Set role of user %s to %s", userID, role)
+	return nil
+}
+
+// ForcePasswordReset replaces a user's password with an unusable one, signs
+// them out everywhere and emails them a reset link.
+func ForcePasswordReset(ctx context.Context, userID string) error {
+	hash, err := unusablePassword()
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	var email string
+	err = tx.QueryRow(`UPDATE Users SET password = $1 WHERE user_id = $2 RETURNING user_id, email`, hash, userID).Scan(&id, &email)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := revokeAllSessions(tx, id); err != nil {
+		return err
+	}
+	if err := recordUserChange(ctx, tx, audit.UserPasswordReset, id, nil, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Forced password reset for user %d", id)
+	return sendPasswordReset(id, email)
+}
+
+var marketRefreshRunning atomic.Bool
+
+// RefreshMarketPrices refreshes the market price of every market anyone owns
+// or wants, in the background. Only prices older than a day are fetched.
+func RefreshMarketPrices() error {
+	if !marketRefreshRunning.CompareAndSwap(false, true) {
+		return ErrRefreshRunning
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT DISTINCT ui.item_id, i.name, COALESCE(i.edition, ''), COALESCE(ui.grade, ''),
+			COALESCE(ui.condition, ''), COALESCE(ui.language, ''), COALESCE(ui.finish, '')
+		FROM UserItems ui
+		JOIN Items i ON ui.item_id = i.item_id
+		JOIN Collections c ON ui.collection_id = c.collection_id
+		WHERE ui.deleted_at IS NULL AND c.deleted_at IS NULL
+	`)
+	if err != nil {
+		marketRefreshRunning.Store(false)
+		return err
+	}
+
+	var queries []MarketPriceQuery
+	for rows.Next() {
+		var query MarketPriceQuery
+		if err := rows.Scan(&query.ID, &query.Name, &query.Edition, &query.Grade, &query.Condition, &query.Language, &query.Finish); err != nil {
+			rows.Close()
+			marketRefreshRunning.Store(false)
+			return err
+		}
+		queries = append(queries, wantMarketQuery(query))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		marketRefreshRunning.Store(false)
+		return err
+	}
+
+	go func() {
+		defer marketRefreshRunning.Store(false)
+		log.Printf("Refreshing market prices for %d owned markets", len(queries))
+		for _, query := range queries {
+			if _, err := FetchAndStoreMarketPrice(query); err != nil {
+				log.Printf("Error refreshing market price for %s: %v", query.ID, err)
+			}
+		}
+		if err := RefreshWantedPrices(); err != nil {
+			log.Printf("Error refreshing wanted prices: %v", err)
+		}
+		log.Printf("Finished market refresh")
+	}()
+	return nil
+}
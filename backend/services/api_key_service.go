@@ -0,0 +1,144 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/CatsMeow492/PokemonCollection/auth"
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+// ErrInvalidAPIKey is wrapped by validation errors for API key requests.
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// MaxAPIKeysPerUser caps how many unrevoked keys a user can hold.
+const MaxAPIKeysPerUser = 20
+
+func GetAPIKeysByUserID(userID string) ([]models.APIKey, error) {
+	rows, err := database.DB.Query(`
+		SELECT key_id, name, scope, key_prefix, created_at, last_used_at, revoked_at
+		FROM ApiKeys
+		WHERE user_id = $1
+		ORDER BY created_at, key_id
+	`, userID)
+	if err != nil {
+		log.Printf("Error querying API keys for user %s: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		if err := rows.Scan(&key.KeyID, &key.Name, &key.Scope, &key.Prefix, &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// CreateAPIKey issues a named key with the given scope. Only a hash of the
+// key is stored, so the returned key can't be shown again.
+func CreateAPIKey(userID string, name string, scope string) (*models.NewAPIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidAPIKey)
+	}
+	if utf8.RuneCountInString(name) > 100 {
+		return nil, fmt.Errorf("%w: name must be at most 100 characters", ErrInvalidAPIKey)
+	}
+	if !auth.ValidScope(scope) {
+		return nil, fmt.Errorf("%w: scope must be %q or %q", ErrInvalidAPIKey, auth.ScopeRead, auth.ScopeWrite)
+	}
+
+	key, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the user so concurrent requests can't slip past the cap
+	var count int
+	err = tx.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM ApiKeys WHERE user_id = u.user_id AND revoked_at IS NULL)
+		FROM Users u WHERE u.user_id = $1
+		FOR UPDATE
+	`, userID).Scan(&count)
+	if err != nil {
+		log.Printf("Error counting API keys for user %s: %v", userID, err)
+		return nil, err
+	}
+	if count >= MaxAPIKeysPerUser {
+		return nil, fmt.Errorf("%w: at most %d active keys are allowed; revoke one first", ErrInvalidAPIKey, MaxAPIKeysPerUser)
+	}
+
+	created := &models.NewAPIKey{Key: key}
+	created.Name, created.Scope, created.Prefix = name, scope, prefix
+	err = tx.QueryRow(`
+		INSERT INTO ApiKeys (user_id, name, scope, key_prefix, key_hash)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING key_id, created_at
+	`, userID, name, scope, prefix, hashToken(key)).Scan(&created.KeyID, &created.CreatedAt)
+	if err != nil {
+		log.Printf("Error creating API key for user %s: %v", userID, err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Created %s API key %d for user %s", scope, created.KeyID, userID)
+	return created, nil
+}
+
+// RevokeAPIKey stops a key working. Revoked keys stay listed so their last
+// use can still be seen.
+func RevokeAPIKey(userID string, keyID int) error {
+	result, err := database.DB.Exec(`
+		UPDATE ApiKeys SET revoked_at = CURRENT_TIMESTAMP
+		WHERE key_id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, keyID, userID)
+	if err != nil {
+		log.Printf("Error revoking API key %d: %v", keyID, err)
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	log.Printf("Revoked API key %d for user %s", keyID, userID)
+	return nil
+}
+
+// AuthenticateAPIKey returns the claims for a live key belonging to an
+// active user, stamping its last use. Anything else is auth.ErrInvalidToken.
+func AuthenticateAPIKey(key string) (*auth.Claims, error) {
+	claims := &auth.Claims{}
+	err := database.DB.QueryRow(`
+		UPDATE ApiKeys k SET last_used_at = CURRENT_TIMESTAMP
+		FROM Users u
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL
+			AND u.user_id = k.user_id AND COALESCE(u.is_active, TRUE)
+		RETURNING u.user_id, u.username, k.scope
+	`, hashToken(key)).Scan(&claims.UserID, &claims.Username, &claims.Scope)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error authenticating API key: %v", err)
+			return nil, err
+		}
+		return nil, auth.ErrInvalidToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/CatsMeow492/PokemonCollection/audit"
+	"github.com/CatsMeow492/PokemonCollection/auth"
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+// MaxAuditSearchLimit caps a page of the admin audit log.
+const MaxAuditSearchLimit = 500
+
+// auditChange is one data change to record. UserID owns the changed data and
+// CollectionID is zero when the change isn't inside a collection. Before and
+// After are marshaled to JSON; nil is stored as NULL.
+type auditChange struct {
+	UserID       interface{}
+	Action       string
+	TargetType   string
+	TargetID     interface{}
+	CollectionID int
+	Before       interface{}
+	After        interface{}
+}
+
+// recordAudit appends change to the audit log inside tx, so the entry is only
+// kept if the change is. The actor and request ID come from ctx.
+func recordAudit(ctx context.Context, tx *sql.Tx, change auditChange) error {
+	before, err := auditJSON(change.Before)
+	if err != nil {
+		return err
+	}
+	after, err := auditJSON(change.After)
+	if err != nil {
+		return err
+	}
+	var actorID, collectionID interface{}
+	if claims := auth.ClaimsFromContext(ctx); claims != nil {
+		actorID = claims.UserID
+	}
+	if change.CollectionID != 0 {
+		collectionID = change.CollectionID
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO AuditLog (actor_id, user_id, action, target_type, target_id, collection_id, before, after, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''))
+	`, actorID, change.UserID, change.Action, change.TargetType, fmt.Sprint(change.TargetID), collectionID,
+		before, after, audit.RequestID(ctx))
+	if err != nil {
+		log.Printf("Error recording audit entry %s %s %v: %v", change.Action, change.TargetType, change.TargetID, err)
+	}
+	return err
+}
+
+func auditJSON(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil || string(data) == "null" {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// SearchAudit lists audit entries matching search, newest first.
+func SearchAudit(search models.AuditSearch) ([]models.AuditEntry, error) {
+	if search.Limit <= 0 || search.Limit > MaxAuditSearchLimit {
+		search.Limit = MaxAuditSearchLimit
+	}
+	if search.Offset < 0 {
+		search.Offset = 0
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT audit_id, actor_id, user_id, action, target_type, target_id, collection_id,
+			before, after, COALESCE(request_id, ''), created_at
+		FROM AuditLog
+		WHERE ($1 = 0 OR user_id = $1)
+		AND ($2 = 0 OR actor_id = $2)
+		AND ($3 = '' OR action = $3)
+		AND ($4 = '' OR target_type = $4)
+		AND ($5 = '' OR target_id = $5)
+		AND ($6 = 0 OR collection_id = $6)
+		AND ($7 = '' OR request_id = $7)
+		AND ($8::TIMESTAMP IS NULL OR created_at >= $8)
+		AND ($9::TIMESTAMP IS NULL OR created_at < $9)
+		ORDER BY audit_id DESC
+		LIMIT $10 OFFSET $11
+	`, search.UserID, search.ActorID, search.Action, search.TargetType, search.TargetID, search.CollectionID,
+		search.RequestID, search.Since, search.Until, search.Limit, search.Offset)
+	if err != nil {
+		log.Printf("Error searching audit log: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		var actorID, userID, collectionID sql.NullInt64
+		var before, after []byte
+		err := rows.Scan(&entry.AuditID, &actorID, &userID, &entry.Action, &entry.TargetType, &entry.TargetID,
+			&collectionID, &before, &after, &entry.RequestID, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.ActorID = nullIntPtr(actorID)
+		entry.UserID = nullIntPtr(userID)
+		entry.CollectionID = nullIntPtr(collectionID)
+		if before != nil {
+			entry.Before = json.RawMessage(before)
+		}
+		if after != nil {
+			entry.After = json.RawMessage(after)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func nullIntPtr(value sql.NullInt64) *int {
+	if !value.Valid {
+		return nil
+	}
+	v := int(value.Int64)
+	return &v
+}
+
+// recordCopyChange records a change to one card or item copy. before is nil
+// for copies being added and after is nil for copies being removed.
+func recordCopyChange(ctx context.Context, tx *sql.Tx, action string, userID interface{}, collectionID int, userItemID int, before, after *models.Card) error {
+	return recordAudit(ctx, tx, auditChange{
+		UserID:       userID,
+		Action:       action,
+		TargetType:   audit.TargetCopy,
+		TargetID:     userItemID,
+		CollectionID: collectionID,
+		Before:       before,
+		After:        after,
+	})
+}
+
+// recordCopyAdded records a copy just inserted in tx, as it was stored.
+func recordCopyAdded(ctx context.Context, tx *sql.Tx, userID interface{}, collectionID int, userItemID int) error {
+	after, err := getCopy(tx, userItemID)
+	if err != nil {
+		return err
+	}
+	return recordCopyChange(ctx, tx, audit.CopyAdd, userID, collectionID, userItemID, nil, after)
+}
+
+// collectionAuditState is how a collection appears in the audit log.
+// UserItemIDs lists the copies that went with it when it was deleted, merged
+// or restored.
+type collectionAuditState struct {
+	CollectionName string `json:"collection_name"`
+	UserItemIDs    []int  `json:"user_item_ids,omitempty"`
+	MergedInto     int    `json:"merged_into,omitempty"`
+	MergePolicy    string `json:"merge_policy,omitempty"`
+	Visibility     string `json:"visibility,omitempty"`
+}
+
+// userAuditState is how an account appears in the audit log.
+type userAuditState struct {
+	Username       string                    `json:"username,omitempty"`
+	FirstName      string                    `json:"first_name,omitempty"`
+	LastName       string                    `json:"last_name,omitempty"`
+	Email          string                    `json:"email,omitempty"`
+	ProfilePicture string                    `json:"profile_picture,omitempty"`
+	Active         *bool                     `json:"active,omitempty"`
+	Role           string                    `json:"role,omitempty"`
+	Preferences    *models.PreferencesUpdate `json:"preferences,omitempty"`
+}
+
+// recordUserChange records a change to a user's account.
+func recordUserChange(ctx context.Context, tx *sql.Tx, action string, userID interface{}, before, after *userAuditState) error {
+	return recordAudit(ctx, tx, auditChange{
+		UserID:     userID,
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+		Before:     before,
+		After:      after,
+	})
+}
+
+// copyLocation is how a transferred copy appears in the audit log.
+type copyLocation struct {
+	UserItemID   int `json:"user_item_id"`
+	CollectionID int `json:"collection_id"`
+}
+
+func recordCollectionChange(ctx context.Context, tx *sql.Tx, action string, userID interface{}, collectionID int, before, after *collectionAuditState) error {
+	return recordAudit(ctx, tx, auditChange{
+		UserID:       userID,
+		Action:       action,
+		TargetType:   audit.TargetCollection,
+		TargetID:     collectionID,
+		CollectionID: collectionID,
+		Before:       before,
+		After:        after,
+	})
+}
+
+// scanIDs reads a single integer column, as returned by UPDATE ... RETURNING.
+func scanIDs(rows *sql.Rows, err error) ([]int, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
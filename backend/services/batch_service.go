@@ -0,0 +1,309 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/CatsMeow492/PokemonCollection/audit"
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+// MaxBatchSize caps the number of rows accepted by one batch request.
+const MaxBatchSize = 500
+
+// batchResolveWorkers bounds the number of concurrent TCG API lookups made
+// while resolving a batch of cards.
+const batchResolveWorkers = 4
+
+var ErrBatchTooLarge = fmt.Errorf("batch exceeds %d rows", MaxBatchSize)
+
+// BatchAddCards resolves each card against the TCG API and adds the ones that
+// resolve to the collection in a single transaction. Rows that fail to resolve
+// or insert are reported in the results without affecting the others.
+func BatchAddCards(ctx context.Context, apiKey string, userID string, collectionID int, cards []models.Card) ([]models.BatchResult, error) {
+	if len(cards) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	results := make([]models.BatchResult, len(cards))
+	resolved := make([]models.Card, len(cards))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, batchResolveWorkers)
+	for i, card := range cards {
+		results[i].Index = i
+
+		if card.Name == "" || card.Set == "" {
+			results[i].Error = "name and set are required"
+			continue
+		}
+		condition, language, finish, err := models.NormalizeRawAttributes(card.Condition, card.Language, card.Finish)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		card.Condition, card.Language, card.Finish = condition, language, finish
+		if card.Quantity <= 0 {
+			card.Quantity = 1
+		}
+
+		wg.Add(1)
+		go func(i int, card models.Card) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			resolvedCard, err := ResolveCard(apiKey, card)
+			if err != nil {
+				results[i].Error = fmt.Sprintf("error fetching card details: %v", err)
+				return
+			}
+			resolved[i] = resolvedCard
+		}(i, card)
+	}
+	wg.Wait()
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockCollection(tx, userID, collectionID); err != nil {
+		log.Printf("Error fetching collection: %v", err)
+		return nil, err
+	}
+
+	for i := range results {
+		if results[i].Error != "" {
+			continue
+		}
+		card := resolved[i]
+		err := batchRow(tx, func() error {
+			userItemID, err := insertCardCopy(tx, collectionID, card)
+			if err != nil {
+				return err
+			}
+			card.UserItemID = userItemID
+			return recordCopyAdded(ctx, tx, userID, collectionID, userItemID)
+		})
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Success = true
+		results[i].UserItemID = card.UserItemID
+		results[i].Card = &card
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Batch added %d cards to collection %d", countSucceeded(results), collectionID)
+	return results, nil
+}
+
+// BatchUpdateCards applies quantity, grade and purchase price changes to
+// copies in the collection in a single transaction.
+func BatchUpdateCards(ctx context.Context, userID string, collectionID int, updates []models.CardUpdate) ([]models.BatchResult, error) {
+	if len(updates) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockCollection(tx, userID, collectionID); err != nil {
+		log.Printf("Error fetching collection: %v", err)
+		return nil, err
+	}
+
+	results := make([]models.BatchResult, len(updates))
+	for i, update := range updates {
+		results[i].Index = i
+
+		if update.Quantity != nil && *update.Quantity <= 0 {
+			results[i].Error = "quantity must be positive"
+			continue
+		}
+		if update.PurchasePrice != nil && *update.PurchasePrice < 0 {
+			results[i].Error = "purchase_price must not be negative"
+			continue
+		}
+
+		var card *models.Card
+		err := batchRow(tx, func() error {
+			userItemID, err := resolveCardRef(tx, userID, collectionID, models.CardRef{CardID: update.CardID, UserItemID: update.UserItemID})
+			if err != nil {
+				return err
+			}
+			before, err := getCopy(tx, userItemID)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`
+				UPDATE UserItems
+				SET quantity = COALESCE($1, quantity),
+					grade = COALESCE($2, grade),
+					purchase_price = COALESCE($3, purchase_price)
+				WHERE user_item_id = $4
+			`, update.Quantity, update.Grade, update.PurchasePrice, userItemID)
+			if err != nil {
+				return err
+			}
+
+			// Keep the copy's buy entry in step so cost basis uses the
+			// corrected price
+			if update.PurchasePrice != nil {
+				_, err = tx.Exec(`
+					UPDATE LedgerEntries SET price = $1
+					WHERE user_item_id = $2 AND entry_type = $3
+				`, *update.PurchasePrice, userItemID, models.LedgerBuy)
+				if err != nil {
+					return err
+				}
+			}
+
+			card, err = getCopy(tx, userItemID)
+			if err != nil {
+				return err
+			}
+			return recordCopyChange(ctx, tx, audit.CopyUpdate, userID, collectionID, userItemID, before, card)
+		})
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Success = true
+		results[i].UserItemID = card.UserItemID
+		results[i].Card = card
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Batch updated %d copies in collection %d", countSucceeded(results), collectionID)
+	return results, nil
+}
+
+// BatchRemoveCards moves the referenced copies to the trash in a single
+// transaction.
+func BatchRemoveCards(ctx context.Context, userID string, collectionID int, refs []models.CardRef) ([]models.BatchResult, error) {
+	if len(refs) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockCollection(tx, userID, collectionID); err != nil {
+		log.Printf("Error fetching collection: %v", err)
+		return nil, err
+	}
+
+	results := make([]models.BatchResult, len(refs))
+	for i, ref := range refs {
+		results[i].Index = i
+		results[i].UserItemID = ref.UserItemID
+
+		if ref.CardID == "" && ref.UserItemID == 0 {
+			results[i].Error = "card_id or user_item_id is required"
+			continue
+		}
+
+		err := batchRow(tx, func() error {
+			copies, err := lockCopies(tx, collectionID, ref.UserItemID, ref.CardID)
+			if err != nil {
+				return err
+			}
+			if len(copies) == 0 {
+				return ErrCardNotFound
+			}
+			for i := range copies {
+				if err := trashCopy(ctx, tx, userID, collectionID, &copies[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Success = true
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Batch removed %d rows from collection %d", countSucceeded(results), collectionID)
+	return results, nil
+}
+
+// batchRow runs one row of a batch inside a savepoint, so a failing row is
+// rolled back without aborting the surrounding transaction.
+func batchRow(tx *sql.Tx, apply func() error) error {
+	if _, err := tx.Exec(`SAVEPOINT batch_row`); err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		if _, rollbackErr := tx.Exec(`ROLLBACK TO SAVEPOINT batch_row`); rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+		return err
+	}
+	_, err := tx.Exec(`RELEASE SAVEPOINT batch_row`)
+	return err
+}
+
+// resolveCardRef finds the copy a batch row refers to. Rows may name the copy
+// by user_item_id alone.
+func resolveCardRef(tx *sql.Tx, userID string, collectionID int, ref models.CardRef) (int, error) {
+	if ref.CardID == "" {
+		if ref.UserItemID == 0 {
+			return 0, ErrCardNotFound
+		}
+		err := tx.QueryRow(`
+			SELECT item_id FROM UserItems
+			WHERE user_item_id = $1 AND collection_id = $2 AND deleted_at IS NULL
+		`, ref.UserItemID, collectionID).Scan(&ref.CardID)
+		if err == sql.ErrNoRows {
+			return 0, ErrCardNotFound
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return resolveCopy(tx, userID, collectionID, ref.CardID, ref.UserItemID)
+}
+
+func countSucceeded(results []models.BatchResult) int {
+	count := 0
+	for _, result := range results {
+		if result.Success {
+			count++
+		}
+	}
+	return count
+}
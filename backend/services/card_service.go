@@ -1,8 +1,10 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -12,6 +14,7 @@ import (
 
 	"net/url"
 
+	"github.com/CatsMeow492/PokemonCollection/audit"
 	"github.com/CatsMeow492/PokemonCollection/database"
 	"github.com/CatsMeow492/PokemonCollection/models"
 	"github.com/patrickmn/go-cache"
@@ -88,15 +91,63 @@ func FetchCard(apiKey, cardIdentifier string) (*models.Card, error) {
 	return card, nil
 }
 
+// ErrCardNotFound is returned when a card or copy is not in the collection.
+var ErrCardNotFound = errors.New("card not found in the collection")
+
+// ErrMultipleCopies is returned when a request names a card by catalog ID but
+// the collection holds several copies of it, so user_item_id is required.
+var ErrMultipleCopies = errors.New("collection holds several copies of this card; specify user_item_id")
+
+// cardColumns is the column list read by scanCard. Queries using it must alias
+// UserItems as ui and Items as i.
+const cardColumns = `ui.user_item_id, i.item_id, i.name, COALESCE(i.edition, ''), COALESCE(i.set, ''), COALESCE(i.image, ''),
+	COALESCE(i.type, ''), ui.grade, COALESCE(ui.purchase_price, 0), ui.quantity,
+	COALESCE(ui.condition, ''), COALESCE(ui.language, ''), COALESCE(ui.finish, ''), ui.acquired_at, COALESCE(ui.notes, '')`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanCard reads a row selected with cardColumns. Columns selected after
+// cardColumns are scanned into extra.
+func scanCard(row rowScanner, extra ...interface{}) (models.Card, error) {
+	var card models.Card
+	var acquiredAt sql.NullTime
+	dest := []interface{}{&card.UserItemID, &card.ID, &card.Name, &card.Edition, &card.Set, &card.Image,
+		&card.Type, &card.Grade, &card.PurchasePrice, &card.Quantity,
+		&card.Condition, &card.Language, &card.Finish, &acquiredAt, &card.Notes}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return card, err
+	}
+	if acquiredAt.Valid {
+		card.AcquiredAt = &acquiredAt.Time
+	}
+	return card, nil
+}
+
 func GetCardsByUserIDAndCollectionName(userID string, collectionName string) ([]models.Card, error) {
+	collectionID, err := GetCollectionID(userID, collectionName)
+	if errors.Is(err, ErrCollectionNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetCardsByCollectionID(userID, collectionID)
+}
+
+func GetCardsByCollectionID(userID string, collectionID int) ([]models.Card, error) {
 	query := `
-		SELECT i.item_id, i.name, i.edition, i.set, i.image, i.type, ui.grade, ui.purchase_price, ui.quantity
+		SELECT ` + cardColumns + `
 		FROM UserItems ui
 		JOIN Items i ON ui.item_id = i.item_id
 		JOIN Collections c ON ui.collection_id = c.collection_id
-		WHERE c.user_id = $1 AND c.collection_name = $2
+		WHERE c.user_id = $1 AND c.collection_id = $2
+		AND c.deleted_at IS NULL AND ui.deleted_at IS NULL
+		ORDER BY i.item_id, ui.user_item_id
 	`
-	rows, err := database.DB.Query(query, userID, collectionName)
+	rows, err := database.DB.Query(query, userID, collectionID)
 	if err != nil {
 		return nil, err
 	}
@@ -104,18 +155,89 @@ func GetCardsByUserIDAndCollectionName(userID string, collectionName string) ([]
 
 	var cards []models.Card
 	for rows.Next() {
-		var card models.Card
-		err := rows.Scan(&card.ID, &card.Name, &card.Edition, &card.Set, &card.Image, &card.Type, &card.Grade, &card.PurchasePrice, &card.Quantity)
+		card, err := scanCard(rows)
 		if err != nil {
 			return nil, err
 		}
 		cards = append(cards, card)
 	}
-	return cards, nil
+	return cards, rows.Err()
 }
 
-func UpdateCardQuantity(userID string, collectionName string, cardID string, quantity int) (*models.Card, error) {
-	log.Printf("UpdateCardQuantity called with userID: %s, collectionName: %s, cardID: %s, quantity: %d", userID, collectionName, cardID, quantity)
+// SummarizeCards groups copies by catalog card, preserving first-seen order.
+func SummarizeCards(cards []models.Card) []models.CardSummary {
+	summaries := []models.CardSummary{}
+	index := make(map[string]int)
+	for _, card := range cards {
+		i, ok := index[card.ID]
+		if !ok {
+			i = len(summaries)
+			index[card.ID] = i
+			summaries = append(summaries, models.CardSummary{
+				ID:      card.ID,
+				Name:    card.Name,
+				Edition: card.Edition,
+				Set:     card.Set,
+				Image:   card.Image,
+				Copies:  []models.Card{},
+			})
+		}
+		summaries[i].TotalQuantity += card.Quantity
+		summaries[i].TotalCost += card.PurchasePrice * float64(card.Quantity)
+		summaries[i].Copies = append(summaries[i].Copies, card)
+	}
+	return summaries
+}
+
+// resolveCopy finds the UserItems row a card-level request refers to. A
+// userItemID of 0 is only accepted while the collection holds a single copy.
+func resolveCopy(tx *sql.Tx, userID string, collectionID int, cardID string, userItemID int) (int, error) {
+	rows, err := tx.Query(`
+		SELECT ui.user_item_id
+		FROM UserItems ui
+		JOIN Collections c ON ui.collection_id = c.collection_id
+		WHERE c.user_id = $1 AND c.collection_id = $2 AND ui.item_id = $3
+		AND c.deleted_at IS NULL AND ui.deleted_at IS NULL
+	`, userID, collectionID, cardID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		if userItemID != 0 && id == userItemID {
+			return id, nil
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case userItemID != 0 || len(ids) == 0:
+		return 0, ErrCardNotFound
+	case len(ids) > 1:
+		return 0, ErrMultipleCopies
+	}
+	return ids[0], nil
+}
+
+func UpdateCardQuantity(ctx context.Context, userID string, collectionName string, cardID string, userItemID int, quantity int) (*models.Card, error) {
+	collectionID, err := GetCollectionID(userID, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	return UpdateCardQuantityByCollectionID(ctx, userID, collectionID, cardID, userItemID, quantity)
+}
+
+func UpdateCardQuantityByCollectionID(ctx context.Context, userID string, collectionID int, cardID string, userItemID int, quantity int) (*models.Card, error) {
+	log.Printf("UpdateCardQuantity called with userID: %s, collectionID: %d, cardID: %s, userItemID: %d, quantity: %d", userID, collectionID, cardID, userItemID, quantity)
 
 	tx, err := database.DB.Begin()
 	if err != nil {
@@ -124,43 +246,32 @@ func UpdateCardQuantity(userID string, collectionName string, cardID string, qua
 	}
 	defer tx.Rollback()
 
-	// Update the quantity
-	result, err := tx.Exec(`
-		UPDATE UserItems
-		SET quantity = $1
-		WHERE collection_id = (SELECT collection_id FROM Collections WHERE user_id = $2 AND collection_name = $3)
-		AND item_id = $4
-	`, quantity, userID, collectionName, cardID)
+	userItemID, err = resolveCopy(tx, userID, collectionID, cardID, userItemID)
 	if err != nil {
-		log.Printf("Error updating quantity: %v", err)
+		log.Printf("Error resolving card copy: %v", err)
 		return nil, err
 	}
-
-	rowsAffected, err := result.RowsAffected()
+	before, err := getCopy(tx, userItemID)
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
 		return nil, err
 	}
-	log.Printf("Rows affected by update: %d", rowsAffected)
 
-	if rowsAffected == 0 {
-		log.Printf("No rows were updated. Card might not exist in the collection.")
-		return nil, fmt.Errorf("card not found in the collection")
+	// Update the quantity
+	_, err = tx.Exec(`UPDATE UserItems SET quantity = $1 WHERE user_item_id = $2`, quantity, userItemID)
+	if err != nil {
+		log.Printf("Error updating quantity: %v", err)
+		return nil, err
 	}
 
 	// Fetch the updated card
-	var card models.Card
-	err = tx.QueryRow(`
-		SELECT i.item_id, i.name, i.edition, i.set, i.image, ui.grade, ui.purchase_price, ui.quantity
-		FROM UserItems ui
-		JOIN Items i ON ui.item_id = i.item_id
-		JOIN Collections c ON ui.collection_id = c.collection_id
-		WHERE c.user_id = $1 AND c.collection_name = $2 AND i.item_id = $3
-	`, userID, collectionName, cardID).Scan(&card.ID, &card.Name, &card.Edition, &card.Set, &card.Image, &card.Grade, &card.PurchasePrice, &card.Quantity)
+	card, err := getCopy(tx, userItemID)
 	if err != nil {
 		log.Printf("Error fetching updated card: %v", err)
 		return nil, err
 	}
+	if err := recordCopyChange(ctx, tx, audit.CopyUpdate, userID, collectionID, userItemID, before, card); err != nil {
+		return nil, err
+	}
 
 	err = tx.Commit()
 	if err != nil {
@@ -169,21 +280,107 @@ func UpdateCardQuantity(userID string, collectionName string, cardID string, qua
 	}
 
 	log.Printf("Successfully updated card: %+v", card)
+	return card, nil
+}
+
+func UpdateCardAttributes(ctx context.Context, userID string, collectionName string, cardID string, userItemID int, attributes models.Card) (*models.Card, error) {
+	collectionID, err := GetCollectionID(userID, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	return UpdateCardAttributesByCollectionID(ctx, userID, collectionID, cardID, userItemID, attributes)
+}
+
+// UpdateCardAttributesByCollectionID replaces the grade, condition, language,
+// finish, acquisition date and notes recorded for one copy of a card.
+func UpdateCardAttributesByCollectionID(ctx context.Context, userID string, collectionID int, cardID string, userItemID int, attributes models.Card) (*models.Card, error) {
+	condition, language, finish, err := models.NormalizeRawAttributes(attributes.Condition, attributes.Language, attributes.Finish)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	userItemID, err = resolveCopy(tx, userID, collectionID, cardID, userItemID)
+	if err != nil {
+		log.Printf("Error resolving card copy: %v", err)
+		return nil, err
+	}
+	before, err := getCopy(tx, userItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE UserItems
+		SET grade = $1, condition = NULLIF($2, ''), language = $3, finish = NULLIF($4, ''),
+			acquired_at = COALESCE($5, acquired_at), notes = $6
+		WHERE user_item_id = $7
+	`, attributes.Grade, condition, language, finish, attributes.AcquiredAt, attributes.Notes, userItemID)
+	if err != nil {
+		log.Printf("Error updating card attributes: %v", err)
+		return nil, err
+	}
+
+	card, err := getCopy(tx, userItemID)
+	if err != nil {
+		log.Printf("Error fetching updated card: %v", err)
+		return nil, err
+	}
+	if err := recordCopyChange(ctx, tx, audit.CopyUpdate, userID, collectionID, userItemID, before, card); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Successfully updated card attributes: %+v", card)
+	return card, nil
+}
+
+func getCopy(tx *sql.Tx, userItemID int) (*models.Card, error) {
+	card, err := scanCard(tx.QueryRow(`
+		SELECT `+cardColumns+`
+		FROM UserItems ui
+		JOIN Items i ON ui.item_id = i.item_id
+		WHERE ui.user_item_id = $1
+	`, userItemID))
+	if err != nil {
+		return nil, err
+	}
 	return &card, nil
 }
 
 func GetCollectionByUserIDandCollectionName(userID string, collectionName string) (*models.Collection, error) {
+	collectionID, err := GetCollectionID(userID, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	return GetCollectionByID(userID, collectionID)
+}
+
+func GetCollectionByID(userID string, collectionID int) (*models.Collection, error) {
 	collection := &models.Collection{}
 	err := database.DB.QueryRow(`
-		SELECT collection_id, collection_name
+		SELECT collection_id, collection_name, visibility, COALESCE(share_slug, '')
 		FROM Collections
-		WHERE user_id = $1 AND collection_name = $2
-	`, userID, collectionName).Scan(&collection.CollectionID, &collection.CollectionName)
+		WHERE user_id = $1 AND collection_id = $2 AND deleted_at IS NULL
+	`, userID, collectionID).Scan(&collection.CollectionID, &collection.CollectionName, &collection.Visibility, &collection.ShareSlug)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %d", ErrCollectionNotFound, collectionID)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	cards, err := GetCardsByUserIDAndCollectionName(userID, collectionName)
+	cards, err := GetCardsByCollectionID(userID, collectionID)
 	if err != nil {
 		return nil, err
 	}
@@ -274,31 +471,105 @@ func FetchCardFromAPI(apiKey string, cardIdentifier string) (*models.Card, error
 	return card, nil
 }
 
-func AddCardToCollection(userID string, collectionName string, card models.Card) error {
+// ResolveCard looks a user-supplied card up in the TCG API by set and name and
+// returns it with the catalog ID and image filled in, keeping the user's own
+// grade, price and copy details.
+func ResolveCard(apiKey string, card models.Card) (models.Card, error) {
+	identifier := fmt.Sprintf("%s-%s", card.Set, card.Name)
+
+	// Lookups are cached by identifier so batches naming the same card only
+	// hit the API once
+	var fetchedCard *models.Card
+	if cached, found := cardCache.Get("lookup:" + identifier); found {
+		fetchedCard = cached.(*models.Card)
+	} else {
+		var err error
+		fetchedCard, err = FetchCardFromAPI(apiKey, identifier)
+		if err != nil {
+			return models.Card{}, err
+		}
+		cardCache.Set("lookup:"+identifier, fetchedCard, cache.DefaultExpiration)
+	}
+
+	card.ID = fetchedCard.ID
+	card.Image = fetchedCard.Image
+	card.Type = "Pokemon Card"
+	return card, nil
+}
+
+func AddCardToCollection(ctx context.Context, userID string, collectionName string, card models.Card) (int, error) {
+	collectionID, err := GetCollectionID(userID, collectionName)
+	if err != nil {
+		log.Printf("Error fetching collection: %v", err)
+		return 0, err
+	}
+	return AddCardToCollectionByID(ctx, userID, collectionID, card)
+}
+
+// AddCardToCollectionByID records a newly acquired copy (or lot) of a card as
+// its own UserItems row and returns the row's user_item_id. Earlier copies of
+// the same card are left untouched.
+func AddCardToCollectionByID(ctx context.Context, userID string, collectionID int, card models.Card) (int, error) {
+	condition, language, finish, err := models.NormalizeRawAttributes(card.Condition, card.Language, card.Finish)
+	if err != nil {
+		return 0, err
+	}
+	card.Condition, card.Language, card.Finish = condition, language, finish
+	if card.Quantity <= 0 {
+		card.Quantity = 1
+	}
+
 	tx, err := database.DB.Begin()
 	if err != nil {
 		log.Printf("Error beginning transaction: %v", err)
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 
-	// Get the collection ID
-	var collectionID int
-	err = tx.QueryRow(`
-		SELECT collection_id FROM Collections 
-		WHERE user_id = $1 AND collection_name = $2
-	`, userID, collectionName).Scan(&collectionID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Printf("Collection not found: %s", collectionName)
-			return fmt.Errorf("collection not found: %s", collectionName)
-		}
+	if err := lockCollection(tx, userID, collectionID); err != nil {
 		log.Printf("Error fetching collection: %v", err)
-		return err
+		return 0, err
 	}
 
+	userItemID, err := insertCardCopy(tx, collectionID, card)
+	if err != nil {
+		return 0, err
+	}
+	if err := recordCopyAdded(ctx, tx, userID, collectionID, userItemID); err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return 0, err
+	}
+
+	log.Printf("Added copy %d of card %s to collection %d at %.2f", userItemID, card.ID, collectionID, card.PurchasePrice)
+	return userItemID, nil
+}
+
+// insertCardCopy upserts the catalog item and records a new UserItems row for
+// it, with a matching buy entry in the ledger. The caller owns the transaction
+// and has already normalized the card's attributes.
+func insertCardCopy(tx *sql.Tx, collectionID int, card models.Card) (int, error) {
+	userItemID, err := insertCopy(tx, collectionID, card)
+	if err != nil {
+		return 0, err
+	}
+
+	err = recordAcquisition(tx, collectionID, userItemID, card.ID, models.LedgerBuy, card.Quantity, card.PurchasePrice, card.AcquiredAt, "")
+	if err != nil {
+		return 0, err
+	}
+	return userItemID, nil
+}
+
+// insertCopy upserts the catalog item and inserts its UserItems row without
+// touching the ledger.
+func insertCopy(tx *sql.Tx, collectionID int, card models.Card) (int, error) {
 	// Insert or update the Items table
-	_, err = tx.Exec(`
+	_, err := tx.Exec(`
 		INSERT INTO Items (item_id, name, edition, set, image, type, grade)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		ON CONFLICT (item_id) DO UPDATE SET
@@ -311,50 +582,152 @@ func AddCardToCollection(userID string, collectionName string, card models.Card)
 	`, card.ID, card.Name, card.Edition, card.Set, card.Image, card.Type, card.Grade)
 	if err != nil {
 		log.Printf("Error inserting/updating item: %v", err)
+		return 0, err
+	}
+	return insertUserItem(tx, collectionID, card)
+}
+
+// insertMissingCopy inserts a copy whose catalog item is only added if it is
+// missing, so cards from uploaded files can't rewrite the shared catalog.
+func insertMissingCopy(tx *sql.Tx, collectionID int, card models.Card) (int, error) {
+	_, err := tx.Exec(`
+		INSERT INTO Items (item_id, name, edition, set, image, type, grade)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (item_id) DO NOTHING
+	`, card.ID, card.Name, card.Edition, card.Set, card.Image, card.Type, card.Grade)
+	if err != nil {
+		log.Printf("Error inserting item: %v", err)
+		return 0, err
+	}
+	return insertUserItem(tx, collectionID, card)
+}
+
+// insertUserItem inserts the UserItems row for a copy. Every acquisition gets
+// its own row.
+func insertUserItem(tx *sql.Tx, collectionID int, card models.Card) (int, error) {
+	var userItemID int
+	err := tx.QueryRow(`
+		INSERT INTO UserItems (collection_id, item_id, grade, purchase_price, quantity, condition, language, finish, acquired_at, notes)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, NULLIF($8, ''), COALESCE($9, CURRENT_TIMESTAMP), NULLIF($10, ''))
+		RETURNING user_item_id
+	`, collectionID, card.ID, card.Grade, card.PurchasePrice, card.Quantity, card.Condition, card.Language, card.Finish,
+		card.AcquiredAt, card.Notes).Scan(&userItemID)
+	if err != nil {
+		log.Printf("Error inserting user item: %v", err)
+		return 0, err
+	}
+	return userItemID, nil
+}
+
+func RemoveCardFromCollection(ctx context.Context, userID string, collectionName string, cardID string) error {
+	collectionID, err := GetCollectionID(userID, collectionName)
+	if errors.Is(err, ErrCollectionNotFound) {
+		return nil
+	}
+	if err != nil {
 		return err
 	}
+	return RemoveCardFromCollectionByID(ctx, userID, collectionID, cardID)
+}
 
-	// Insert or update the UserItems table (with purchase_price)
-	result, err := tx.Exec(`
-		INSERT INTO UserItems (collection_id, item_id, grade, purchase_price, quantity)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT (collection_id, item_id) DO UPDATE SET
-			grade = EXCLUDED.grade,
-			purchase_price = EXCLUDED.purchase_price,
-			quantity = UserItems.quantity + EXCLUDED.quantity
-	`, collectionID, card.ID, card.Grade, card.PurchasePrice, card.Quantity)
+// RemoveCardFromCollectionByID moves every copy of a card in a collection to
+// the trash.
+func RemoveCardFromCollectionByID(ctx context.Context, userID string, collectionID int, cardID string) error {
+	tx, err := database.DB.Begin()
 	if err != nil {
-		log.Printf("Error inserting/updating user item: %v", err)
 		return err
 	}
-	rowsAffected, _ := result.RowsAffected()
-	log.Printf("Rows affected in UserItems: %d", rowsAffected)
+	defer tx.Rollback()
 
-	err = tx.Commit()
+	if err := lockCollection(tx, userID, collectionID); err != nil {
+		if errors.Is(err, ErrCollectionNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	removed, err := lockCopies(tx, collectionID, 0, cardID)
 	if err != nil {
-		log.Printf("Error committing transaction: %v", err)
 		return err
 	}
+	for i := range removed {
+		if err := trashCopy(ctx, tx, userID, collectionID, &removed[i]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
 
-	// After tx.Commit()
-	var storedPrice float64
-	err = database.DB.QueryRow("SELECT purchase_price FROM UserItems WHERE collection_id = $1 AND item_id = $2", collectionID, card.ID).Scan(&storedPrice)
+// lockCopies locks and returns the live copies in a collection matching a
+// user_item_id, a card ID or both; zero values match anything.
+func lockCopies(tx *sql.Tx, collectionID int, userItemID int, cardID string) ([]models.Card, error) {
+	rows, err := tx.Query(`
+		SELECT `+cardColumns+`
+		FROM UserItems ui
+		JOIN Items i ON ui.item_id = i.item_id
+		WHERE ui.collection_id = $1 AND ui.deleted_at IS NULL
+		AND ($2 = 0 OR ui.user_item_id = $2)
+		AND ($3 = '' OR ui.item_id = $3)
+		FOR UPDATE OF ui
+	`, collectionID, userItemID, cardID)
 	if err != nil {
-		log.Printf("Error fetching stored price: %v", err)
-	} else {
-		log.Printf("Stored price for card %s in collection %d: %.2f", card.ID, collectionID, storedPrice)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cards []models.Card
+	for rows.Next() {
+		card, err := scanCard(rows)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+	return cards, rows.Err()
+}
+
+// RemoveCardCopy moves a single owned copy to the trash, leaving other copies
+// of the same card in place.
+func RemoveCardCopy(ctx context.Context, userID string, userItemID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	var collectionID int
+	card, err := scanCard(tx.QueryRow(`
+		SELECT `+cardColumns+`, c.collection_id
+		FROM UserItems ui
+		JOIN Items i ON ui.item_id = i.item_id
+		JOIN Collections c ON ui.collection_id = c.collection_id
+		WHERE ui.user_item_id = $1 AND ui.deleted_at IS NULL
+		AND c.user_id = $2 AND c.deleted_at IS NULL
+		FOR UPDATE OF ui
+	`, userItemID, userID), &collectionID)
+	if err == sql.ErrNoRows {
+		return ErrCardNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := trashCopy(ctx, tx, userID, collectionID, &card); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func RemoveCardFromCollection(userID string, collectionName string, cardID string) error {
-	_, err := database.DB.Exec(`
-		DELETE FROM UserItems
-		WHERE collection_id = (SELECT collection_id FROM Collections WHERE user_id = $1 AND collection_name = $2)
-		AND item_id = $3
-	`, userID, collectionName, cardID)
-	return err
+// trashCopy moves a copy to the trash, closing its lots, and records its
+// last state.
+func trashCopy(ctx context.Context, tx *sql.Tx, userID string, collectionID int, card *models.Card) error {
+	if err := closeCopyLots(tx, userID, card); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE UserItems SET deleted_at = CURRENT_TIMESTAMP WHERE user_item_id = $1`, card.UserItemID); err != nil {
+		return err
+	}
+	return recordCopyChange(ctx, tx, audit.CopyRemove, userID, collectionID, card.UserItemID, card, nil)
 }
 
 func DebugPrintCardPrices(userID string, collectionName string) {
@@ -364,6 +737,7 @@ func DebugPrintCardPrices(userID string, collectionName string) {
 		JOIN Items i ON ui.item_id = i.item_id
 		JOIN Collections c ON ui.collection_id = c.collection_id
 		WHERE c.user_id = $1 AND c.collection_name = $2
+		AND c.deleted_at IS NULL AND ui.deleted_at IS NULL
 	`
 	rows, err := database.DB.Query(query, userID, collectionName)
 	if err != nil {
@@ -390,7 +764,7 @@ func DebugPrintUserItemPrices(userID string) {
 		FROM UserItems ui
 		JOIN Items i ON ui.item_id = i.item_id
 		JOIN Collections c ON ui.collection_id = c.collection_id
-		WHERE c.user_id = $1
+		WHERE c.user_id = $1 AND c.deleted_at IS NULL AND ui.deleted_at IS NULL
 	`
 	rows, err := database.DB.Query(query, userID)
 	if err != nil {
@@ -417,6 +791,7 @@ func GetUserItemPrice(userID, collectionName, itemID string) (float64, error) {
 		FROM UserItems ui
 		JOIN Collections c ON ui.collection_id = c.collection_id
 		WHERE c.user_id = $1 AND c.collection_name = $2 AND ui.item_id = $3
+		AND c.deleted_at IS NULL AND ui.deleted_at IS NULL
 	`
 	var price float64
 	err := database.DB.QueryRow(query, userID, collectionName, itemID).Scan(&price)
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/patrickmn/go-cache"
+)
+
+// catalogCard is the subset of a Pokemon TCG API card used for catalog
+// searches.
+type catalogCard struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Number string `json:"number"`
+	Set    struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"set"`
+	Images struct {
+		Small string `json:"small"`
+		Large string `json:"large"`
+	} `json:"images"`
+	TCGPlayer struct {
+		Prices map[string]json.RawMessage `json:"prices"`
+	} `json:"tcgplayer"`
+}
+
+func (c catalogCard) toCard() models.Card {
+	return models.Card{
+		ID:      c.ID,
+		Name:    c.Name,
+		Edition: c.Set.Name,
+		Set:     c.Set.ID,
+		Image:   c.Images.Large,
+		Type:    "Pokemon Card",
+	}
+}
+
+// SearchCatalog returns every catalog card with the given name in a set,
+// matched by set ID, set name or PTCGO set code. A non-empty number (either "4" or "4/102")
+// narrows the search to that collector number. Results are cached.
+func SearchCatalog(apiKey string, set string, name string, number string) ([]models.Card, error) {
+	number = strings.TrimSpace(strings.SplitN(number, "/", 2)[0])
+	number = strings.TrimLeft(number, "0")
+
+	cacheKey := fmt.Sprintf("search:%s|%s|%s", strings.ToLower(set), strings.ToLower(name), number)
+	if cached, found := cardCache.Get(cacheKey); found {
+		return cached.([]models.Card), nil
+	}
+
+	setTerm := quoteQueryTerm(set)
+	query := fmt.Sprintf(`(set.id:"%s" OR set.name:"%s" OR set.ptcgoCode:"%s") name:"%s"`, setTerm, setTerm, setTerm, quoteQueryTerm(name))
+	if number != "" {
+		query += fmt.Sprintf(` number:"%s"`, quoteQueryTerm(number))
+	}
+	apiURL := "https://api.pokemontcg.io/v2/cards?q=" + url.QueryEscape(query)
+	log.Printf("SearchCatalog: API URL: %s", apiURL)
+
+	req, _ := http.NewRequest("GET", apiURL, nil)
+	req.Header.Set("X-Api-Key", apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("SearchCatalog: Error making request: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Printf("SearchCatalog: Received non-200 response code: %d, Body: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("received non-200 response code: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data []catalogCard `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	// The API matches names loosely ("Pikachu" also finds "Pikachu V"), so
+	// prefer exact name matches when there are any
+	var exact, loose []models.Card
+	for _, c := range result.Data {
+		if strings.EqualFold(c.Name, name) {
+			exact = append(exact, c.toCard())
+		} else {
+			loose = append(loose, c.toCard())
+		}
+	}
+	candidates := exact
+	if len(candidates) == 0 {
+		candidates = loose
+	}
+
+	cardCache.Set(cacheKey, candidates, cache.DefaultExpiration)
+	return candidates, nil
+}
+
+// quoteQueryTerm strips characters that would break out of a quoted term in
+// the TCG API query syntax.
+func quoteQueryTerm(term string) string {
+	return strings.NewReplacer(`"`, "", `\`, "").Replace(strings.TrimSpace(term))
+}
+
+// ErrNotInCatalog is returned when the TCG API has no card with an ID.
+var ErrNotInCatalog = errors.New("card not found in catalog")
+
+// FetchCatalogCard looks a card up in the TCG API by its catalog ID. Results
+// are cached.
+func FetchCatalogCard(apiKey string, cardID string) (models.Card, error) {
+	cacheKey := "catalog:" + cardID
+	if cached, found := cardCache.Get(cacheKey); found {
+		return cached.(models.Card), nil
+	}
+
+	apiURL := "https://api.pokemontcg.io/v2/cards/" + url.PathEscape(cardID)
+	req, _ := http.NewRequest("GET", apiURL, nil)
+	req.Header.Set("X-Api-Key", apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("FetchCatalogCard: Error making request: %v", err)
+		return models.Card{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return models.Card{}, ErrNotInCatalog
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Printf("FetchCatalogCard: Received non-200 response code: %d, Body: %s", resp.StatusCode, string(body))
+		return models.Card{}, fmt.Errorf("received non-200 response code: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data catalogCard `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return models.Card{}, err
+	}
+
+	card := result.Data.toCard()
+	cardCache.Set(cacheKey, card, cache.DefaultExpiration)
+	return card, nil
+}
@@ -1,38 +1,172 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/CatsMeow492/PokemonCollection/audit"
 	"github.com/CatsMeow492/PokemonCollection/database"
 	"github.com/CatsMeow492/PokemonCollection/models"
 )
 
-func CreateCollection(userID string, collectionName string) error {
-	_, err := database.DB.Exec(`
+// ErrCollectionExists is returned when a collection name is already taken by
+// another of the user's live collections.
+var ErrCollectionExists = errors.New("a collection with that name already exists")
+
+// ErrCollectionNotFound is returned when a user has no live collection by the
+// given name or ID.
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// ErrInvalidTransfer is wrapped by validation errors for transfers and merges.
+var ErrInvalidTransfer = errors.New("invalid transfer")
+
+// GetCollectionID resolves a live collection name to its collection_id. The
+// name-based API routes use it before delegating to the ID-based services.
+func GetCollectionID(userID string, collectionName string) (int, error) {
+	var collectionID int
+	err := database.DB.QueryRow(`
+		SELECT collection_id FROM Collections
+		WHERE user_id = $1 AND collection_name = $2 AND deleted_at IS NULL
+	`, userID, collectionName).Scan(&collectionID)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: %s", ErrCollectionNotFound, collectionName)
+	}
+	return collectionID, err
+}
+
+// lockCollection checks that a live collection belongs to the user and locks
+// it for the rest of the transaction.
+func lockCollection(tx *sql.Tx, userID string, collectionID int) error {
+	var id int
+	err := tx.QueryRow(`
+		SELECT collection_id FROM Collections
+		WHERE collection_id = $1 AND user_id = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`, collectionID, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %d", ErrCollectionNotFound, collectionID)
+	}
+	return err
+}
+
+// lockCollectionByName is lockCollection for the name-based routes. It
+// returns the locked collection's ID.
+func lockCollectionByName(tx *sql.Tx, userID string, collectionName string) (int, error) {
+	var collectionID int
+	err := tx.QueryRow(`
+		SELECT collection_id FROM Collections
+		WHERE user_id = $1 AND collection_name = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`, userID, collectionName).Scan(&collectionID)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: %s", ErrCollectionNotFound, collectionName)
+	}
+	return collectionID, err
+}
+
+// CreateCollection creates a collection and returns its ID. Creating a name
+// the user already has is not an error; the existing collection's ID is
+// returned.
+func CreateCollection(ctx context.Context, userID string, collectionName string) (int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var collectionID int
+	err = tx.QueryRow(`
 		INSERT INTO Collections (user_id, collection_name)
 		VALUES ($1, $2)
-		ON CONFLICT (user_id, collection_name) DO NOTHING
-	`, userID, collectionName)
-	return err
+		ON CONFLICT (user_id, collection_name) WHERE deleted_at IS NULL DO NOTHING
+		RETURNING collection_id
+	`, userID, collectionName).Scan(&collectionID)
+	if err == sql.ErrNoRows {
+		return GetCollectionID(userID, collectionName)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	err = recordCollectionChange(ctx, tx, audit.CollectionCreate, userID, collectionID, nil, &collectionAuditState{CollectionName: collectionName})
+	if err != nil {
+		return 0, err
+	}
+	return collectionID, tx.Commit()
 }
 
-func DeleteCollection(userID string, collectionName string) error {
-	_, err := database.DB.Exec(`
-		DELETE FROM Collections
-		WHERE user_id = $1 AND collection_name = $2
-	`, userID, collectionName)
-	return err
+func DeleteCollection(ctx context.Context, userID string, collectionName string) error {
+	collectionID, err := GetCollectionID(userID, collectionName)
+	if errors.Is(err, ErrCollectionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return DeleteCollectionByID(ctx, userID, collectionID)
+}
+
+// DeleteCollectionByID moves a collection and the copies it holds to the trash.
+// Both get the same deleted_at so restoring the collection brings back exactly
+// the copies that were deleted with it.
+func DeleteCollectionByID(ctx context.Context, userID string, collectionID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var collectionName string
+	var deletedAt time.Time
+	err = tx.QueryRow(`
+		UPDATE Collections SET deleted_at = CURRENT_TIMESTAMP
+		WHERE collection_id = $1 AND user_id = $2 AND deleted_at IS NULL
+		RETURNING collection_name, deleted_at
+	`, collectionID, userID).Scan(&collectionName, &deletedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %d", ErrCollectionNotFound, collectionID)
+	}
+	if err != nil {
+		return err
+	}
+
+	deletedCopies, err := scanIDs(tx.Query(`
+		UPDATE UserItems SET deleted_at = $1
+		WHERE collection_id = $2 AND deleted_at IS NULL
+		RETURNING user_item_id
+	`, deletedAt, collectionID))
+	if err != nil {
+		return err
+	}
+	for _, userItemID := range deletedCopies {
+		card, err := getCopy(tx, userItemID)
+		if err != nil {
+			return err
+		}
+		if err := closeCopyLots(tx, userID, card); err != nil {
+			return err
+		}
+	}
+
+	before := &collectionAuditState{CollectionName: collectionName, UserItemIDs: deletedCopies}
+	if err := recordCollectionChange(ctx, tx, audit.CollectionDelete, userID, collectionID, before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func GetCollectionsByUserID(userID string) ([]models.Collection, error) {
 	collections := []models.Collection{}
 
 	query := `
-		SELECT c.collection_id, c.collection_name
+		SELECT c.collection_id, c.collection_name, c.visibility, COALESCE(c.share_slug, '')
 		FROM Collections c
-		WHERE c.user_id = $1
+		WHERE c.user_id = $1 AND c.deleted_at IS NULL
 	`
 	rows, err := database.DB.Query(query, userID)
 	if err != nil {
@@ -43,67 +177,367 @@ func GetCollectionsByUserID(userID string) ([]models.Collection, error) {
 
 	for rows.Next() {
 		var collection models.Collection
-		err := rows.Scan(&collection.CollectionID, &collection.CollectionName)
+		err := rows.Scan(&collection.CollectionID, &collection.CollectionName, &collection.Visibility, &collection.ShareSlug)
 		if err != nil {
 			log.Printf("Error scanning collection: %v", err)
 			return nil, err
 		}
 
-		itemsQuery := `
-			SELECT i.item_id, i.name, i.edition, i.set, i.image, 
-				COALESCE(ui.grade, i.grade) as grade, 
-				ui.purchase_price, 
-				ui.quantity, i.type
-			FROM Items i
-			LEFT JOIN UserItems ui ON i.item_id = ui.item_id AND ui.collection_id = $1
-			WHERE ui.collection_id = $1 OR i.item_id IN (SELECT item_id FROM UserItems WHERE collection_id = $1)
-		`
-		itemRows, err := database.DB.Query(itemsQuery, collection.CollectionID)
+		collection.Cards, collection.Items, err = getCollectionContents(collection.CollectionID)
 		if err != nil {
 			log.Printf("Error querying items for collection %d: %v", collection.CollectionID, err)
 			return nil, err
 		}
-		defer itemRows.Close()
-
-		collection.Cards = []models.Card{}
-		collection.Items = []models.Item{}
-		for itemRows.Next() {
-			var id, itemType sql.NullString
-			var name, edition, set, image, grade sql.NullString
-			var purchasePrice sql.NullFloat64
-			var quantity int
-
-			err := itemRows.Scan(&id, &name, &edition, &set, &image, &grade, &purchasePrice, &quantity, &itemType)
-			if err != nil {
-				log.Printf("Error scanning item: %v", err)
-				return nil, fmt.Errorf("error scanning item: %v", err)
-			}
-
-			item := models.Item{
-				ID:            id.String,
-				Name:          name.String,
-				Edition:       edition.String,
-				Set:           set.String,
-				Image:         image.String,
-				Grade:         grade.String,
-				PurchasePrice: purchasePrice.Float64,
-				Quantity:      quantity,
-				Type:          itemType.String,
-			}
-
-			log.Printf("Retrieved item: ID=%s, Name=%s, PurchasePrice=%.2f, Grade=%s, Quantity=%d, Type=%s",
-				item.ID, item.Name, item.PurchasePrice, item.Grade, item.Quantity, item.Type)
-
-			if item.Type == "Pokemon Card" {
-				card := models.Card(item) // Convert Item to Card
-				collection.Cards = append(collection.Cards, card)
-			} else {
-				collection.Items = append(collection.Items, item)
-			}
-		}
 
 		collections = append(collections, collection)
 	}
 
 	return collections, nil
 }
+
+// getCollectionContents returns every copy held in a collection, split into
+// Pokemon cards and other items.
+func getCollectionContents(collectionID int) ([]models.Card, []models.Item, error) {
+	rows, err := database.DB.Query(`
+		SELECT `+cardColumns+`
+		FROM UserItems ui
+		JOIN Items i ON ui.item_id = i.item_id
+		WHERE ui.collection_id = $1 AND ui.deleted_at IS NULL
+		ORDER BY i.item_id, ui.user_item_id
+	`, collectionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	cards := []models.Card{}
+	items := []models.Item{}
+	for rows.Next() {
+		card, err := scanCard(rows)
+		if err != nil {
+			log.Printf("Error scanning item: %v", err)
+			return nil, nil, fmt.Errorf("error scanning item: %v", err)
+		}
+
+		if card.Type == "Pokemon Card" {
+			cards = append(cards, card)
+		} else {
+			items = append(items, models.Item(card)) // Convert Card to Item
+		}
+	}
+	return cards, items, rows.Err()
+}
+
+// Transfer modes for TransferCopies.
+const (
+	TransferMove = "move"
+	TransferCopy = "copy"
+)
+
+// Merge policies for MergeCollections.
+const (
+	// MergeCombine folds a copy into an identical target copy (same card,
+	// grade, condition, language, finish and purchase price) by adding
+	// quantities.
+	MergeCombine = "combine"
+	// MergeKeepSeparate moves every copy over unchanged.
+	MergeKeepSeparate = "keep_separate"
+)
+
+func RenameCollection(ctx context.Context, userID string, collectionName string, newName string) error {
+	collectionID, err := GetCollectionID(userID, collectionName)
+	if err != nil {
+		return err
+	}
+	return RenameCollectionByID(ctx, userID, collectionID, newName)
+}
+
+// RenameCollectionByID renames a live collection, failing with
+// ErrCollectionExists if the user already has a collection with the new name.
+func RenameCollectionByID(ctx context.Context, userID string, collectionID int, newName string) error {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return fmt.Errorf("new collection name is required")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCollection(tx, userID, collectionID); err != nil {
+		return err
+	}
+
+	var oldName string
+	if err := tx.QueryRow(`SELECT collection_name FROM Collections WHERE collection_id = $1`, collectionID).Scan(&oldName); err != nil {
+		return err
+	}
+
+	var existingID int
+	err = tx.QueryRow(`
+		SELECT collection_id FROM Collections
+		WHERE user_id = $1 AND collection_name = $2 AND deleted_at IS NULL
+	`, userID, newName).Scan(&existingID)
+	if err == nil && existingID != collectionID {
+		return ErrCollectionExists
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE Collections SET collection_name = $1 WHERE collection_id = $2`, newName, collectionID)
+	if err != nil {
+		return err
+	}
+	err = recordCollectionChange(ctx, tx, audit.CollectionRename, userID, collectionID,
+		&collectionAuditState{CollectionName: oldName}, &collectionAuditState{CollectionName: newName})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Renamed collection %d to %s for user %s", collectionID, newName, userID)
+	return tx.Commit()
+}
+
+func TransferCopies(ctx context.Context, userID string, sourceName string, targetName string, userItemIDs []int, mode string) ([]int, error) {
+	sourceID, err := GetCollectionID(userID, sourceName)
+	if err != nil {
+		return nil, err
+	}
+	targetID, err := GetCollectionID(userID, targetName)
+	if err != nil {
+		return nil, err
+	}
+	return TransferCopiesByID(ctx, userID, sourceID, targetID, userItemIDs, mode)
+}
+
+// TransferCopiesByID moves or copies the given copies from one collection to
+// another in a single transaction. It returns the user_item_ids of the copies
+// now in the target collection.
+func TransferCopiesByID(ctx context.Context, userID string, sourceID int, targetID int, userItemIDs []int, mode string) ([]int, error) {
+	if mode == "" {
+		mode = TransferMove
+	}
+	if mode != TransferMove && mode != TransferCopy {
+		return nil, fmt.Errorf("%w: unknown transfer mode: %s", ErrInvalidTransfer, mode)
+	}
+	if sourceID == targetID {
+		return nil, fmt.Errorf("%w: source and target are the same collection", ErrInvalidTransfer)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockCollection(tx, userID, sourceID); err != nil {
+		return nil, err
+	}
+	if err := lockCollection(tx, userID, targetID); err != nil {
+		return nil, err
+	}
+
+	transferred := make([]int, 0, len(userItemIDs))
+	for _, userItemID := range userItemIDs {
+		var newID int
+		if mode == TransferMove {
+			err = tx.QueryRow(`
+				UPDATE UserItems SET collection_id = $1
+				WHERE user_item_id = $2 AND collection_id = $3 AND deleted_at IS NULL
+				RETURNING user_item_id
+			`, targetID, userItemID, sourceID).Scan(&newID)
+		} else {
+			// A duplicate isn't a purchase, so it stays out of the ledger and
+			// its disposals draw cost from its purchase price
+			err = tx.QueryRow(`
+				INSERT INTO UserItems (collection_id, item_id, grade, purchase_price, quantity, condition, language, finish, acquired_at, notes)
+				SELECT $1, item_id, grade, purchase_price, quantity, condition, language, finish, acquired_at, notes
+				FROM UserItems
+				WHERE user_item_id = $2 AND collection_id = $3 AND deleted_at IS NULL
+				RETURNING user_item_id
+			`, targetID, userItemID, sourceID).Scan(&newID)
+		}
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: copy %d is not in collection %d", ErrCardNotFound, userItemID, sourceID)
+		}
+		if err != nil {
+			log.Printf("Error transferring copy %d: %v", userItemID, err)
+			return nil, err
+		}
+		err = recordAudit(ctx, tx, auditChange{
+			UserID:       userID,
+			Action:       audit.CopyTransfer,
+			TargetType:   audit.TargetCopy,
+			TargetID:     newID,
+			CollectionID: targetID,
+			Before:       copyLocation{UserItemID: userItemID, CollectionID: sourceID},
+			After:        copyLocation{UserItemID: newID, CollectionID: targetID},
+		})
+		if err != nil {
+			return nil, err
+		}
+		transferred = append(transferred, newID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Transferred (%s) %d copies from collection %d to %d for user %s", mode, len(transferred), sourceID, targetID, userID)
+	return transferred, nil
+}
+
+func MergeCollections(ctx context.Context, userID string, sourceName string, targetName string, policy string) error {
+	sourceID, err := GetCollectionID(userID, sourceName)
+	if err != nil {
+		return err
+	}
+	targetID, err := GetCollectionID(userID, targetName)
+	if err != nil {
+		return err
+	}
+	return MergeCollectionsByID(ctx, userID, sourceID, targetID, policy)
+}
+
+// MergeCollectionsByID moves every copy from the source collection into the
+// target according to policy, then moves the emptied source collection to the
+// trash.
+func MergeCollectionsByID(ctx context.Context, userID string, sourceID int, targetID int, policy string) error {
+	if policy == "" {
+		policy = MergeCombine
+	}
+	if policy != MergeCombine && policy != MergeKeepSeparate {
+		return fmt.Errorf("%w: unknown merge policy: %s", ErrInvalidTransfer, policy)
+	}
+	if sourceID == targetID {
+		return fmt.Errorf("%w: cannot merge a collection into itself", ErrInvalidTransfer)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCollection(tx, userID, sourceID); err != nil {
+		return err
+	}
+	if err := lockCollection(tx, userID, targetID); err != nil {
+		return err
+	}
+
+	if policy == MergeCombine {
+		if err := combineIdenticalCopies(ctx, tx, userID, sourceID, targetID); err != nil {
+			log.Printf("Error combining copies: %v", err)
+			return err
+		}
+	}
+
+	moved, err := scanIDs(tx.Query(`
+		UPDATE UserItems SET collection_id = $1
+		WHERE collection_id = $2 AND deleted_at IS NULL
+		RETURNING user_item_id
+	`, targetID, sourceID))
+	if err != nil {
+		return err
+	}
+
+	var sourceName string
+	err = tx.QueryRow(`
+		UPDATE Collections SET deleted_at = CURRENT_TIMESTAMP WHERE collection_id = $1
+		RETURNING collection_name
+	`, sourceID).Scan(&sourceName)
+	if err != nil {
+		return err
+	}
+
+	err = recordCollectionChange(ctx, tx, audit.CollectionMerge, userID, sourceID,
+		&collectionAuditState{CollectionName: sourceName},
+		&collectionAuditState{CollectionName: sourceName, UserItemIDs: moved, MergedInto: targetID, MergePolicy: policy})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Merged collection %d into %d (%s) for user %s", sourceID, targetID, policy, userID)
+	return tx.Commit()
+}
+
+// combineIdenticalCopies folds each source copy that has an identical copy in
+// the target into it, repointing the ledger history to the surviving row.
+// Copies in an active listing or open trade are left to move as they are, so
+// those keep pointing at a live copy.
+func combineIdenticalCopies(ctx context.Context, tx *sql.Tx, userID string, sourceID int, targetID int) error {
+	rows, err := tx.Query(`
+		SELECT s.user_item_id, MIN(t.user_item_id)
+		FROM UserItems s
+		JOIN UserItems t ON t.collection_id = $2 AND t.deleted_at IS NULL
+			AND t.item_id = s.item_id
+			AND t.grade IS NOT DISTINCT FROM s.grade
+			AND t.condition IS NOT DISTINCT FROM s.condition
+			AND t.language IS NOT DISTINCT FROM s.language
+			AND t.finish IS NOT DISTINCT FROM s.finish
+			AND t.purchase_price IS NOT DISTINCT FROM s.purchase_price
+		WHERE s.collection_id = $1 AND s.deleted_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM Listings l WHERE l.user_item_id = s.user_item_id AND l.status = $3)
+		AND NOT EXISTS (
+			SELECT 1 FROM TradeItems ti JOIN Trades tr ON tr.trade_id = ti.trade_id
+			WHERE ti.user_item_id = s.user_item_id AND tr.status IN ($4, $5, $6)
+		)
+		GROUP BY s.user_item_id
+	`, sourceID, targetID, models.ListingActive, models.TradeProposed, models.TradeCountered, models.TradeAccepted)
+	if err != nil {
+		return err
+	}
+
+	matches := make(map[int]int)
+	for rows.Next() {
+		var sourceItemID, targetItemID int
+		if err := rows.Scan(&sourceItemID, &targetItemID); err != nil {
+			rows.Close()
+			return err
+		}
+		matches[sourceItemID] = targetItemID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for sourceItemID, targetItemID := range matches {
+		sourceCopy, err := getCopy(tx, sourceItemID)
+		if err != nil {
+			return err
+		}
+		targetBefore, err := getCopy(tx, targetItemID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			UPDATE UserItems SET quantity = quantity + (SELECT quantity FROM UserItems WHERE user_item_id = $1)
+			WHERE user_item_id = $2
+		`, sourceItemID, targetItemID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE LedgerEntries SET user_item_id = $1 WHERE user_item_id = $2`, targetItemID, sourceItemID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM UserItems WHERE user_item_id = $1`, sourceItemID); err != nil {
+			return err
+		}
+		targetAfter, err := getCopy(tx, targetItemID)
+		if err != nil {
+			return err
+		}
+		if err := recordCopyChange(ctx, tx, audit.CopyRemove, userID, sourceID, sourceItemID, sourceCopy, nil); err != nil {
+			return err
+		}
+		if err := recordCopyChange(ctx, tx, audit.CopyUpdate, userID, targetID, targetItemID, targetBefore, targetAfter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+// ErrArchiveVersion is returned for archives written by a newer version of
+// the format than this server understands.
+var ErrArchiveVersion = fmt.Errorf("unsupported archive version; newest supported is %d", models.ArchiveVersion)
+
+// exportColumns are the CSV export headers. The import fields come first
+// under their own names so an export imports back without a column mapping.
+var exportColumns = []string{
+	models.ImportFieldName, models.ImportFieldSet, models.ImportFieldNumber, models.ImportFieldGrade,
+	models.ImportFieldCondition, models.ImportFieldPurchasePrice, models.ImportFieldQuantity, models.ImportFieldDate,
+	models.ImportFieldLanguage, models.ImportFieldFinish, models.ImportFieldNotes,
+	"id", "edition", "type", "image",
+}
+
+// ExportCollection builds a portable archive of a collection, including the
+// ledger history of every copy it holds.
+func ExportCollection(userID string, collectionName string) (*models.CollectionArchive, error) {
+	collectionID, err := GetCollectionID(userID, collectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	cards, items, err := getCollectionContents(collectionID)
+	if err != nil {
+		log.Printf("Error fetching contents of collection %d: %v", collectionID, err)
+		return nil, err
+	}
+
+	ledger, err := getCollectionLedger(collectionID)
+	if err != nil {
+		log.Printf("Error fetching ledger of collection %d: %v", collectionID, err)
+		return nil, err
+	}
+
+	return &models.CollectionArchive{
+		Version:        models.ArchiveVersion,
+		ExportedAt:     time.Now().UTC(),
+		CollectionName: collectionName,
+		Cards:          cards,
+		Items:          items,
+		Ledger:         ledger,
+	}, nil
+}
+
+// getCollectionLedger returns the ledger entries, with allocations, of every
+// copy currently held in a collection.
+func getCollectionLedger(collectionID int) ([]models.LedgerEntry, error) {
+	rows, err := database.DB.Query(`
+		SELECT `+ledgerColumns+`
+		FROM LedgerEntries
+		WHERE user_item_id IN (SELECT user_item_id FROM UserItems WHERE collection_id = $1 AND deleted_at IS NULL)
+		ORDER BY occurred_at, entry_id
+	`, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.LedgerEntry{}
+	index := make(map[int]int)
+	for rows.Next() {
+		entry, err := scanLedgerEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[entry.EntryID] = len(entries)
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	allocationRows, err := database.DB.Query(`
+		SELECT a.disposal_entry_id, a.lot_entry_id, a.quantity, a.cost
+		FROM LedgerAllocations a
+		JOIN LedgerEntries e ON a.disposal_entry_id = e.entry_id
+		WHERE e.user_item_id IN (SELECT user_item_id FROM UserItems WHERE collection_id = $1 AND deleted_at IS NULL)
+		ORDER BY a.allocation_id
+	`, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer allocationRows.Close()
+
+	for allocationRows.Next() {
+		var disposalID int
+		var allocation models.LotAllocation
+		if err := allocationRows.Scan(&disposalID, &allocation.LotEntryID, &allocation.Quantity, &allocation.Cost); err != nil {
+			return nil, err
+		}
+		if i, ok := index[disposalID]; ok {
+			entries[i].Allocations = append(entries[i].Allocations, allocation)
+		}
+	}
+	return entries, allocationRows.Err()
+}
+
+// WriteCollectionCSV writes every copy in an archive as one CSV line.
+func WriteCollectionCSV(w io.Writer, archive *models.CollectionArchive) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportColumns); err != nil {
+		return err
+	}
+
+	copies := make([]models.Card, 0, len(archive.Cards)+len(archive.Items))
+	copies = append(copies, archive.Cards...)
+	for _, item := range archive.Items {
+		copies = append(copies, models.Card(item))
+	}
+
+	for _, card := range copies {
+		date := ""
+		if card.AcquiredAt != nil {
+			date = card.AcquiredAt.Format("2006-01-02")
+		}
+		grade := ""
+		if card.Grade != nil {
+			grade = fmt.Sprint(card.Grade)
+		}
+		record := []string{
+			card.Name, card.Set, cardNumber(card), grade,
+			card.Condition, strconv.FormatFloat(card.PurchasePrice, 'f', 2, 64), strconv.Itoa(card.Quantity), date,
+			card.Language, card.Finish, card.Notes,
+			card.ID, card.Edition, card.Type, card.Image,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// cardNumber derives a card's collector number from its catalog ID, which
+// the TCG API forms as "<set id>-<number>".
+func cardNumber(card models.Card) string {
+	if card.Type != "Pokemon Card" || !strings.HasPrefix(card.ID, card.Set+"-") {
+		return ""
+	}
+	return strings.TrimPrefix(card.ID, card.Set+"-")
+}
+
+// ImportArchive restores an archive into a collection. Copies keep their
+// catalog details, so no catalog lookups are made, and their ledger history is
+// recreated with fresh IDs. Copies that fail validation are reported and
+// skipped; everything else is written in one transaction.
+func ImportArchive(ctx context.Context, userID string, collectionName string, archive *models.CollectionArchive, dryRun bool) (*models.ImportReport, error) {
+	if archive.Version < 1 || archive.Version > models.ArchiveVersion {
+		return nil, ErrArchiveVersion
+	}
+
+	copies := make([]models.Card, 0, len(archive.Cards)+len(archive.Items))
+	copies = append(copies, archive.Cards...)
+	for _, item := range archive.Items {
+		copies = append(copies, models.Card(item))
+	}
+
+	report := &models.ImportReport{DryRun: dryRun, Rows: make([]models.ImportRow, len(copies))}
+	for i, card := range copies {
+		row := &report.Rows[i]
+		row.Line = i + 1
+		row.Status = models.ImportMatched
+
+		if card.ID == "" || card.Name == "" {
+			row.Status = models.ImportInvalid
+			row.Error = "id and name are required"
+		} else if card.Type == "Pokemon Card" {
+			condition, language, finish, err := models.NormalizeRawAttributes(card.Condition, card.Language, card.Finish)
+			if err != nil {
+				row.Status = models.ImportInvalid
+				row.Error = err.Error()
+			}
+			card.Condition, card.Language, card.Finish = condition, language, finish
+		}
+		if card.Type == "" {
+			card.Type = "Item"
+		}
+		if card.Quantity <= 0 {
+			card.Quantity = 1
+		}
+		row.Card = card
+	}
+
+	if !dryRun {
+		if err := restoreArchive(ctx, userID, collectionName, report.Rows, archive.Ledger); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, row := range report.Rows {
+		switch row.Status {
+		case models.ImportMatched:
+			report.Matched++
+		case models.ImportImported:
+			report.Imported++
+		case models.ImportInvalid:
+			report.Invalid++
+		}
+	}
+
+	log.Printf("ImportArchive: %d copies for user %s, collection %s (dry run: %t): %d imported, %d invalid",
+		len(report.Rows), userID, collectionName, dryRun, report.Imported, report.Invalid)
+	return report, nil
+}
+
+func restoreArchive(ctx context.Context, userID string, collectionName string, rows []models.ImportRow, ledger []models.LedgerEntry) error {
+	collectionID, err := GetCollectionID(userID, collectionName)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCollection(tx, userID, collectionID); err != nil {
+		log.Printf("Error fetching collection: %v", err)
+		return err
+	}
+
+	acquired := make(map[int]bool)
+	for _, entry := range ledger {
+		if entry.UserItemID != nil && models.IsAcquisition(entry.EntryType) {
+			acquired[*entry.UserItemID] = true
+		}
+	}
+
+	// Archive user_item_ids are remapped to the rows created here
+	userItemIDs := make(map[int]int)
+	for i := range rows {
+		row := &rows[i]
+		if row.Status != models.ImportMatched {
+			continue
+		}
+
+		archivedID := row.Card.UserItemID
+		userItemID, err := insertMissingCopy(tx, collectionID, row.Card)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", row.Line, err)
+		}
+		if archivedID == 0 || !acquired[archivedID] {
+			err = recordAcquisition(tx, collectionID, userItemID, row.Card.ID, models.LedgerBuy, row.Card.Quantity, row.Card.PurchasePrice, row.Card.AcquiredAt, "")
+			if err != nil {
+				return fmt.Errorf("line %d: %w", row.Line, err)
+			}
+		}
+		if err := recordCopyAdded(ctx, tx, userID, collectionID, userItemID); err != nil {
+			return err
+		}
+		if archivedID != 0 {
+			userItemIDs[archivedID] = userItemID
+		}
+		row.Status = models.ImportImported
+		row.Card.UserItemID = userItemID
+	}
+
+	sort.SliceStable(ledger, func(i, j int) bool { return ledger[i].OccurredAt.Before(ledger[j].OccurredAt) })
+
+	entryIDs := make(map[int]int)
+	for _, entry := range ledger {
+		if entry.UserItemID == nil {
+			continue
+		}
+		userItemID, ok := userItemIDs[*entry.UserItemID]
+		if !ok {
+			continue
+		}
+
+		var entryID int
+		err := tx.QueryRow(`
+			INSERT INTO LedgerEntries (user_id, user_item_id, item_id, entry_type, quantity, price, fees, shipping,
+				counterparty, notes, cost_basis, realized_gain, occurred_at)
+			SELECT user_id, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''), $11, $12, $13
+			FROM Collections
+			WHERE collection_id = $1
+			RETURNING entry_id
+		`, collectionID, userItemID, entry.ItemID, entry.EntryType, entry.Quantity, entry.Price, entry.Fees, entry.Shipping,
+			entry.Counterparty, entry.Notes, entry.CostBasis, entry.RealizedGain, entry.OccurredAt).Scan(&entryID)
+		if err != nil {
+			log.Printf("Error restoring ledger entry %d: %v", entry.EntryID, err)
+			return err
+		}
+		entryIDs[entry.EntryID] = entryID
+	}
+
+	for _, entry := range ledger {
+		disposalID, ok := entryIDs[entry.EntryID]
+		if !ok {
+			continue
+		}
+		for _, allocation := range entry.Allocations {
+			lotID, ok := entryIDs[allocation.LotEntryID]
+			if !ok {
+				continue
+			}
+			_, err := tx.Exec(`
+				INSERT INTO LedgerAllocations (disposal_entry_id, lot_entry_id, quantity, cost)
+				VALUES ($1, $2, $3, $4)
+			`, disposalID, lotID, allocation.Quantity, allocation.Cost)
+			if err != nil {
+				log.Printf("Error restoring ledger allocation for entry %d: %v", entry.EntryID, err)
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return err
+	}
+	return nil
+}
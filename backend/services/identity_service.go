@@ -0,0 +1,181 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/sso"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrIdentityEmailRequired is returned when a provider doesn't share an
+// email address, which every account needs.
+var ErrIdentityEmailRequired = errors.New("the identity provider did not share an email address")
+
+// ErrIdentityEmailConflict is returned when an account already uses the
+// identity's email but the link can't be trusted: the provider hasn't
+// verified the address, or the account never has.
+var ErrIdentityEmailConflict = errors.New("an account with this email already exists; sign in with your password to use it")
+
+// maxUsernameLength matches Users.username.
+const maxUsernameLength = 50
+
+// SignInWithIdentity finds or creates the account for an external identity.
+// Identities seen before sign in to the account they were linked to. New
+// identities are linked to the account with the same email when both the
+// provider and the account have verified it; otherwise, if no account uses
+// the email, a new one is created without a usable password.
+func SignInWithIdentity(identity sso.Identity) (*models.IdentityLogin, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	login := &models.IdentityLogin{}
+	err = tx.QueryRow(`
+		SELECT u.user_id, u.username, COALESCE(u.is_active, TRUE), COALESCE(u.email_verified, FALSE)
+		FROM UserIdentities ui
+		JOIN Users u ON ui.user_id = u.user_id
+		WHERE ui.provider = $1 AND ui.subject = $2
+	`, identity.Provider, identity.Subject).Scan(&login.UserID, &login.Username, &login.Active, &login.EmailVerified)
+	if err == nil {
+		_, err = tx.Exec(`
+			UPDATE UserIdentities SET email = NULLIF($1, ''), last_login_at = CURRENT_TIMESTAMP
+			WHERE provider = $2 AND subject = $3
+		`, identity.Email, identity.Provider, identity.Subject)
+		if err != nil {
+			return nil, err
+		}
+		return login, tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if identity.Email == "" {
+		return nil, ErrIdentityEmailRequired
+	}
+
+	err = tx.QueryRow(`
+		SELECT user_id, username, COALESCE(is_active, TRUE), COALESCE(email_verified, FALSE)
+		FROM Users WHERE LOWER(email) = LOWER($1)
+		FOR UPDATE
+	`, identity.Email).Scan(&login.UserID, &login.Username, &login.Active, &login.EmailVerified)
+	switch {
+	case err == nil:
+		// Linking on an unverified address would hand the account to
+		// whoever registered the email first
+		if !identity.EmailVerified || !login.EmailVerified {
+			return nil, ErrIdentityEmailConflict
+		}
+		login.Linked = true
+	case err == sql.ErrNoRows:
+		if err := createIdentityUser(tx, identity, login); err != nil {
+			return nil, err
+		}
+		login.Created = true
+	default:
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO UserIdentities (user_id, provider, subject, email, last_login_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+	`, login.UserID, identity.Provider, identity.Subject, identity.Email)
+	if err != nil {
+		log.Printf("Error linking %s identity to user %d: %v", identity.Provider, login.UserID, err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Linked %s identity to user %d (new account: %t)", identity.Provider, login.UserID, login.Created)
+	return login, nil
+}
+
+func createIdentityUser(tx *sql.Tx, identity sso.Identity, login *models.IdentityLogin) error {
+	password, err := unusablePassword()
+	if err != nil {
+		return err
+	}
+	username, err := availableUsername(tx, identity)
+	if err != nil {
+		return err
+	}
+
+	firstName, lastName := identity.GivenName, identity.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(identity.Name, " ")
+	}
+	err = tx.QueryRow(`
+		INSERT INTO Users (username, first_name, last_name, email, password, email_verified, joined)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, CURRENT_TIMESTAMP)
+		RETURNING user_id
+	`, username, truncateRunes(firstName, 50), truncateRunes(lastName, 50), identity.Email, password, identity.EmailVerified).Scan(&login.UserID)
+	if err != nil {
+		log.Printf("Error creating user for %s identity: %v", identity.Provider, err)
+		return err
+	}
+	login.Username, login.Active, login.EmailVerified = username, true, identity.EmailVerified
+	return nil
+}
+
+// availableUsername derives a free username from the identity's preferred
+// username or the local part of its email, adding a number if it's taken.
+func availableUsername(tx *sql.Tx, identity sso.Identity) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-' {
+			return r
+		}
+		return -1
+	}, base)
+	if base == "" {
+		base = "trainer"
+	}
+	base = truncateRunes(base, maxUsernameLength-4)
+
+	for i := 1; i <= 100; i++ {
+		username := base
+		if i > 1 {
+			username = fmt.Sprintf("%s%d", base, i)
+		}
+		var taken bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM Users WHERE LOWER(username) = LOWER($1))`, username).Scan(&taken); err != nil {
+			return "", err
+		}
+		if !taken {
+			return username, nil
+		}
+	}
+	return "", fmt.Errorf("no free username for %q", base)
+}
+
+// unusablePassword returns a bcrypt hash of random bytes, for accounts that
+// have no password anyone knows.
+func unusablePassword() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword(raw, bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func truncateRunes(value string, max int) string {
+	if runes := []rune(value); len(runes) > max {
+		return string(runes[:max])
+	}
+	return value
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+// MaxImportRows caps the number of data lines accepted in one import file.
+const MaxImportRows = 10000
+
+var ErrImportTooLarge = fmt.Errorf("import exceeds %d rows", MaxImportRows)
+
+// ErrImportMapping is returned when the column mapping does not fit the file.
+var ErrImportMapping = errors.New("invalid column mapping")
+
+// ParseImportCSV reads a CSV file whose first line is a header row and maps
+// each data line onto a card using mapping. An empty mapping matches headers
+// to field names case-insensitively. Lines that cannot be parsed are returned
+// with status invalid and a line-level error.
+func ParseImportCSV(r io.Reader, mapping models.ImportMapping) ([]models.ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: file is empty", ErrImportMapping)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	columns, err := importColumns(header, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.ImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rows = append(rows, models.ImportRow{Line: parseErr.Line, Status: models.ImportInvalid, Error: parseErr.Err.Error()})
+				continue
+			}
+			return nil, err
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+		if len(rows) >= MaxImportRows {
+			return nil, ErrImportTooLarge
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, parseImportRecord(line, record, columns))
+	}
+	return rows, nil
+}
+
+// importColumns resolves the mapping to column indexes. Name and set are
+// required; other fields are optional.
+func importColumns(header []string, mapping models.ImportMapping) (map[string]int, error) {
+	index := make(map[string]int, len(header))
+	for i, column := range header {
+		index[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	columns := make(map[string]int)
+	for _, field := range models.ImportFields {
+		column, mapped := mapping[field]
+		if !mapped {
+			column = field
+		}
+		if column == "" {
+			continue
+		}
+		i, found := index[strings.ToLower(strings.TrimSpace(column))]
+		if !found {
+			if mapped {
+				return nil, fmt.Errorf("%w: column %q for %s not found", ErrImportMapping, column, field)
+			}
+			continue
+		}
+		columns[field] = i
+	}
+	for field := range mapping {
+		if !isImportField(field) {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrImportMapping, field)
+		}
+	}
+
+	if _, ok := columns[models.ImportFieldName]; !ok {
+		return nil, fmt.Errorf("%w: a name column is required", ErrImportMapping)
+	}
+	if _, ok := columns[models.ImportFieldSet]; !ok {
+		return nil, fmt.Errorf("%w: a set column is required", ErrImportMapping)
+	}
+	return columns, nil
+}
+
+func isImportField(field string) bool {
+	for _, f := range models.ImportFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func parseImportRecord(line int, record []string, columns map[string]int) models.ImportRow {
+	value := func(field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	row := models.ImportRow{
+		Line:   line,
+		Number: value(models.ImportFieldNumber),
+		Card: models.Card{
+			Name: value(models.ImportFieldName),
+			Set:  value(models.ImportFieldSet),
+		},
+	}
+	invalid := func(format string, args ...interface{}) models.ImportRow {
+		row.Status = models.ImportInvalid
+		row.Error = fmt.Sprintf(format, args...)
+		return row
+	}
+
+	if row.Card.Name == "" || row.Card.Set == "" {
+		return invalid("name and set are required")
+	}
+
+	row.Card.Grade = models.ParseImportGrade(value(models.ImportFieldGrade))
+
+	condition, language, finish, err := models.NormalizeRawAttributes(value(models.ImportFieldCondition),
+		value(models.ImportFieldLanguage), value(models.ImportFieldFinish))
+	if err != nil {
+		return invalid("%v", err)
+	}
+	row.Card.Condition, row.Card.Language, row.Card.Finish = condition, language, finish
+	row.Card.Notes = value(models.ImportFieldNotes)
+
+	if row.Card.PurchasePrice, err = models.ParseImportPrice(value(models.ImportFieldPurchasePrice)); err != nil {
+		return invalid("%v", err)
+	}
+	if row.Card.Quantity, err = models.ParseImportQuantity(value(models.ImportFieldQuantity)); err != nil {
+		return invalid("%v", err)
+	}
+	if row.Card.AcquiredAt, err = models.ParseImportDate(value(models.ImportFieldDate)); err != nil {
+		return invalid("%v", err)
+	}
+
+	return row
+}
+
+// ResolveImportRows looks every parseable row up in the card catalog, setting
+// its status to matched, ambiguous (with candidates) or not_found. Lookups run
+// with bounded concurrency and identical lookups share one API call.
+func ResolveImportRows(apiKey string, rows []models.ImportRow) {
+	type lookup struct{ set, name, number string }
+	pending := make(map[lookup][]*models.ImportRow)
+	for i := range rows {
+		if rows[i].Status == models.ImportInvalid {
+			continue
+		}
+		key := lookup{strings.ToLower(rows[i].Card.Set), strings.ToLower(rows[i].Card.Name), rows[i].Number}
+		pending[key] = append(pending[key], &rows[i])
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, batchResolveWorkers)
+	for _, group := range pending {
+		wg.Add(1)
+		go func(group []*models.ImportRow) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			first := group[0]
+			candidates, err := SearchCatalog(apiKey, first.Card.Set, first.Card.Name, first.Number)
+			for _, row := range group {
+				switch {
+				case err != nil:
+					row.Status = models.ImportNotFound
+					row.Error = fmt.Sprintf("error searching catalog: %v", err)
+				case len(candidates) == 0:
+					row.Status = models.ImportNotFound
+				case len(candidates) == 1:
+					row.Status = models.ImportMatched
+					applyCatalogCard(&row.Card, candidates[0])
+				default:
+					row.Status = models.ImportAmbiguous
+					row.Candidates = candidates
+				}
+			}
+		}(group)
+	}
+	wg.Wait()
+}
+
+// applyCatalogCard fills in the catalog details of a resolved row, keeping the
+// copy details read from the file.
+func applyCatalogCard(card *models.Card, catalog models.Card) {
+	card.ID = catalog.ID
+	card.Name = catalog.Name
+	card.Edition = catalog.Edition
+	card.Set = catalog.Set
+	card.Image = catalog.Image
+	card.Type = catalog.Type
+}
+
+// ImportCards resolves rows against the catalog and, unless dryRun is set,
+// adds every matched row to the collection. selections picks a candidate card
+// ID for ambiguous rows by line number, as offered in an earlier preview.
+func ImportCards(ctx context.Context, apiKey string, userID string, collectionName string, rows []models.ImportRow, selections map[int]string, dryRun bool) (*models.ImportReport, error) {
+	ResolveImportRows(apiKey, rows)
+
+	for i := range rows {
+		row := &rows[i]
+		cardID, selected := selections[row.Line]
+		if row.Status != models.ImportAmbiguous || !selected {
+			continue
+		}
+		for _, candidate := range row.Candidates {
+			if candidate.ID == cardID {
+				row.Status = models.ImportMatched
+				row.Candidates = nil
+				applyCatalogCard(&row.Card, candidate)
+				break
+			}
+		}
+	}
+
+	report := &models.ImportReport{DryRun: dryRun, Rows: rows}
+	if !dryRun {
+		if _, err := GetCollectionID(userID, collectionName); err != nil {
+			return nil, err
+		}
+
+		for i := range rows {
+			row := &rows[i]
+			if row.Status != models.ImportMatched {
+				continue
+			}
+			userItemID, err := AddCardToCollection(ctx, userID, collectionName, row.Card)
+			if err != nil {
+				log.Printf("ImportCards: Error adding line %d: %v", row.Line, err)
+				row.Status = models.ImportFailed
+				row.Error = err.Error()
+				continue
+			}
+			row.Status = models.ImportImported
+			row.Card.UserItemID = userItemID
+		}
+	}
+
+	for _, row := range rows {
+		switch row.Status {
+		case models.ImportMatched:
+			report.Matched++
+		case models.ImportAmbiguous:
+			report.Ambiguous++
+		case models.ImportNotFound:
+			report.NotFound++
+		case models.ImportInvalid:
+			report.Invalid++
+		case models.ImportImported:
+			report.Imported++
+		case models.ImportFailed:
+			report.Failed++
+		}
+	}
+
+	log.Printf("ImportCards: %d rows for user %s, collection %s (dry run: %t): %d imported, %d matched, %d ambiguous, %d not found, %d invalid, %d failed",
+		len(rows), userID, collectionName, dryRun, report.Imported, report.Matched, report.Ambiguous, report.NotFound, report.Invalid, report.Failed)
+	return report, nil
+}
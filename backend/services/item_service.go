@@ -1,8 +1,11 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"log"
 
+	"github.com/CatsMeow492/PokemonCollection/audit"
 	"github.com/CatsMeow492/PokemonCollection/database"
 	"github.com/CatsMeow492/PokemonCollection/models"
 )
@@ -14,6 +17,7 @@ func GetItemsByUserIDAndCollectionName(userID string, collectionName string) ([]
 		JOIN Items i ON ui.item_id = i.item_id
 		JOIN Collections c ON ui.collection_id = c.collection_id
 		WHERE c.user_id = $1 AND c.collection_name = $2
+		AND c.deleted_at IS NULL AND ui.deleted_at IS NULL
 	`
 	rows, err := database.DB.Query(query, userID, collectionName)
 	if err != nil {
@@ -33,31 +37,46 @@ func GetItemsByUserIDAndCollectionName(userID string, collectionName string) ([]
 	return items, nil
 }
 
-func UpdateItemQuantity(userID string, collectionName string, itemID string, quantity int) (*models.Item, error) {
+// UpdateItemQuantity sets the quantity of one copy of an item. userItemID
+// picks the copy when the collection holds several.
+func UpdateItemQuantity(ctx context.Context, userID string, collectionName string, itemID string, userItemID int, quantity int) (*models.Item, error) {
 	tx, err := database.DB.Begin()
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec(`
-		UPDATE UserItems
-		SET quantity = $1
-		WHERE collection_id = (SELECT collection_id FROM Collections WHERE user_id = $2 AND collection_name = $3)
-		AND item_id = $4
-	`, quantity, userID, collectionName, itemID)
+	collectionID, err := lockCollectionByName(tx, userID, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	userItemID, err = resolveCopy(tx, userID, collectionID, itemID, userItemID)
+	if err != nil {
+		return nil, err
+	}
+	before, err := getCopy(tx, userItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`UPDATE UserItems SET quantity = $1 WHERE user_item_id = $2`, quantity, userItemID); err != nil {
+		return nil, err
+	}
+	after, err := getCopy(tx, userItemID)
 	if err != nil {
 		return nil, err
 	}
+	if err := recordCopyChange(ctx, tx, audit.CopyUpdate, userID, collectionID, userItemID, before, after); err != nil {
+		return nil, err
+	}
 
 	var item models.Item
 	err = tx.QueryRow(`
 		SELECT i.item_id, i.name, i.edition, i.grade, ui.purchase_price, ui.quantity
 		FROM UserItems ui
 		JOIN Items i ON ui.item_id = i.item_id
-		JOIN Collections c ON ui.collection_id = c.collection_id
-		WHERE c.user_id = $1 AND c.collection_name = $2 AND i.item_id = $3
-	`, userID, collectionName, itemID).Scan(&item.ID, &item.Name, &item.Edition, &item.Grade, &item.PurchasePrice, &item.Quantity)
+		WHERE ui.user_item_id = $1
+	`, userItemID).Scan(&item.ID, &item.Name, &item.Edition, &item.Grade, &item.PurchasePrice, &item.Quantity)
 	if err != nil {
 		return nil, err
 	}
@@ -70,7 +89,7 @@ func UpdateItemQuantity(userID string, collectionName string, itemID string, qua
 	return &item, nil
 }
 
-func AddItemToCollection(userID string, collectionName string, item models.Item) error {
+func AddItemToCollection(ctx context.Context, userID string, collectionName string, item models.Item) error {
 	log.Printf("Adding item to collection: %+v", item)
 
 	tx, err := database.DB.Begin()
@@ -80,15 +99,22 @@ func AddItemToCollection(userID string, collectionName string, item models.Item)
 	defer tx.Rollback()
 
 	var collectionID int
+	var created bool
 	err = tx.QueryRow(`
 		INSERT INTO Collections (user_id, collection_name)
 		VALUES ($1, $2)
-		ON CONFLICT (user_id, collection_name) DO UPDATE SET collection_name = EXCLUDED.collection_name
-		RETURNING collection_id
-	`, userID, collectionName).Scan(&collectionID)
+		ON CONFLICT (user_id, collection_name) WHERE deleted_at IS NULL DO UPDATE SET collection_name = EXCLUDED.collection_name
+		RETURNING collection_id, xmax = 0
+	`, userID, collectionName).Scan(&collectionID, &created)
 	if err != nil {
 		return err
 	}
+	if created {
+		err = recordCollectionChange(ctx, tx, audit.CollectionCreate, userID, collectionID, nil, &collectionAuditState{CollectionName: collectionName})
+		if err != nil {
+			return err
+		}
+	}
 
 	// Ensure item.Type is set correctly before inserting
 	if item.Type == "" {
@@ -113,29 +139,53 @@ func AddItemToCollection(userID string, collectionName string, item models.Item)
 	// Log the inserted/updated item
 	log.Printf("Item inserted/updated: ID=%s, Name=%s, PurchasePrice=%.2f", item.ID, item.Name, item.PurchasePrice)
 
-	_, err = tx.Exec(`
-		INSERT INTO UserItems (collection_id, item_id, quantity, purchase_price)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (collection_id, item_id) DO UPDATE SET
-			quantity = UserItems.quantity + EXCLUDED.quantity,
-			purchase_price = EXCLUDED.purchase_price
-	`, collectionID, item.ID, item.Quantity, item.PurchasePrice)
+	var userItemID int
+	err = tx.QueryRow(`
+		INSERT INTO UserItems (collection_id, item_id, quantity, purchase_price, acquired_at, notes)
+		VALUES ($1, $2, $3, $4, COALESCE($5, CURRENT_TIMESTAMP), NULLIF($6, ''))
+		RETURNING user_item_id
+	`, collectionID, item.ID, item.Quantity, item.PurchasePrice, item.AcquiredAt, item.Notes).Scan(&userItemID)
 	if err != nil {
 		return err
 	}
 
+	err = recordAcquisition(tx, collectionID, userItemID, item.ID, models.LedgerBuy, item.Quantity, item.PurchasePrice, item.AcquiredAt, "")
+	if err != nil {
+		return err
+	}
+	if err := recordCopyAdded(ctx, tx, userID, collectionID, userItemID); err != nil {
+		return err
+	}
+
 	log.Printf("Item inserted/updated: ID=%s, Name=%s, PurchasePrice=%.2f", item.ID, item.Name, item.PurchasePrice)
 
 	return tx.Commit()
 }
 
-func RemoveItemFromCollection(userID string, collectionName string, itemID string) error {
-	_, err := database.DB.Exec(`
-		DELETE FROM UserItems
-		WHERE collection_id = (SELECT collection_id FROM Collections WHERE user_id = $1 AND collection_name = $2)
-		AND item_id = $3
-	`, userID, collectionName, itemID)
-	return err
+func RemoveItemFromCollection(ctx context.Context, userID string, collectionName string, itemID string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	collectionID, err := lockCollectionByName(tx, userID, collectionName)
+	if errors.Is(err, ErrCollectionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	copies, err := lockCopies(tx, collectionID, 0, itemID)
+	if err != nil {
+		return err
+	}
+	for i := range copies {
+		if err := trashCopy(ctx, tx, userID, collectionID, &copies[i]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 // ... (update other functions similarly)
@@ -0,0 +1,514 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/audit"
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/lib/pq"
+)
+
+// ErrInvalidLedgerEntry is wrapped by validation errors for ledger requests.
+var ErrInvalidLedgerEntry = errors.New("invalid ledger entry")
+
+// ErrInsufficientQuantity is returned when a disposal asks for more units than
+// the copy holds.
+var ErrInsufficientQuantity = errors.New("copy does not hold that many units")
+
+const ledgerColumns = `entry_id, user_item_id, item_id, entry_type, quantity, COALESCE(price, 0), COALESCE(fees, 0), COALESCE(shipping, 0),
+	COALESCE(counterparty, ''), COALESCE(notes, ''), cost_basis, realized_gain, occurred_at`
+
+func scanLedgerEntry(row rowScanner) (models.LedgerEntry, error) {
+	var entry models.LedgerEntry
+	var userItemID sql.NullInt64
+	var costBasis, realizedGain sql.NullFloat64
+	err := row.Scan(&entry.EntryID, &userItemID, &entry.ItemID, &entry.EntryType, &entry.Quantity, &entry.Price, &entry.Fees, &entry.Shipping,
+		&entry.Counterparty, &entry.Notes, &costBasis, &realizedGain, &entry.OccurredAt)
+	if err != nil {
+		return entry, err
+	}
+	if userItemID.Valid {
+		id := int(userItemID.Int64)
+		entry.UserItemID = &id
+	}
+	if costBasis.Valid {
+		entry.CostBasis = &costBasis.Float64
+	}
+	if realizedGain.Valid {
+		entry.RealizedGain = &realizedGain.Float64
+	}
+	return entry, nil
+}
+
+// recordAcquisition writes the ledger entry for a copy entering a collection.
+// It runs in the caller's transaction so the copy and its history are created
+// together.
+func recordAcquisition(tx *sql.Tx, collectionID int, userItemID int, itemID string, entryType string, quantity int, unitPrice float64, acquiredAt *time.Time, counterparty string) error {
+	_, err := tx.Exec(`
+		INSERT INTO LedgerEntries (user_id, user_item_id, item_id, entry_type, quantity, price, counterparty, occurred_at)
+		SELECT user_id, $2, $3, $4, $5, $6, NULLIF($7, ''), COALESCE($8, CURRENT_TIMESTAMP)
+		FROM Collections
+		WHERE collection_id = $1
+	`, collectionID, userItemID, itemID, entryType, quantity, unitPrice, counterparty, acquiredAt)
+	if err != nil {
+		log.Printf("Error recording %s ledger entry for copy %d: %v", entryType, userItemID, err)
+	}
+	return err
+}
+
+// GetLedgerByUserID returns a user's ledger in date order, optionally limited
+// to one catalog item, with the realized gain over the returned entries.
+func GetLedgerByUserID(userID string, itemID string) (*models.Ledger, error) {
+	rows, err := database.DB.Query(`
+		SELECT `+ledgerColumns+`
+		FROM LedgerEntries
+		WHERE user_id = $1 AND ($2 = '' OR item_id = $2)
+		ORDER BY occurred_at, entry_id
+	`, userID, itemID)
+	if err != nil {
+		log.Printf("Error querying ledger for user %s: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ledger := &models.Ledger{Entries: []models.LedgerEntry{}}
+	index := make(map[int]int)
+	for rows.Next() {
+		entry, err := scanLedgerEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		if entry.RealizedGain != nil {
+			ledger.RealizedGain += *entry.RealizedGain
+		}
+		index[entry.EntryID] = len(ledger.Entries)
+		ledger.Entries = append(ledger.Entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	allocationRows, err := database.DB.Query(`
+		SELECT a.disposal_entry_id, a.lot_entry_id, a.quantity, a.cost
+		FROM LedgerAllocations a
+		JOIN LedgerEntries e ON a.disposal_entry_id = e.entry_id
+		WHERE e.user_id = $1
+		ORDER BY a.allocation_id
+	`, userID)
+	if err != nil {
+		log.Printf("Error querying ledger allocations for user %s: %v", userID, err)
+		return nil, err
+	}
+	defer allocationRows.Close()
+
+	for allocationRows.Next() {
+		var disposalID int
+		var allocation models.LotAllocation
+		if err := allocationRows.Scan(&disposalID, &allocation.LotEntryID, &allocation.Quantity, &allocation.Cost); err != nil {
+			return nil, err
+		}
+		if i, ok := index[disposalID]; ok {
+			ledger.Entries[i].Allocations = append(ledger.Entries[i].Allocations, allocation)
+		}
+	}
+	return ledger, allocationRows.Err()
+}
+
+// openLot is an acquisition whose units have not all been disposed of yet.
+type openLot struct {
+	EntryID    int
+	UserItemID int
+	Remaining  int
+	UnitCost   float64
+}
+
+// loadOpenLots returns a user's open lots for an item, oldest first. A lot's
+// cost includes its fees and shipping plus any grading paid for the same copy.
+func loadOpenLots(tx *sql.Tx, userID string, itemID string) ([]openLot, error) {
+	rows, err := tx.Query(`
+		SELECT l.entry_id, COALESCE(l.user_item_id, 0), l.quantity,
+			l.quantity - COALESCE((SELECT SUM(a.quantity) FROM LedgerAllocations a WHERE a.lot_entry_id = l.entry_id), 0),
+			COALESCE(l.price, 0) * l.quantity + COALESCE(l.fees, 0) + COALESCE(l.shipping, 0) +
+				COALESCE((SELECT SUM(COALESCE(g.price, 0) + COALESCE(g.fees, 0) + COALESCE(g.shipping, 0))
+					FROM LedgerEntries g
+					WHERE g.entry_type = $3 AND g.user_item_id = l.user_item_id), 0)
+		FROM LedgerEntries l
+		WHERE l.user_id = $1 AND l.item_id = $2 AND l.entry_type IN ($4, $5, $6)
+		ORDER BY l.occurred_at, l.entry_id
+		FOR UPDATE OF l
+	`, userID, itemID, models.LedgerGrading, models.LedgerBuy, models.LedgerTradeIn, models.LedgerGiftIn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []openLot
+	for rows.Next() {
+		var lot openLot
+		var quantity int
+		var totalCost float64
+		if err := rows.Scan(&lot.EntryID, &lot.UserItemID, &quantity, &lot.Remaining, &totalCost); err != nil {
+			return nil, err
+		}
+		if lot.Remaining <= 0 || quantity <= 0 {
+			continue
+		}
+		lot.UnitCost = totalCost / float64(quantity)
+		lots = append(lots, lot)
+	}
+	return lots, rows.Err()
+}
+
+// allocateLots consumes quantity units from lots in the order given. Units not
+// covered by any lot (copies added before the ledger existed) are costed at
+// fallbackUnitCost and get no allocation row.
+func allocateLots(lots []openLot, quantity int, fallbackUnitCost float64) ([]models.LotAllocation, float64) {
+	var allocations []models.LotAllocation
+	var costBasis float64
+	for _, lot := range lots {
+		if quantity == 0 {
+			break
+		}
+		take := lot.Remaining
+		if take > quantity {
+			take = quantity
+		}
+		cost := float64(take) * lot.UnitCost
+		allocations = append(allocations, models.LotAllocation{LotEntryID: lot.EntryID, Quantity: take, Cost: cost})
+		costBasis += cost
+		quantity -= take
+	}
+	costBasis += float64(quantity) * fallbackUnitCost
+	return allocations, costBasis
+}
+
+// selectLots orders the open lots a disposal draws from. FIFO uses every lot
+// oldest first; specific identification uses the requested lots, or the lots
+// of the disposed copy when none are named.
+func selectLots(lots []openLot, method string, lotIDs []int, userItemID int) ([]openLot, error) {
+	if method == models.CostBasisFIFO {
+		return lots, nil
+	}
+
+	var selected []openLot
+	if len(lotIDs) == 0 {
+		for _, lot := range lots {
+			if lot.UserItemID == userItemID {
+				selected = append(selected, lot)
+			}
+		}
+		return selected, nil
+	}
+
+	byID := make(map[int]openLot, len(lots))
+	for _, lot := range lots {
+		byID[lot.EntryID] = lot
+	}
+	for _, id := range lotIDs {
+		lot, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: lot %d is not an open lot for this item", ErrInvalidLedgerEntry, id)
+		}
+		selected = append(selected, lot)
+	}
+	return selected, nil
+}
+
+// RecordDisposal records a sale, trade or gift of units from an owned copy,
+// computing the cost basis with the given method and the realized gain for
+// sales and trades. The disposed units leave the collection in the same
+// transaction.
+func RecordDisposal(ctx context.Context, userID string, entry models.LedgerEntry, method string, lotIDs []int) (*models.LedgerEntry, error) {
+	if !models.IsDisposal(entry.EntryType) {
+		return nil, fmt.Errorf("%w: %q is not a disposal type", ErrInvalidLedgerEntry, entry.EntryType)
+	}
+	if entry.UserItemID == nil {
+		return nil, fmt.Errorf("%w: user_item_id is required", ErrInvalidLedgerEntry)
+	}
+	if entry.Quantity == 0 {
+		entry.Quantity = 1
+	}
+	if entry.Quantity < 0 {
+		return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidLedgerEntry)
+	}
+	if method == "" {
+		method = models.CostBasisFIFO
+	}
+	if method != models.CostBasisFIFO && method != models.CostBasisSpecific {
+		return nil, fmt.Errorf("%w: unknown cost basis method %q", ErrInvalidLedgerEntry, method)
+	}
+	if entry.OccurredAt.IsZero() {
+		entry.OccurredAt = time.Now()
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := disposeUnits(ctx, tx, userID, &entry, method, lotIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Recorded %s of %d x %s for user %s: cost basis %.2f", entry.EntryType, entry.Quantity, entry.ItemID, userID, *entry.CostBasis)
+	return &entry, nil
+}
+
+// disposeUnits records a disposal in the caller's transaction and takes the
+// disposed units out of the copy. It returns the copy as it was before.
+func disposeUnits(ctx context.Context, tx *sql.Tx, userID string, entry *models.LedgerEntry, method string, lotIDs []int) (*models.Card, error) {
+	var held, collectionID int
+	var purchasePrice float64
+	err := tx.QueryRow(`
+		SELECT ui.item_id, ui.quantity, COALESCE(ui.purchase_price, 0), ui.collection_id
+		FROM UserItems ui
+		JOIN Collections c ON ui.collection_id = c.collection_id
+		WHERE ui.user_item_id = $1 AND c.user_id = $2
+		AND c.deleted_at IS NULL AND ui.deleted_at IS NULL
+		FOR UPDATE OF ui
+	`, *entry.UserItemID, userID).Scan(&entry.ItemID, &held, &purchasePrice, &collectionID)
+	if err == sql.ErrNoRows {
+		return nil, ErrCardNotFound
+	}
+	if err != nil {
+		log.Printf("Error fetching copy %d: %v", *entry.UserItemID, err)
+		return nil, err
+	}
+	if entry.Quantity > held {
+		return nil, ErrInsufficientQuantity
+	}
+	before, err := getCopy(tx, *entry.UserItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	lots, err := loadOpenLots(tx, userID, entry.ItemID)
+	if err != nil {
+		log.Printf("Error loading open lots for %s: %v", entry.ItemID, err)
+		return nil, err
+	}
+	lots, err = selectLots(lots, method, lotIDs, *entry.UserItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	allocations, costBasis := allocateLots(lots, entry.Quantity, purchasePrice)
+	entry.CostBasis = &costBasis
+	entry.Allocations = allocations
+	if entry.EntryType != models.LedgerGiftOut {
+		gain := entry.Price*float64(entry.Quantity) - entry.Fees - entry.Shipping - costBasis
+		entry.RealizedGain = &gain
+	}
+
+	if err := insertDisposal(tx, userID, entry); err != nil {
+		return nil, err
+	}
+
+	if entry.Quantity == held {
+		_, err = tx.Exec(`DELETE FROM UserItems WHERE user_item_id = $1`, *entry.UserItemID)
+	} else {
+		_, err = tx.Exec(`UPDATE UserItems SET quantity = quantity - $1 WHERE user_item_id = $2`, entry.Quantity, *entry.UserItemID)
+	}
+	if err != nil {
+		log.Printf("Error removing disposed units of copy %d: %v", *entry.UserItemID, err)
+		return nil, err
+	}
+	var after *models.Card
+	if entry.Quantity < held {
+		if after, err = getCopy(tx, *entry.UserItemID); err != nil {
+			return nil, err
+		}
+	}
+	if err := recordCopyChange(ctx, tx, audit.CopyDispose, userID, collectionID, *entry.UserItemID, before, after); err != nil {
+		return nil, err
+	}
+
+	return before, nil
+}
+
+// insertDisposal writes a disposal entry and the lot allocations it consumed.
+func insertDisposal(tx *sql.Tx, userID string, entry *models.LedgerEntry) error {
+	err := tx.QueryRow(`
+		INSERT INTO LedgerEntries (user_id, user_item_id, item_id, entry_type, quantity, price, fees, shipping,
+			counterparty, notes, cost_basis, realized_gain, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''), $11, $12, $13)
+		RETURNING entry_id
+	`, userID, *entry.UserItemID, entry.ItemID, entry.EntryType, entry.Quantity, entry.Price, entry.Fees, entry.Shipping,
+		entry.Counterparty, entry.Notes, entry.CostBasis, entry.RealizedGain, entry.OccurredAt).Scan(&entry.EntryID)
+	if err != nil {
+		log.Printf("Error inserting ledger entry: %v", err)
+		return err
+	}
+
+	for _, allocation := range entry.Allocations {
+		_, err = tx.Exec(`
+			INSERT INTO LedgerAllocations (disposal_entry_id, lot_entry_id, quantity, cost)
+			VALUES ($1, $2, $3, $4)
+		`, entry.EntryID, allocation.LotEntryID, allocation.Quantity, allocation.Cost)
+		if err != nil {
+			log.Printf("Error inserting lot allocation: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// closeCopyLots records the removal of a copy being moved to the trash,
+// consuming what is left of the copy's own lots.
+func closeCopyLots(tx *sql.Tx, userID string, card *models.Card) error {
+	lots, err := loadOpenLots(tx, userID, card.ID)
+	if err != nil {
+		log.Printf("Error loading open lots for %s: %v", card.ID, err)
+		return err
+	}
+	lots, err = selectLots(lots, models.CostBasisSpecific, nil, card.UserItemID)
+	if err != nil {
+		return err
+	}
+
+	userItemID := card.UserItemID
+	allocations, costBasis := allocateLots(lots, card.Quantity, card.PurchasePrice)
+	entry := models.LedgerEntry{
+		UserItemID:  &userItemID,
+		ItemID:      card.ID,
+		EntryType:   models.LedgerRemoval,
+		Quantity:    card.Quantity,
+		CostBasis:   &costBasis,
+		OccurredAt:  time.Now(),
+		Allocations: allocations,
+	}
+	return insertDisposal(tx, userID, &entry)
+}
+
+// reopenCopyLots deletes the removal entries of restored copies, reopening
+// the lots they closed.
+func reopenCopyLots(tx *sql.Tx, userItemIDs []int) error {
+	if len(userItemIDs) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(userItemIDs))
+	for i, id := range userItemIDs {
+		ids[i] = int64(id)
+	}
+	_, err := tx.Exec(`
+		DELETE FROM LedgerAllocations
+		WHERE disposal_entry_id IN (
+			SELECT entry_id FROM LedgerEntries WHERE entry_type = $1 AND user_item_id = ANY($2)
+		)
+	`, models.LedgerRemoval, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM LedgerEntries WHERE entry_type = $1 AND user_item_id = ANY($2)
+	`, models.LedgerRemoval, pq.Array(ids))
+	return err
+}
+
+// receiveUnits adds units of a copy that changed hands to the receiving
+// user's collection as a new copy, with its acquisition entry, in the
+// caller's transaction. It returns the new copy's user_item_id.
+func receiveUnits(ctx context.Context, tx *sql.Tx, userID int, collectionID int, given *models.Card, quantity int, entryType string, unitPrice float64, counterparty string, at time.Time) (int, error) {
+	var userItemID int
+	err := tx.QueryRow(`
+		INSERT INTO UserItems (collection_id, item_id, grade, purchase_price, quantity, condition, language, finish, acquired_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), $9)
+		RETURNING user_item_id
+	`, collectionID, given.ID, given.Grade, unitPrice, quantity, given.Condition, given.Language, given.Finish, at).Scan(&userItemID)
+	if err != nil {
+		log.Printf("Error receiving copy %d for user %d: %v", given.UserItemID, userID, err)
+		return 0, err
+	}
+	if err := recordAcquisition(tx, collectionID, userItemID, given.ID, entryType, quantity, unitPrice, &at, counterparty); err != nil {
+		return 0, err
+	}
+	if err := recordCopyAdded(ctx, tx, userID, collectionID, userItemID); err != nil {
+		return 0, err
+	}
+	return userItemID, nil
+}
+
+// RecordGrading records a grading submission for an owned copy. Its cost is
+// added to the basis of the copy's lots; a non-empty grade replaces the grade
+// stored on the copy.
+func RecordGrading(ctx context.Context, userID string, entry models.LedgerEntry, grade string) (*models.LedgerEntry, error) {
+	if entry.UserItemID == nil {
+		return nil, fmt.Errorf("%w: user_item_id is required", ErrInvalidLedgerEntry)
+	}
+	entry.EntryType = models.LedgerGrading
+	if entry.OccurredAt.IsZero() {
+		entry.OccurredAt = time.Now()
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var collectionID int
+	err = tx.QueryRow(`
+		SELECT ui.item_id, ui.quantity, ui.collection_id
+		FROM UserItems ui
+		JOIN Collections c ON ui.collection_id = c.collection_id
+		WHERE ui.user_item_id = $1 AND c.user_id = $2
+		AND c.deleted_at IS NULL AND ui.deleted_at IS NULL
+		FOR UPDATE OF ui
+	`, *entry.UserItemID, userID).Scan(&entry.ItemID, &entry.Quantity, &collectionID)
+	if err == sql.ErrNoRows {
+		return nil, ErrCardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	before, err := getCopy(tx, *entry.UserItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO LedgerEntries (user_id, user_item_id, item_id, entry_type, quantity, price, fees, shipping,
+			counterparty, notes, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''), $11)
+		RETURNING entry_id
+	`, userID, *entry.UserItemID, entry.ItemID, entry.EntryType, entry.Quantity, entry.Price, entry.Fees, entry.Shipping,
+		entry.Counterparty, entry.Notes, entry.OccurredAt).Scan(&entry.EntryID)
+	if err != nil {
+		log.Printf("Error inserting grading entry: %v", err)
+		return nil, err
+	}
+
+	if grade != "" {
+		if _, err := tx.Exec(`UPDATE UserItems SET grade = $1 WHERE user_item_id = $2`, grade, *entry.UserItemID); err != nil {
+			log.Printf("Error updating grade of copy %d: %v", *entry.UserItemID, err)
+			return nil, err
+		}
+	}
+	after, err := getCopy(tx, *entry.UserItemID)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordCopyChange(ctx, tx, audit.CopyGrade, userID, collectionID, *entry.UserItemID, before, after); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, err
+	}
+	return &entry, nil
+}
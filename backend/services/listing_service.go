@@ -0,0 +1,434 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/lib/pq"
+)
+
+// ErrInvalidListing is wrapped by validation errors for listing requests.
+var ErrInvalidListing = errors.New("invalid listing")
+
+var ErrListingNotFound = errors.New("listing not found")
+
+// ErrListingUnavailable is returned for listings that can't be bought or
+// changed: they were sold or withdrawn, or the seller no longer holds the
+// copy.
+var ErrListingUnavailable = errors.New("listing is no longer available")
+
+// Listing limits.
+const (
+	MaxListingPhotos          = 8
+	MaxListingShippingOptions = 5
+	MaxListingSearchLimit     = 100
+	maxListingPrice           = 99999999.99
+)
+
+// listingAvailable is true for an active listing whose seller, an active
+// user, still holds the copy in the quantity listed. Listings therefore stop
+// being for sale as soon as the copy is removed, traded or sold elsewhere,
+// and are for sale again if it is restored.
+const listingAvailable = `(l.status = 'active' AND COALESCE(u.is_active, TRUE) AND EXISTS (
+	SELECT 1 FROM UserItems ui
+	JOIN Collections c ON ui.collection_id = c.collection_id
+	WHERE ui.user_item_id = l.user_item_id AND c.user_id = l.seller_id AND ui.quantity >= l.quantity
+	AND c.deleted_at IS NULL AND ui.deleted_at IS NULL
+))`
+
+const listingColumns = `l.listing_id, l.seller_id, u.username, l.user_item_id, l.item_id, i.name, COALESCE(i.edition, ''),
+	COALESCE(i.set, ''), COALESCE(i.image, ''), l.grade, COALESCE(l.condition, ''), COALESCE(l.language, ''), COALESCE(l.finish, ''),
+	l.quantity, l.price, COALESCE(l.description, ''), l.status, ` + listingAvailable + `, l.created_at, l.updated_at, l.sold_at`
+
+const listingFrom = `
+	FROM Listings l
+	JOIN Users u ON u.user_id = l.seller_id
+	JOIN Items i ON i.item_id = l.item_id`
+
+func scanListing(row rowScanner) (models.Listing, error) {
+	var listing models.Listing
+	var soldAt sql.NullTime
+	err := row.Scan(&listing.ListingID, &listing.SellerID, &listing.Seller, &listing.UserItemID, &listing.ItemID, &listing.Name,
+		&listing.Edition, &listing.Set, &listing.Image, &listing.Grade, &listing.Condition, &listing.Language, &listing.Finish,
+		&listing.Quantity, &listing.Price, &listing.Description, &listing.Status, &listing.Available,
+		&listing.CreatedAt, &listing.UpdatedAt, &soldAt)
+	if err != nil {
+		return listing, err
+	}
+	if soldAt.Valid {
+		listing.SoldAt = &soldAt.Time
+	}
+	listing.Photos = []string{}
+	listing.ShippingOptions = []models.ShippingOption{}
+	return listing, nil
+}
+
+// queryListings runs a listing query and fills in photos and shipping
+// options.
+func queryListings(q queryer, where string, args ...interface{}) ([]models.Listing, error) {
+	rows, err := q.Query(`SELECT `+listingColumns+listingFrom+` `+where, args...)
+	if err != nil {
+		log.Printf("Error querying listings: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	listings := []models.Listing{}
+	index := make(map[int]int)
+	var ids []int64
+	for rows.Next() {
+		listing, err := scanListing(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[listing.ListingID] = len(listings)
+		ids = append(ids, int64(listing.ListingID))
+		listings = append(listings, listing)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(listings) == 0 {
+		return listings, nil
+	}
+
+	photoRows, err := q.Query(`
+		SELECT listing_id, url FROM ListingPhotos
+		WHERE listing_id = ANY($1)
+		ORDER BY listing_id, position
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer photoRows.Close()
+	for photoRows.Next() {
+		var listingID int
+		var photo string
+		if err := photoRows.Scan(&listingID, &photo); err != nil {
+			return nil, err
+		}
+		listings[index[listingID]].Photos = append(listings[index[listingID]].Photos, photo)
+	}
+	if err := photoRows.Err(); err != nil {
+		return nil, err
+	}
+
+	optionRows, err := q.Query(`
+		SELECT listing_id, option_id, name, price FROM ListingShippingOptions
+		WHERE listing_id = ANY($1)
+		ORDER BY listing_id, option_id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer optionRows.Close()
+	for optionRows.Next() {
+		var listingID int
+		var option models.ShippingOption
+		if err := optionRows.Scan(&listingID, &option.OptionID, &option.Name, &option.Price); err != nil {
+			return nil, err
+		}
+		listings[index[listingID]].ShippingOptions = append(listings[index[listingID]].ShippingOptions, option)
+	}
+	return listings, optionRows.Err()
+}
+
+func getListing(q queryer, listingID int) (*models.Listing, error) {
+	listings, err := queryListings(q, `WHERE l.listing_id = $1`, listingID)
+	if err != nil {
+		return nil, err
+	}
+	if len(listings) == 0 {
+		return nil, ErrListingNotFound
+	}
+	return &listings[0], nil
+}
+
+func GetListing(listingID int) (*models.Listing, error) {
+	return getListing(database.DB, listingID)
+}
+
+// SearchListings browses the listings that are for sale.
+func SearchListings(search models.ListingSearch) ([]models.Listing, error) {
+	if search.Limit <= 0 || search.Limit > MaxListingSearchLimit {
+		search.Limit = MaxListingSearchLimit
+	}
+	if search.Offset < 0 {
+		search.Offset = 0
+	}
+
+	order := "l.created_at DESC, l.listing_id DESC"
+	switch search.Sort {
+	case "", models.ListingSortNewest:
+	case models.ListingSortPriceAsc:
+		order = "l.price, l.listing_id"
+	case models.ListingSortPriceDesc:
+		order = "l.price DESC, l.listing_id"
+	default:
+		return nil, fmt.Errorf("%w: unknown sort %q", ErrInvalidListing, search.Sort)
+	}
+
+	return queryListings(database.DB, `
+		WHERE `+listingAvailable+`
+		AND ($1 = '' OR i.name ILIKE '%' || $1 || '%')
+		AND ($2 = '' OR l.item_id = $2)
+		AND ($3 = '' OR i.set = $3)
+		AND ($4 = '' OR l.grade = $4)
+		AND ($5 = '' OR l.condition = $5)
+		AND ($6 = '' OR LOWER(u.username) = LOWER($6))
+		AND ($7::DECIMAL = 0 OR l.price >= $7)
+		AND ($8::DECIMAL = 0 OR l.price <= $8)
+		ORDER BY `+order+`
+		LIMIT $9 OFFSET $10
+	`, strings.TrimSpace(search.Query), search.ItemID, search.Set, search.Grade, search.Condition, search.Seller,
+		search.MinPrice, search.MaxPrice, search.Limit, search.Offset)
+}
+
+// GetListingsBySeller returns all of a seller's listings, newest first,
+// including sold and withdrawn ones.
+func GetListingsBySeller(userID int) ([]models.Listing, error) {
+	return queryListings(database.DB, `WHERE l.seller_id = $1 ORDER BY l.created_at DESC, l.listing_id DESC`, userID)
+}
+
+// normalizeListingRequest validates a listing, defaulting the quantity to one
+// and rounding prices to cents.
+func normalizeListingRequest(req *models.ListingRequest) error {
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	if req.Quantity < 0 {
+		return fmt.Errorf("%w: quantity must be positive", ErrInvalidListing)
+	}
+	if !(req.Price > 0 && req.Price <= maxListingPrice) {
+		return fmt.Errorf("%w: price must be positive and at most %.2f", ErrInvalidListing, maxListingPrice)
+	}
+	req.Price = math.Round(req.Price*100) / 100
+
+	req.Description = strings.TrimSpace(req.Description)
+	if utf8.RuneCountInString(req.Description) > 2000 {
+		return fmt.Errorf("%w: description must be at most 2000 characters", ErrInvalidListing)
+	}
+
+	if len(req.Photos) > MaxListingPhotos {
+		return fmt.Errorf("%w: at most %d photos are allowed", ErrInvalidListing, MaxListingPhotos)
+	}
+	for i, photo := range req.Photos {
+		photo = strings.TrimSpace(photo)
+		parsed, err := url.Parse(photo)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" || len(photo) > 500 {
+			return fmt.Errorf("%w: photos must be http or https URLs of at most 500 characters", ErrInvalidListing)
+		}
+		req.Photos[i] = photo
+	}
+
+	if len(req.ShippingOptions) > MaxListingShippingOptions {
+		return fmt.Errorf("%w: at most %d shipping options are allowed", ErrInvalidListing, MaxListingShippingOptions)
+	}
+	for i := range req.ShippingOptions {
+		option := &req.ShippingOptions[i]
+		option.Name = strings.TrimSpace(option.Name)
+		if option.Name == "" || utf8.RuneCountInString(option.Name) > 100 {
+			return fmt.Errorf("%w: shipping options need a name of at most 100 characters", ErrInvalidListing)
+		}
+		if !(option.Price >= 0 && option.Price <= maxListingPrice) {
+			return fmt.Errorf("%w: shipping prices can't be negative", ErrInvalidListing)
+		}
+		option.Price = math.Round(option.Price*100) / 100
+	}
+	return nil
+}
+
+// saveListingDetails replaces a listing's photos and shipping options.
+func saveListingDetails(tx *sql.Tx, listingID int, req models.ListingRequest) error {
+	if _, err := tx.Exec(`DELETE FROM ListingPhotos WHERE listing_id = $1`, listingID); err != nil {
+		return err
+	}
+	for i, photo := range req.Photos {
+		_, err := tx.Exec(`INSERT INTO ListingPhotos (listing_id, url, position) VALUES ($1, $2, $3)`, listingID, photo, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM ListingShippingOptions WHERE listing_id = $1`, listingID); err != nil {
+		return err
+	}
+	for _, option := range req.ShippingOptions {
+		_, err := tx.Exec(`INSERT INTO ListingShippingOptions (listing_id, name, price) VALUES ($1, $2, $3)`, listingID, option.Name, option.Price)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockListedCopy checks the seller holds a copy in the quantity to be listed
+// and locks it.
+func lockListedCopy(tx *sql.Tx, userID int, userItemID int, quantity int) error {
+	var held int
+	err := tx.QueryRow(`
+		SELECT ui.quantity
+		FROM UserItems ui
+		JOIN Collections c ON ui.collection_id = c.collection_id
+		WHERE ui.user_item_id = $1 AND c.user_id = $2
+		AND c.deleted_at IS NULL AND ui.deleted_at IS NULL
+		FOR UPDATE OF ui
+	`, userItemID, userID).Scan(&held)
+	if err == sql.ErrNoRows {
+		return ErrCardNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if quantity > held {
+		return fmt.Errorf("%w: the copy only holds %d", ErrInvalidListing, held)
+	}
+	return nil
+}
+
+// CreateListing puts units of one of the seller's copies up for sale. A copy
+// can only be in one active listing at a time.
+func CreateListing(userID int, req models.ListingRequest) (*models.Listing, error) {
+	if err := normalizeListingRequest(&req); err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockListedCopy(tx, userID, req.UserItemID, req.Quantity); err != nil {
+		return nil, err
+	}
+	var listed bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM Listings WHERE user_item_id = $1 AND status = $2)
+	`, req.UserItemID, models.ListingActive).Scan(&listed)
+	if err != nil {
+		return nil, err
+	}
+	if listed {
+		return nil, fmt.Errorf("%w: copy %d is already listed", ErrInvalidListing, req.UserItemID)
+	}
+
+	var listingID int
+	err = tx.QueryRow(`
+		INSERT INTO Listings (seller_id, user_item_id, item_id, grade, condition, language, finish, quantity, price, description)
+		SELECT $1, ui.user_item_id, ui.item_id, ui.grade, ui.condition, ui.language, ui.finish, $3, $4, NULLIF($5, '')
+		FROM UserItems ui
+		WHERE ui.user_item_id = $2
+		RETURNING listing_id
+	`, userID, req.UserItemID, req.Quantity, req.Price, req.Description).Scan(&listingID)
+	if err != nil {
+		log.Printf("Error creating listing for copy %d: %v", req.UserItemID, err)
+		return nil, err
+	}
+	if err := saveListingDetails(tx, listingID, req); err != nil {
+		log.Printf("Error saving details of listing %d: %v", listingID, err)
+		return nil, err
+	}
+
+	listing, err := getListing(tx, listingID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("User %d listed copy %d as listing %d at %.2f", userID, req.UserItemID, listingID, req.Price)
+	return listing, nil
+}
+
+// lockSellerListing locks one of the seller's active listings.
+func lockSellerListing(tx *sql.Tx, userID int, listingID int) error {
+	var status string
+	err := tx.QueryRow(`
+		SELECT status FROM Listings WHERE listing_id = $1 AND seller_id = $2 FOR UPDATE
+	`, listingID, userID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrListingNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status != models.ListingActive {
+		return ErrListingUnavailable
+	}
+	return nil
+}
+
+// UpdateListing replaces the quantity, price, description, photos and
+// shipping options of an active listing. The listed copy can't change.
+func UpdateListing(userID int, listingID int, req models.ListingRequest) (*models.Listing, error) {
+	if err := normalizeListingRequest(&req); err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockSellerListing(tx, userID, listingID); err != nil {
+		return nil, err
+	}
+	var userItemID int
+	if err := tx.QueryRow(`SELECT user_item_id FROM Listings WHERE listing_id = $1`, listingID).Scan(&userItemID); err != nil {
+		return nil, err
+	}
+	if err := lockListedCopy(tx, userID, userItemID, req.Quantity); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE Listings SET quantity = $1, price = $2, description = NULLIF($3, ''), updated_at = CURRENT_TIMESTAMP
+		WHERE listing_id = $4
+	`, req.Quantity, req.Price, req.Description, listingID)
+	if err != nil {
+		log.Printf("Error updating listing %d: %v", listingID, err)
+		return nil, err
+	}
+	if err := saveListingDetails(tx, listingID, req); err != nil {
+		return nil, err
+	}
+
+	listing, err := getListing(tx, listingID)
+	if err != nil {
+		return nil, err
+	}
+	return listing, tx.Commit()
+}
+
+// WithdrawListing takes an active listing off the marketplace.
+func WithdrawListing(userID int, listingID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockSellerListing(tx, userID, listingID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE Listings SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE listing_id = $2
+	`, models.ListingWithdrawn, listingID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("User %d withdrew listing %d", userID, listingID)
+	return tx.Commit()
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/database"
+)
+
+// Reasons recorded for failed login attempts.
+const (
+	LoginUnknownUser = "unknown_user"
+	LoginBadPassword = "bad_password"
+	LoginLocked      = "locked"
+	LoginUnverified  = "unverified"
+	LoginInactive    = "inactive"
+	LoginRateLimited = "rate_limited"
+)
+
+// Lockout settings. After LockoutThreshold consecutive failures an account
+// is locked for LockoutBase, doubling with every further failure up to
+// LockoutMax.
+var (
+	LockoutThreshold = 5
+	LockoutBase      = time.Minute
+	LockoutMax       = 24 * time.Hour
+)
+
+// lockoutDuration returns how long to lock an account after failures
+// consecutive failed logins, or zero below the threshold.
+func lockoutDuration(failures int) time.Duration {
+	if LockoutThreshold <= 0 || failures < LockoutThreshold {
+		return 0
+	}
+	duration := LockoutBase
+	for i := LockoutThreshold; i < failures; i++ {
+		duration *= 2
+		if duration >= LockoutMax {
+			return LockoutMax
+		}
+	}
+	return duration
+}
+
+// RecordLoginAttempt adds an entry to LoginAttempts. userID is nil when no
+// account matched.
+func RecordLoginAttempt(userID *int, username string, ip string, succeeded bool, reason string) {
+	username = truncateRunes(username, 100)
+	_, err := database.DB.Exec(`
+		INSERT INTO LoginAttempts (user_id, username, ip_address, succeeded, reason)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+	`, userID, username, ip, succeeded, reason)
+	if err != nil {
+		log.Printf("Error recording login attempt for %s: %v", username, err)
+	}
+}
+
+// RecordFailedLogin counts a wrong password against an account and locks it
+// once the failures reach the threshold. It returns when the lock ends, or
+// nil if the account isn't locked.
+func RecordFailedLogin(userID int, username string, ip string) (*time.Time, error) {
+	RecordLoginAttempt(&userID, username, ip, false, LoginBadPassword)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var failures int
+	err = tx.QueryRow(`
+		UPDATE Users SET failed_logins = failed_logins + 1
+		WHERE user_id = $1
+		RETURNING failed_logins
+	`, userID).Scan(&failures)
+	if err != nil {
+		log.Printf("Error counting failed login for user %d: %v", userID, err)
+		return nil, err
+	}
+
+	var lockedUntil *time.Time
+	if duration := lockoutDuration(failures); duration > 0 {
+		until := time.Now().Add(duration)
+		if _, err := tx.Exec(`UPDATE Users SET locked_until = $1 WHERE user_id = $2`, until, userID); err != nil {
+			return nil, err
+		}
+		lockedUntil = &until
+		log.Printf("Locked user %d until %s after %d failed logins", userID, until.Format(time.RFC3339), failures)
+	}
+	return lockedUntil, tx.Commit()
+}
+
+// RecordSuccessfulLogin clears an account's failures and lock and stamps
+// last_login.
+func RecordSuccessfulLogin(userID int, username string, ip string) {
+	RecordLoginAttempt(&userID, username, ip, true, "")
+	_, err := database.DB.Exec(`
+		UPDATE Users SET failed_logins = 0, locked_until = NULL, last_login = $1
+		WHERE user_id = $2
+	`, time.Now(), userID)
+	if err != nil {
+		log.Printf("Error updating last_login: %v", err)
+	}
+}
+
+// unlockAccount clears failures and any lock, for password resets.
+func unlockAccount(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec(`UPDATE Users SET failed_logins = 0, locked_until = NULL WHERE user_id = $1`, userID)
+	return err
+}
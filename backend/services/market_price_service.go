@@ -10,45 +10,21 @@ import (
 	"time"
 
 	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
 	"github.com/PuerkitoBio/goquery"
 	_ "github.com/lib/pq"
 )
 
-func GetMarketPrice(cardName, cardId, edition, grade string) (float64, error) {
-	db := database.GetDB()
-
-	var price float64
-	var lastUpdated time.Time
-
-	err := db.QueryRow(`
-		SELECT price, last_updated
-		FROM marketdata
-		WHERE item_id = $1 OR (name = $2 AND edition = $3 AND grade = $4 AND type = 'Pokemon Card')
-	`, cardId, cardName, edition, grade).Scan(&price, &lastUpdated)
-
-	if err != nil || time.Since(lastUpdated) > 24*time.Hour {
-		// If no data found or data is older than 24 hours, fetch new price
-		newPrice, err := fetchMarketPrice(cardName, cardId, edition, grade)
-		if err != nil {
-			return 0, err
-		}
-
-		// Update or insert new price in the database
-		_, err = db.Exec(`
-			INSERT INTO marketdata (item_id, name, edition, grade, type, price, last_updated)
-			VALUES ($1, $2, $3, $4, $5, $6, $7)
-			ON CONFLICT (item_id) DO UPDATE
-			SET price = $6, last_updated = $7
-		`, cardId, cardName, edition, grade, "Pokemon Card", newPrice, time.Now())
-
-		if err != nil {
-			return 0, err
-		}
-
-		return newPrice, nil
-	}
-
-	return price, nil
+// MarketPriceQuery identifies the market a price is looked up for. Condition,
+// Language and Finish split raw cards into separately valued markets.
+type MarketPriceQuery struct {
+	Name      string
+	ID        string
+	Edition   string
+	Grade     string
+	Condition string
+	Language  string
+	Finish    string
 }
 
 func GetItemMarketPrice(itemName, itemGrade string) (float64, error) {
@@ -65,7 +41,7 @@ func GetItemMarketPrice(itemName, itemGrade string) (float64, error) {
 
 	if err != nil || time.Since(lastUpdated) > 24*time.Hour {
 		// If no data found or data is older than 24 hours, fetch new price
-		newPrice, err := fetchMarketPrice(itemName, "", "", itemGrade)
+		newPrice, err := fetchMarketPrice(MarketPriceQuery{Name: itemName, Grade: itemGrade})
 		if err != nil {
 			return 0, err
 		}
@@ -88,12 +64,25 @@ func GetItemMarketPrice(itemName, itemGrade string) (float64, error) {
 	return price, nil
 }
 
-func fetchMarketPrice(cardName, cardId, edition, grade string) (float64, error) {
+// Listing title keywords that mark a card as a non-English print.
+var foreignLanguageKeywords = []string{"japanese", "korean", "chinese", "french", "german", "italian", "spanish", "portuguese"}
+
+func fetchMarketPrice(query MarketPriceQuery) (float64, error) {
+	grade := query.Grade
+	ungraded := strings.ToLower(grade) == "ungraded"
+
 	var searchQuery string
-	if strings.ToLower(grade) == "ungraded" {
-		searchQuery = fmt.Sprintf("%s %s %s -graded -psa -bgs -cgc", cardName, cardId, edition)
+	if ungraded {
+		searchQuery = fmt.Sprintf("%s %s %s", query.Name, query.ID, query.Edition)
+		if query.Finish != "" && query.Finish != models.FinishUnlimited {
+			searchQuery += " " + query.Finish
+		}
+		if query.Language != "" && query.Language != models.DefaultLanguage {
+			searchQuery += " " + query.Language
+		}
+		searchQuery += " -graded -psa -bgs -cgc"
 	} else {
-		searchQuery = fmt.Sprintf("%s %s %s grade:%s", cardName, cardId, edition, grade)
+		searchQuery = fmt.Sprintf("%s %s %s grade:%s", query.Name, query.ID, query.Edition, grade)
 	}
 
 	url := fmt.Sprintf("https://www.ebay.com/sch/i.html?_nkw=%s&_ipg=100&_sop=13", strings.ReplaceAll(searchQuery, " ", "+"))
@@ -113,19 +102,29 @@ func fetchMarketPrice(cardName, cardId, edition, grade string) (float64, error)
 		return 0, err
 	}
 
-	var prices []float64
+	// Listings rarely state a condition, so prices from listings that do are
+	// preferred but the rest of the matching raw listings are kept as a fallback.
+	var prices, conditionPrices []float64
 	doc.Find(".s-item__wrapper").Each(func(i int, s *goquery.Selection) {
 		title := strings.ToLower(s.Find(".s-item__title").Text())
 		priceText := s.Find(".s-item__price").Text()
 
-		if strings.ToLower(grade) == "ungraded" {
+		if ungraded {
 			// For ungraded cards, exclude listings that mention grading
-			if !strings.Contains(title, "graded") && !strings.Contains(title, "psa") &&
-				!strings.Contains(title, "bgs") && !strings.Contains(title, "cgc") {
-				price := parsePrice(priceText)
-				if price > 0 {
-					prices = append(prices, price)
-				}
+			if strings.Contains(title, "graded") || strings.Contains(title, "psa") ||
+				strings.Contains(title, "bgs") || strings.Contains(title, "cgc") {
+				return
+			}
+			if !titleMatchesFinish(title, query.Finish) || !titleMatchesLanguage(title, query.Language) {
+				return
+			}
+			price := parsePrice(priceText)
+			if price <= 0 {
+				return
+			}
+			prices = append(prices, price)
+			if query.Condition != "" && titleMatchesCondition(title, query.Condition) {
+				conditionPrices = append(conditionPrices, price)
 			}
 		} else {
 			// For graded cards, include only listings that mention the specific grade
@@ -138,6 +137,10 @@ func fetchMarketPrice(cardName, cardId, edition, grade string) (float64, error)
 		}
 	})
 
+	if len(conditionPrices) > 0 {
+		return calculateAveragePrice(conditionPrices), nil
+	}
+
 	if len(prices) == 0 {
 		return 0, fmt.Errorf("market price not found for %s", grade)
 	}
@@ -145,6 +148,48 @@ func fetchMarketPrice(cardName, cardId, edition, grade string) (float64, error)
 	return calculateAveragePrice(prices), nil
 }
 
+func titleMatchesCondition(title, condition string) bool {
+	if strings.Contains(title, strings.ToLower(condition)) {
+		return true
+	}
+	abbreviation := strings.ToLower(models.ConditionAbbreviation(condition))
+	for _, word := range strings.Fields(title) {
+		if strings.Trim(word, "()[]/-,") == abbreviation {
+			return true
+		}
+	}
+	return false
+}
+
+func titleMatchesFinish(title, finish string) bool {
+	switch finish {
+	case "":
+		return true
+	case models.FinishHolo:
+		return strings.Contains(title, "holo") && !strings.Contains(title, "reverse")
+	case models.FinishReverseHolo:
+		return strings.Contains(title, "reverse")
+	case models.FinishFirstEdition:
+		return strings.Contains(title, "1st edition") || strings.Contains(title, "first edition")
+	case models.FinishUnlimited:
+		return !strings.Contains(title, "1st edition") && !strings.Contains(title, "first edition") &&
+			!strings.Contains(title, "shadowless")
+	}
+	return strings.Contains(title, strings.ToLower(finish))
+}
+
+func titleMatchesLanguage(title, language string) bool {
+	if language == "" || language == models.DefaultLanguage {
+		for _, keyword := range foreignLanguageKeywords {
+			if strings.Contains(title, keyword) {
+				return false
+			}
+		}
+		return true
+	}
+	return strings.Contains(title, strings.ToLower(language))
+}
+
 func parsePrice(priceText string) float64 {
 	priceText = strings.ReplaceAll(priceText, "$", "")
 	priceText = strings.ReplaceAll(priceText, ",", "")
@@ -166,8 +211,9 @@ func calculateAveragePrice(prices []float64) float64 {
 	return total / float64(len(prices))
 }
 
-func FetchAndStoreMarketPrice(cardName, cardId, edition, grade string) (float64, error) {
+func FetchAndStoreMarketPrice(query MarketPriceQuery) (float64, error) {
 	db := database.GetDB()
+	cardId := query.ID
 
 	var marketValue float64
 	var lastUpdated time.Time
@@ -176,10 +222,11 @@ func FetchAndStoreMarketPrice(cardName, cardId, edition, grade string) (float64,
 	err := db.QueryRow(`
 		SELECT market_value, last_updated
 		FROM marketdata
-		WHERE item_id = $1
+		WHERE item_id = $1 AND grade = $2
+		AND COALESCE(condition, '') = $3 AND COALESCE(language, '') = $4 AND COALESCE(finish, '') = $5
 		ORDER BY last_updated DESC
 		LIMIT 1
-	`, cardId).Scan(&marketValue, &lastUpdated)
+	`, cardId, query.Grade, query.Condition, query.Language, query.Finish).Scan(&marketValue, &lastUpdated)
 
 	if err != nil && err != sql.ErrNoRows {
 		log.Printf("Error querying existing market value for %s: %v", cardId, err)
@@ -188,7 +235,7 @@ func FetchAndStoreMarketPrice(cardName, cardId, edition, grade string) (float64,
 
 	if err == sql.ErrNoRows || time.Since(lastUpdated) > 24*time.Hour {
 		// Fetch new market value
-		newMarketValue, err := fetchMarketPrice(cardName, cardId, edition, grade)
+		newMarketValue, err := fetchMarketPrice(query)
 		if err != nil {
 			log.Printf("Error fetching market value for %s: %v", cardId, err)
 			return 0, err
@@ -196,15 +243,18 @@ func FetchAndStoreMarketPrice(cardName, cardId, edition, grade string) (float64,
 
 		// Insert new record
 		_, err = db.Exec(`
-			INSERT INTO marketdata (item_id, name, edition, grade, type, market_value, last_updated)
-				VALUES ($1, $2, $3, $4, $5, $6, $7)
-		`, cardId, cardName, edition, grade, "Pokemon Card", newMarketValue, time.Now())
+			INSERT INTO marketdata (item_id, name, edition, grade, type, market_value, last_updated, condition, language, finish)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''))
+		`, cardId, query.Name, query.Edition, query.Grade, "Pokemon Card", newMarketValue, time.Now(), query.Condition, query.Language, query.Finish)
 
 		if err != nil {
 			log.Printf("Error inserting new market value for %s: %v", cardId, err)
 			return 0, err
 		}
 
+		// A failed want evaluation shouldn't fail the price lookup
+		evaluateWants(query, newMarketValue)
+
 		return newMarketValue, nil
 	}
 
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/notify"
+)
+
+// notifyTimeout bounds a background notification, webhook retries included.
+const notifyTimeout = 2 * time.Minute
+
+var (
+	notifierMu sync.RWMutex
+	notifier   notify.Notifier = notify.Noop{}
+)
+
+// SetNotifier sets where user notifications are delivered. Until it is
+// called they are discarded.
+func SetNotifier(n notify.Notifier) {
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+	notifier = n
+}
+
+func currentNotifier() notify.Notifier {
+	notifierMu.RLock()
+	defer notifierMu.RUnlock()
+	return notifier
+}
+
+// NotifyUser delivers a message to a user, filling in their email address.
+func NotifyUser(ctx context.Context, userID int, msg notify.Message) error {
+	msg.UserID = userID
+	if msg.To == "" {
+		err := database.DB.QueryRowContext(ctx, `SELECT email FROM Users WHERE user_id = $1`, userID).Scan(&msg.To)
+		if err != nil {
+			log.Printf("Error looking up email for user %d: %v", userID, err)
+			return err
+		}
+	}
+	if msg.SentAt.IsZero() {
+		msg.SentAt = time.Now().UTC()
+	}
+	return currentNotifier().Notify(ctx, msg)
+}
+
+// notifyUserAsync sends a notification in the background so slow channels
+// don't hold up the request that caused it. Failures are only logged.
+func notifyUserAsync(userID int, msg notify.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		if err := NotifyUser(ctx, userID, msg); err != nil {
+			log.Printf("Error sending %s notification to user %d: %v", msg.Event, userID, err)
+		}
+	}()
+}
+
+// notifyPriceAlerts tells each user about their newly raised alerts.
+func notifyPriceAlerts(alerts []models.PriceAlert) {
+	for _, alert := range alerts {
+		notifyUserAsync(alert.UserID, notify.Message{
+			Event:   notify.EventPriceAlert,
+			Subject: fmt.Sprintf("Price alert: %s is now $%.2f", alert.Name, alert.Price),
+			Body: fmt.Sprintf("%s (%s) is available at $%.2f, at or below your max price of $%.2f.",
+				alert.Name, alert.ItemID, alert.Price, alert.MaxPrice),
+			Data: map[string]interface{}{
+				"alert_id":  alert.AlertID,
+				"want_id":   alert.WantID,
+				"item_id":   alert.ItemID,
+				"grade":     alert.Grade,
+				"price":     alert.Price,
+				"max_price": alert.MaxPrice,
+			},
+		})
+	}
+}
+
+// WebhookDeliveryLog records webhook delivery attempts in WebhookDeliveries.
+type WebhookDeliveryLog struct{}
+
+func (WebhookDeliveryLog) RecordDelivery(delivery notify.Delivery) error {
+	_, err := database.DB.Exec(`
+		INSERT INTO WebhookDeliveries (delivery_id, event, url, attempt, status_code, error, succeeded, attempted_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), NULLIF($6, ''), $7, $8)
+	`, delivery.DeliveryID, delivery.Event, delivery.URL, delivery.Attempt, delivery.StatusCode, delivery.Error, delivery.Succeeded, delivery.AttemptAt)
+	return err
+}
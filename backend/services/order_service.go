@@ -0,0 +1,439 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/notify"
+	"github.com/lib/pq"
+)
+
+// ErrInvalidOrder is wrapped by validation errors for checkouts and order
+// updates.
+var ErrInvalidOrder = errors.New("invalid order")
+
+var ErrOrderNotFound = errors.New("order not found")
+
+// ErrOrderState is returned when an order can't move to the requested
+// status from its current one.
+var ErrOrderState = errors.New("order can't change to that status")
+
+const orderColumns = `o.order_id, o.buyer_id, b.username, o.seller_id, COALESCE(s.username, ''), o.status,
+	o.subtotal, o.shipping, o.created_at, o.updated_at`
+
+const orderFrom = `
+	FROM Orders o
+	JOIN Users b ON b.user_id = o.buyer_id
+	LEFT JOIN Users s ON s.user_id = o.seller_id`
+
+// queryOrders runs an order query and fills in the order items.
+func queryOrders(q queryer, where string, args ...interface{}) ([]models.Order, error) {
+	rows, err := q.Query(`SELECT `+orderColumns+orderFrom+` `+where, args...)
+	if err != nil {
+		log.Printf("Error querying orders: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []models.Order{}
+	index := make(map[int]int)
+	var ids []int64
+	for rows.Next() {
+		var order models.Order
+		var sellerID sql.NullInt64
+		err := rows.Scan(&order.OrderID, &order.BuyerID, &order.Buyer, &sellerID, &order.Seller, &order.Status,
+			&order.Subtotal, &order.Shipping, &order.CreatedAt, &order.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		order.SellerID = nullIntPtr(sellerID)
+		order.Total = math.Round((order.Subtotal+order.Shipping)*100) / 100
+		order.Items = []models.OrderItem{}
+		index[order.OrderID] = len(orders)
+		ids = append(ids, int64(order.OrderID))
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return orders, nil
+	}
+
+	itemRows, err := q.Query(`
+		SELECT order_id, listing_id, product_id, name, COALESCE(image, ''), quantity, price,
+			COALESCE(shipping_option, ''), shipping_price, user_item_id
+		FROM OrderItems
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, order_item_id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		var orderID int
+		var item models.OrderItem
+		var listingID, productID, userItemID sql.NullInt64
+		err := itemRows.Scan(&orderID, &listingID, &productID, &item.Name, &item.Image, &item.Quantity, &item.Price,
+			&item.ShippingOption, &item.ShippingPrice, &userItemID)
+		if err != nil {
+			return nil, err
+		}
+		item.ListingID = nullIntPtr(listingID)
+		item.ProductID = nullIntPtr(productID)
+		item.UserItemID = nullIntPtr(userItemID)
+		orders[index[orderID]].Items = append(orders[index[orderID]].Items, item)
+	}
+	return orders, itemRows.Err()
+}
+
+// redactOrders hides the buyer's copies from everyone but the buyer.
+func redactOrders(orders []models.Order, userID int) {
+	for i := range orders {
+		if orders[i].BuyerID == userID {
+			continue
+		}
+		for j := range orders[i].Items {
+			orders[i].Items[j].UserItemID = nil
+		}
+	}
+}
+
+// GetOrders returns the orders a user bought or sold, newest first.
+func GetOrders(userID int) ([]models.Order, error) {
+	orders, err := queryOrders(database.DB, `
+		WHERE o.buyer_id = $1 OR o.seller_id = $1
+		ORDER BY o.created_at DESC, o.order_id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	redactOrders(orders, userID)
+	return orders, nil
+}
+
+// GetOrder returns an order the user bought or sold.
+func GetOrder(userID int, orderID int) (*models.Order, error) {
+	orders, err := queryOrders(database.DB, `
+		WHERE o.order_id = $1 AND (o.buyer_id = $2 OR o.seller_id = $2)
+	`, orderID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, ErrOrderNotFound
+	}
+	redactOrders(orders, userID)
+	return &orders[0], nil
+}
+
+// normalizeCheckoutLines validates a cart being checked out and sorts its
+// listings by ID, so concurrent checkouts lock them in the same order.
+func normalizeCheckoutLines(lines []models.CheckoutLine) error {
+	if len(lines) == 0 {
+		return fmt.Errorf("%w: the cart is empty", ErrInvalidOrder)
+	}
+	seen := make(map[int]bool)
+	for _, line := range lines {
+		if (line.ListingID == 0) == (line.ProductID == 0) {
+			return fmt.Errorf("%w: each line needs a listing or a product", ErrInvalidOrder)
+		}
+		if line.ListingID != 0 {
+			if seen[line.ListingID] {
+				return fmt.Errorf("%w: listing %d is in the cart twice", ErrInvalidOrder, line.ListingID)
+			}
+			seen[line.ListingID] = true
+			continue
+		}
+		if line.Quantity <= 0 || line.UnitPrice < 0 {
+			return fmt.Errorf("%w: product %d needs a positive quantity", ErrInvalidOrder, line.ProductID)
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].ListingID < lines[j].ListingID
+	})
+	return nil
+}
+
+// listingShipping returns the shipping option chosen for a listing. A
+// listing with shipping options needs one of them chosen.
+func listingShipping(listing *models.Listing, optionID int) (*models.ShippingOption, error) {
+	if len(listing.ShippingOptions) == 0 {
+		if optionID != 0 {
+			return nil, fmt.Errorf("%w: listing %d has no shipping options", ErrInvalidOrder, listing.ListingID)
+		}
+		return nil, nil
+	}
+	for i := range listing.ShippingOptions {
+		if listing.ShippingOptions[i].OptionID == optionID {
+			return &listing.ShippingOptions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: choose a shipping option for listing %d", ErrInvalidOrder, listing.ListingID)
+}
+
+// Checkout buys a cart in one transaction, placing one order per seller and
+// one for shop products. Each listed copy leaves its seller as a sale at the
+// asking price and, when collectionID is given, arrives in that collection
+// of the buyer's as a new copy bought at that price. If any listing is no
+// longer available nothing is bought.
+func Checkout(ctx context.Context, buyerID int, lines []models.CheckoutLine, collectionID *int) ([]models.Order, error) {
+	if err := normalizeCheckoutLines(lines); err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var buyer string
+	if err := tx.QueryRow(`SELECT username FROM Users WHERE user_id = $1`, buyerID).Scan(&buyer); err != nil {
+		log.Printf("Error looking up buyer %d: %v", buyerID, err)
+		return nil, err
+	}
+	if collectionID != nil {
+		if err := lockCollection(tx, strconv.Itoa(buyerID), *collectionID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Orders by seller; shop products go to seller 0
+	orderIDs := make(map[int]int)
+	var placed []int64
+	orderFor := func(sellerID int) (int, error) {
+		if orderID, ok := orderIDs[sellerID]; ok {
+			return orderID, nil
+		}
+		var orderID int
+		err := tx.QueryRow(`
+			INSERT INTO Orders (buyer_id, seller_id, status) VALUES ($1, $2, $3) RETURNING order_id
+		`, buyerID, sql.NullInt64{Int64: int64(sellerID), Valid: sellerID != 0}, models.OrderPlaced).Scan(&orderID)
+		if err != nil {
+			log.Printf("Error placing order for buyer %d: %v", buyerID, err)
+			return 0, err
+		}
+		orderIDs[sellerID] = orderID
+		placed = append(placed, int64(orderID))
+		return orderID, nil
+	}
+
+	now := time.Now()
+	for _, line := range lines {
+		if line.ProductID != 0 {
+			orderID, err := orderFor(0)
+			if err != nil {
+				return nil, err
+			}
+			_, err = tx.Exec(`
+				INSERT INTO OrderItems (order_id, product_id, name, image, quantity, price)
+				VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)
+			`, orderID, line.ProductID, line.Name, line.Image, line.Quantity, math.Round(line.UnitPrice*float64(line.Quantity)*100)/100)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var status string
+		err := tx.QueryRow(`SELECT status FROM Listings WHERE listing_id = $1 FOR UPDATE`, line.ListingID).Scan(&status)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %d", ErrListingNotFound, line.ListingID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		listing, err := getListing(tx, line.ListingID)
+		if err != nil {
+			return nil, err
+		}
+		if !listing.Available {
+			return nil, fmt.Errorf("%w: listing %d", ErrListingUnavailable, listing.ListingID)
+		}
+		if listing.SellerID == buyerID {
+			return nil, fmt.Errorf("%w: listing %d is your own", ErrInvalidOrder, listing.ListingID)
+		}
+		shipping, err := listingShipping(listing, line.ShippingOptionID)
+		if err != nil {
+			return nil, err
+		}
+
+		orderID, err := orderFor(listing.SellerID)
+		if err != nil {
+			return nil, err
+		}
+		unitPrice := listing.Price / float64(listing.Quantity)
+		userItemID := listing.UserItemID
+		entry := models.LedgerEntry{
+			UserItemID:   &userItemID,
+			EntryType:    models.LedgerSell,
+			Quantity:     listing.Quantity,
+			Price:        unitPrice,
+			Counterparty: buyer,
+			Notes:        fmt.Sprintf("Order #%d", orderID),
+			OccurredAt:   now,
+		}
+		given, err := disposeUnits(ctx, tx, strconv.Itoa(listing.SellerID), &entry, models.CostBasisFIFO, nil)
+		if errors.Is(err, ErrCardNotFound) || errors.Is(err, ErrInsufficientQuantity) {
+			return nil, fmt.Errorf("%w: listing %d", ErrListingUnavailable, listing.ListingID)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var received sql.NullInt64
+		if collectionID != nil {
+			id, err := receiveUnits(ctx, tx, buyerID, *collectionID, given, listing.Quantity,
+				models.LedgerBuy, unitPrice, listing.Seller, now)
+			if err != nil {
+				return nil, err
+			}
+			received = sql.NullInt64{Int64: int64(id), Valid: true}
+		}
+
+		var shippingName string
+		var shippingPrice float64
+		if shipping != nil {
+			shippingName, shippingPrice = shipping.Name, shipping.Price
+		}
+		_, err = tx.Exec(`
+			INSERT INTO OrderItems (order_id, listing_id, name, image, quantity, price, shipping_option, shipping_price, user_item_id)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, NULLIF($7, ''), $8, $9)
+		`, orderID, listing.ListingID, listing.Name, listing.Image, listing.Quantity, listing.Price, shippingName, shippingPrice, received)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(`
+			UPDATE Listings SET status = $1, sold_at = $2, updated_at = $2 WHERE listing_id = $3
+		`, models.ListingSold, now, listing.ListingID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE Orders o SET
+			subtotal = (SELECT COALESCE(SUM(price), 0) FROM OrderItems WHERE order_id = o.order_id),
+			shipping = (SELECT COALESCE(SUM(shipping_price), 0) FROM OrderItems WHERE order_id = o.order_id)
+		WHERE o.order_id = ANY($1)
+	`, pq.Array(placed))
+	if err != nil {
+		return nil, err
+	}
+	orders, err := queryOrders(tx, `WHERE o.order_id = ANY($1) ORDER BY o.order_id`, pq.Array(placed))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing checkout for buyer %d: %v", buyerID, err)
+		return nil, err
+	}
+
+	for _, order := range orders {
+		log.Printf("User %d placed order %d for %.2f", buyerID, order.OrderID, order.Total)
+		notifyOrder(&order, buyerID, "order placed")
+		if order.SellerID != nil {
+			notifyOrder(&order, *order.SellerID, buyer+" bought your listing")
+		}
+	}
+	return orders, nil
+}
+
+// UpdateOrderStatus moves an order along. Only the seller can mark it
+// shipped, and only the buyer can mark it delivered.
+func UpdateOrderStatus(userID int, orderID int, status string) (*models.Order, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var buyerID int
+	var sellerID sql.NullInt64
+	var current string
+	err = tx.QueryRow(`
+		SELECT buyer_id, seller_id, status FROM Orders
+		WHERE order_id = $1 AND (buyer_id = $2 OR seller_id = $2)
+		FOR UPDATE
+	`, orderID, userID).Scan(&buyerID, &sellerID, &current)
+	if err == sql.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	isSeller := sellerID.Valid && int(sellerID.Int64) == userID
+
+	switch status {
+	case models.OrderShipped:
+		if !isSeller {
+			return nil, fmt.Errorf("%w: only the seller can mark an order shipped", ErrInvalidOrder)
+		}
+		if current != models.OrderPlaced {
+			return nil, ErrOrderState
+		}
+	case models.OrderDelivered:
+		if buyerID != userID {
+			return nil, fmt.Errorf("%w: only the buyer can mark an order delivered", ErrInvalidOrder)
+		}
+		if current != models.OrderPlaced && current != models.OrderShipped {
+			return nil, ErrOrderState
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidOrder, status)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE Orders SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE order_id = $2
+	`, status, orderID)
+	if err != nil {
+		log.Printf("Error updating order %d to %s: %v", orderID, status, err)
+		return nil, err
+	}
+	orders, err := queryOrders(tx, `WHERE o.order_id = $1`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	order := &orders[0]
+	log.Printf("User %d marked order %d %s", userID, orderID, status)
+	if isSeller {
+		notifyOrder(order, buyerID, "order "+status)
+	} else if order.SellerID != nil {
+		notifyOrder(order, *order.SellerID, "order "+status)
+	}
+	redactOrders(orders, userID)
+	return order, nil
+}
+
+// notifyOrder tells a party about a change to an order.
+func notifyOrder(order *models.Order, userID int, subject string) {
+	seller := order.Seller
+	if order.SellerID == nil {
+		seller = "the shop"
+	}
+	notifyUserAsync(userID, notify.Message{
+		Event:   notify.EventOrderStatus,
+		Subject: fmt.Sprintf("Order #%d: %s", order.OrderID, subject),
+		Body: fmt.Sprintf("%s's order of %d items from %s for $%.2f is now %s.",
+			order.Buyer, len(order.Items), seller, order.Total, order.Status),
+		Data: map[string]interface{}{
+			"order_id": order.OrderID,
+			"status":   order.Status,
+		},
+	})
+}
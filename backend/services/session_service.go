@@ -0,0 +1,155 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/google/uuid"
+)
+
+// ErrInvalidRefreshToken is returned for refresh tokens that are unknown,
+// expired or revoked.
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// RefreshTokenTTL is how long a session lasts without being refreshed.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func newRefreshToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// StartSession issues the first refresh token of a new session. Every token
+// rotated from it shares its family_id.
+func StartSession(userID int) (string, error) {
+	token, err := newRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = database.DB.Exec(`
+		INSERT INTO RefreshTokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, uuid.New().String(), hashToken(token), time.Now().Add(RefreshTokenTTL))
+	if err != nil {
+		log.Printf("Error starting session for user %d: %v", userID, err)
+		return "", err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken exchanges a live refresh token for a new one in the same
+// session. Presenting a token that was already rotated means it leaked, so
+// the whole session is revoked.
+func RotateRefreshToken(token string) (int, string, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	var tokenID, userID int
+	var familyID string
+	var expiresAt time.Time
+	var revokedAt, rotatedAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT token_id, user_id, family_id, expires_at, revoked_at, rotated_at
+		FROM RefreshTokens WHERE token_hash = $1
+		FOR UPDATE
+	`, hashToken(token)).Scan(&tokenID, &userID, &familyID, &expiresAt, &revokedAt, &rotatedAt)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	if rotatedAt.Valid && !revokedAt.Valid {
+		log.Printf("Refresh token %d reused; revoking session %s for user %d", tokenID, familyID, userID)
+		if _, err := tx.Exec(`
+			UPDATE RefreshTokens SET revoked_at = CURRENT_TIMESTAMP
+			WHERE family_id = $1 AND revoked_at IS NULL
+		`, familyID); err != nil {
+			return 0, "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, "", err
+		}
+		return 0, "", ErrInvalidRefreshToken
+	}
+	if revokedAt.Valid || rotatedAt.Valid || time.Now().After(expiresAt) {
+		return 0, "", ErrInvalidRefreshToken
+	}
+
+	newToken, err := newRefreshToken()
+	if err != nil {
+		return 0, "", err
+	}
+	if _, err := tx.Exec(`UPDATE RefreshTokens SET rotated_at = CURRENT_TIMESTAMP WHERE token_id = $1`, tokenID); err != nil {
+		return 0, "", err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO RefreshTokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, familyID, hashToken(newToken), time.Now().Add(RefreshTokenTTL))
+	if err != nil {
+		return 0, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, "", err
+	}
+	return userID, newToken, nil
+}
+
+// EndSession revokes the session a refresh token belongs to. Unknown tokens
+// are ignored so logout always succeeds.
+func EndSession(token string) error {
+	_, err := database.DB.Exec(`
+		UPDATE RefreshTokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE family_id = (SELECT family_id FROM RefreshTokens WHERE token_hash = $1)
+		AND revoked_at IS NULL
+	`, hashToken(token))
+	return err
+}
+
+// RevokeAllSessions revokes every refresh token a user has. Access tokens
+// already issued stay valid until they expire.
+func RevokeAllSessions(userID string) error {
+	if err := revokeAllSessions(database.DB, userID); err != nil {
+		log.Printf("Error revoking sessions for user %s: %v", userID, err)
+		return err
+	}
+	log.Printf("Revoked all sessions for user %s", userID)
+	return nil
+}
+
+func revokeAllSessions(db execer, userID interface{}) error {
+	_, err := db.Exec(`
+		UPDATE RefreshTokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID)
+	return err
+}
+
+// GetUsername returns the username for an active user. Deactivated users
+// are reported as not found.
+func GetUsername(userID int) (string, error) {
+	var username string
+	err := database.DB.QueryRow(`SELECT username FROM Users WHERE user_id = $1 AND COALESCE(is_active, TRUE)`, userID).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	return username, err
+}
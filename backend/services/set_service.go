@@ -0,0 +1,194 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/lib/pq"
+	"github.com/patrickmn/go-cache"
+)
+
+// ErrSetNotFound is returned when the TCG API has no cards for a set ID.
+var ErrSetNotFound = errors.New("set not found")
+
+// setPageSize is the largest page the TCG API serves.
+const setPageSize = 250
+
+// variantPrintings maps the TCGplayer price keys that mark a separately
+// collectable print to the finish recorded on owned copies.
+var variantPrintings = map[string]string{
+	"reverseHolofoil":    models.FinishReverseHolo,
+	"1stEdition":         models.FinishFirstEdition,
+	"1stEditionNormal":   models.FinishFirstEdition,
+	"1stEditionHolofoil": models.FinishFirstEdition,
+}
+
+// FetchSetCards returns every card in a set in collector number order,
+// following the API's pagination. Set lists are cached.
+func FetchSetCards(apiKey string, setID string) ([]catalogCard, error) {
+	cacheKey := "set:" + setID
+	if cached, found := cardCache.Get(cacheKey); found {
+		return cached.([]catalogCard), nil
+	}
+
+	var cards []catalogCard
+	for page := 1; ; page++ {
+		apiURL := fmt.Sprintf("https://api.pokemontcg.io/v2/cards?q=%s&page=%d&pageSize=%d",
+			url.QueryEscape(fmt.Sprintf(`set.id:"%s"`, quoteQueryTerm(setID))), page, setPageSize)
+		log.Printf("FetchSetCards: API URL: %s", apiURL)
+
+		req, _ := http.NewRequest("GET", apiURL, nil)
+		req.Header.Set("X-Api-Key", apiKey)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			log.Printf("FetchSetCards: Error making request: %v", err)
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			log.Printf("FetchSetCards: Received non-200 response code: %d, Body: %s", resp.StatusCode, string(body))
+			return nil, fmt.Errorf("received non-200 response code: %d", resp.StatusCode)
+		}
+
+		var result struct {
+			Data       []catalogCard `json:"data"`
+			TotalCount int           `json:"totalCount"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		cards = append(cards, result.Data...)
+		if len(result.Data) == 0 || len(cards) >= result.TotalCount {
+			break
+		}
+	}
+
+	if len(cards) == 0 {
+		return nil, ErrSetNotFound
+	}
+
+	sort.SliceStable(cards, func(i, j int) bool { return lessCardNumber(cards[i].Number, cards[j].Number) })
+	cardCache.Set(cacheKey, cards, cache.DefaultExpiration)
+	return cards, nil
+}
+
+// lessCardNumber orders collector numbers numerically where they are numbers
+// and after them otherwise ("TG01", "SV001").
+func lessCardNumber(a, b string) bool {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return na < nb
+	case errA == nil:
+		return true
+	case errB == nil:
+		return false
+	}
+	return a < b
+}
+
+// GetSetProgress compares a user's live copies across all collections with a
+// set's card list. With variants, reverse holo and 1st edition prints are
+// separate slots that only a copy with that finish fills; the base slot is
+// filled by any other copy.
+func GetSetProgress(apiKey string, userID string, setID string, variants bool) (*models.SetProgress, error) {
+	cards, err := FetchSetCards(apiKey, setID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(cards))
+	for i, card := range cards {
+		ids[i] = card.ID
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT DISTINCT ui.item_id, COALESCE(ui.finish, '')
+		FROM UserItems ui
+		JOIN Collections c ON ui.collection_id = c.collection_id
+		WHERE c.user_id = $1 AND ui.item_id = ANY($2)
+		AND c.deleted_at IS NULL AND ui.deleted_at IS NULL
+	`, userID, pq.Array(ids))
+	if err != nil {
+		log.Printf("Error querying owned cards for set %s: %v", setID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	owned := make(map[string]map[string]bool)
+	for rows.Next() {
+		var itemID, finish string
+		if err := rows.Scan(&itemID, &finish); err != nil {
+			return nil, err
+		}
+		if owned[itemID] == nil {
+			owned[itemID] = make(map[string]bool)
+		}
+		owned[itemID][finish] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	progress := &models.SetProgress{SetID: setID, SetName: cards[0].Set.Name, Variants: variants, Missing: []models.MissingCard{}}
+	for _, card := range cards {
+		slots := []string{""}
+		if variants {
+			seen := make(map[string]bool)
+			for key := range card.TCGPlayer.Prices {
+				if finish, ok := variantPrintings[key]; ok && !seen[finish] {
+					seen[finish] = true
+					slots = append(slots, finish)
+				}
+			}
+			sort.Strings(slots[1:])
+		}
+
+		for _, slot := range slots {
+			progress.Total++
+			if ownsSlot(owned[card.ID], slot, variants) {
+				progress.Owned++
+				continue
+			}
+			progress.Missing = append(progress.Missing, models.MissingCard{
+				ID:      card.ID,
+				Number:  card.Number,
+				Name:    card.Name,
+				Image:   card.Images.Small,
+				Variant: slot,
+			})
+		}
+	}
+	if progress.Total > 0 {
+		progress.Percent = float64(progress.Owned) * 100 / float64(progress.Total)
+	}
+	return progress, nil
+}
+
+func ownsSlot(finishes map[string]bool, slot string, variants bool) bool {
+	if slot != "" {
+		return finishes[slot]
+	}
+	for finish := range finishes {
+		if !variants || (finish != models.FinishReverseHolo && finish != models.FinishFirstEdition) {
+			return true
+		}
+	}
+	return false
+}
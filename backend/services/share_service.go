@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/CatsMeow492/PokemonCollection/audit"
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+// ErrInvalidVisibility is returned for visibilities other than private,
+// unlisted and public.
+var ErrInvalidVisibility = errors.New("visibility must be private, unlisted or public")
+
+func validVisibility(visibility string) bool {
+	switch visibility {
+	case models.VisibilityPrivate, models.VisibilityUnlisted, models.VisibilityPublic:
+		return true
+	}
+	return false
+}
+
+// newShareSlug returns a random slug for a share link, long enough that
+// links can't be guessed.
+func newShareSlug() (string, error) {
+	raw := make([]byte, 12)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// SetCollectionVisibility shares or unshares a collection. A collection gets
+// a share slug when it is first shared and keeps it between unlisted and
+// public; making it private drops the slug so old links stop working for
+// good. rotateSlug replaces the slug of a shared collection, for when a link
+// went further than intended.
+func SetCollectionVisibility(ctx context.Context, userID string, collectionID int, visibility string, rotateSlug bool) (*models.Collection, error) {
+	if !validVisibility(visibility) {
+		return nil, ErrInvalidVisibility
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockCollection(tx, userID, collectionID); err != nil {
+		return nil, err
+	}
+
+	collection := &models.Collection{CollectionID: collectionID}
+	var oldVisibility string
+	err = tx.QueryRow(`
+		SELECT collection_name, visibility, COALESCE(share_slug, '') FROM Collections WHERE collection_id = $1
+	`, collectionID).Scan(&collection.CollectionName, &oldVisibility, &collection.ShareSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case visibility == models.VisibilityPrivate:
+		collection.ShareSlug = ""
+	case collection.ShareSlug == "" || rotateSlug:
+		if collection.ShareSlug, err = newShareSlug(); err != nil {
+			return nil, err
+		}
+	}
+	collection.Visibility = visibility
+
+	_, err = tx.Exec(`
+		UPDATE Collections SET visibility = $1, share_slug = NULLIF($2, '') WHERE collection_id = $3
+	`, visibility, collection.ShareSlug, collectionID)
+	if err != nil {
+		log.Printf("Error setting visibility of collection %d: %v", collectionID, err)
+		return nil, err
+	}
+	err = recordCollectionChange(ctx, tx, audit.CollectionShare, userID, collectionID,
+		&collectionAuditState{CollectionName: collection.CollectionName, Visibility: oldVisibility},
+		&collectionAuditState{CollectionName: collection.CollectionName, Visibility: visibility})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Set collection %d of user %s to %s", collectionID, userID, visibility)
+	return collection, nil
+}
+
+// GetPublicCollection returns the shared collection with the given slug,
+// redacted for anyone to see. Private and deleted collections, and those of
+// deactivated users, are not found.
+func GetPublicCollection(slug string) (*models.PublicCollection, error) {
+	var userID string
+	var collectionID int
+	public := &models.PublicCollection{Slug: slug, Cards: []models.PublicCard{}}
+	err := database.DB.QueryRow(`
+		SELECT c.user_id, c.collection_id, c.visibility,
+			CASE WHEN COALESCE(p.public_profile, FALSE) THEN u.username ELSE '' END
+		FROM Collections c
+		JOIN Users u ON u.user_id = c.user_id
+		LEFT JOIN UserPreferences p ON p.user_id = c.user_id
+		WHERE c.share_slug = $1 AND c.visibility <> $2 AND c.deleted_at IS NULL
+			AND COALESCE(u.is_active, TRUE)
+	`, slug, models.VisibilityPrivate).Scan(&userID, &collectionID, &public.Visibility, &public.Owner)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrCollectionNotFound, slug)
+	}
+	if err != nil {
+		log.Printf("Error looking up shared collection %s: %v", slug, err)
+		return nil, err
+	}
+
+	collection, err := GetCollectionByID(userID, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	public.CollectionName = collection.CollectionName
+	for _, card := range collection.Cards {
+		public.Cards = append(public.Cards, models.PublicCard{
+			ID:        card.ID,
+			Name:      card.Name,
+			Edition:   card.Edition,
+			Set:       card.Set,
+			Image:     card.Image,
+			Type:      card.Type,
+			Grade:     card.Grade,
+			Quantity:  card.Quantity,
+			Condition: card.Condition,
+			Language:  card.Language,
+			Finish:    card.Finish,
+		})
+	}
+	return public, nil
+}
+
+// GetPublicCollections lists the public collections on a user's profile. It
+// returns ErrUserNotFound unless the user is active and has made their
+// profile public.
+func GetPublicCollections(username string) ([]models.PublicCollectionSummary, error) {
+	var userID int
+	err := database.DB.QueryRow(`
+		SELECT u.user_id
+		FROM Users u
+		JOIN UserPreferences p ON p.user_id = u.user_id
+		WHERE LOWER(u.username) = LOWER($1) AND p.public_profile AND COALESCE(u.is_active, TRUE)
+	`, username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT c.share_slug, c.collection_name, COALESCE(SUM(ui.quantity), 0)
+		FROM Collections c
+		LEFT JOIN UserItems ui ON ui.collection_id = c.collection_id AND ui.deleted_at IS NULL
+		WHERE c.user_id = $1 AND c.visibility = $2 AND c.deleted_at IS NULL
+		GROUP BY c.collection_id
+		ORDER BY c.collection_name
+	`, userID, models.VisibilityPublic)
+	if err != nil {
+		log.Printf("Error querying public collections for user %d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []models.PublicCollectionSummary{}
+	for rows.Next() {
+		var collection models.PublicCollectionSummary
+		if err := rows.Scan(&collection.Slug, &collection.CollectionName, &collection.CardCount); err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+	return collections, rows.Err()
+}
@@ -0,0 +1,681 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"github.com/CatsMeow492/PokemonCollection/notify"
+)
+
+// ErrInvalidTrade is wrapped by validation errors for trade requests.
+var ErrInvalidTrade = errors.New("invalid trade")
+
+var ErrTradeNotFound = errors.New("trade not found")
+
+// ErrTradeState is returned for actions the trade's state, or the caller's
+// part in it, doesn't allow.
+var ErrTradeState = errors.New("the trade can't do that in its current state")
+
+// ErrTradeUnavailable is returned when a copy in a trade is no longer held in
+// the quantity offered.
+var ErrTradeUnavailable = errors.New("a copy in the trade is no longer available")
+
+// ErrTradeUnvalued is returned when completing a trade with a copy that has
+// no market value to change hands at.
+var ErrTradeUnvalued = errors.New("a copy in the trade has no market value")
+
+// MaxTradeItems caps how many copies one offer can include.
+const MaxTradeItems = 50
+
+// maxTradeCash matches Trades.cash_amount.
+const maxTradeCash = 99999999.99
+
+// tradeItemValue is the market value per unit of a TradeItems row ti: the
+// latest price for the same card and grade, preferring prices for the same
+// condition, language and finish. Grades are compared ignoring case, since
+// fetched prices store them lower-cased.
+const tradeItemValue = `(
+	SELECT COALESCE(md.market_value, md.price) FROM MarketData md
+	WHERE md.item_id = ti.item_id AND LOWER(COALESCE(md.grade, '')) = LOWER(COALESCE(ti.grade, ''))
+	AND COALESCE(md.market_value, md.price) IS NOT NULL
+	ORDER BY COALESCE(md.condition, '') = COALESCE(ti.condition, '') DESC,
+		COALESCE(md.language, '') = COALESCE(ti.language, '') DESC,
+		COALESCE(md.finish, '') = COALESCE(ti.finish, '') DESC,
+		md.last_updated DESC
+	LIMIT 1
+)`
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// loadTrade reads a trade with both sides and their estimated values.
+func loadTrade(q queryer, tradeID int) (*models.Trade, error) {
+	trade := &models.Trade{}
+	var awaitingUserID, proposerCollectionID, recipientCollectionID sql.NullInt64
+	var completedAt sql.NullTime
+	var cash float64
+	err := q.QueryRow(`
+		SELECT t.trade_id, t.status, t.awaiting_user_id, COALESCE(t.message, ''), t.cash_amount,
+			t.proposer_id, p.username, t.proposer_collection_id,
+			t.recipient_id, r.username, t.recipient_collection_id,
+			t.created_at, t.updated_at, t.completed_at
+		FROM Trades t
+		JOIN Users p ON p.user_id = t.proposer_id
+		JOIN Users r ON r.user_id = t.recipient_id
+		WHERE t.trade_id = $1
+	`, tradeID).Scan(&trade.TradeID, &trade.Status, &awaitingUserID, &trade.Message, &cash,
+		&trade.Proposer.UserID, &trade.Proposer.Username, &proposerCollectionID,
+		&trade.Recipient.UserID, &trade.Recipient.Username, &recipientCollectionID,
+		&trade.CreatedAt, &trade.UpdatedAt, &completedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrTradeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	trade.AwaitingUserID = nullIntPtr(awaitingUserID)
+	trade.Proposer.CollectionID = nullIntPtr(proposerCollectionID)
+	trade.Recipient.CollectionID = nullIntPtr(recipientCollectionID)
+	if completedAt.Valid {
+		trade.CompletedAt = &completedAt.Time
+	}
+	if cash > 0 {
+		trade.Proposer.Cash = cash
+	} else {
+		trade.Recipient.Cash = -cash
+	}
+	trade.Proposer.EstimatedValue = trade.Proposer.Cash
+	trade.Recipient.EstimatedValue = trade.Recipient.Cash
+	trade.Proposer.Items = []models.TradeItem{}
+	trade.Recipient.Items = []models.TradeItem{}
+
+	rows, err := q.Query(`
+		SELECT ti.user_item_id, ti.owner_id, ti.item_id, i.name, COALESCE(i.edition, ''), COALESCE(i.set, ''), COALESCE(i.image, ''),
+			ti.grade, COALESCE(ti.condition, ''), COALESCE(ti.language, ''), COALESCE(ti.finish, ''), ti.quantity,
+			COALESCE(ti.unit_value, `+tradeItemValue+`)
+		FROM TradeItems ti
+		JOIN Items i ON i.item_id = ti.item_id
+		WHERE ti.trade_id = $1
+		ORDER BY ti.user_item_id
+	`, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.TradeItem
+		var ownerID int
+		var unitValue sql.NullFloat64
+		err := rows.Scan(&item.UserItemID, &ownerID, &item.ItemID, &item.Name, &item.Edition, &item.Set, &item.Image,
+			&item.Grade, &item.Condition, &item.Language, &item.Finish, &item.Quantity, &unitValue)
+		if err != nil {
+			return nil, err
+		}
+
+		side := &trade.Recipient
+		if ownerID == trade.Proposer.UserID {
+			side = &trade.Proposer
+		}
+		if unitValue.Valid {
+			item.UnitValue = &unitValue.Float64
+			side.EstimatedValue += unitValue.Float64 * float64(item.Quantity)
+		} else {
+			side.UnpricedItems++
+		}
+		side.Items = append(side.Items, item)
+	}
+	return trade, rows.Err()
+}
+
+// tradeSides returns the caller's side of a trade and the other party's, or
+// ErrTradeNotFound if the caller isn't a party to it.
+func tradeSides(trade *models.Trade, userID int) (*models.TradeSide, *models.TradeSide, error) {
+	switch userID {
+	case trade.Proposer.UserID:
+		return &trade.Proposer, &trade.Recipient, nil
+	case trade.Recipient.UserID:
+		return &trade.Recipient, &trade.Proposer, nil
+	}
+	return nil, nil, ErrTradeNotFound
+}
+
+// lockTrade locks a trade the user is a party to and loads it.
+func lockTrade(tx *sql.Tx, userID int, tradeID int) (*models.Trade, error) {
+	var id int
+	err := tx.QueryRow(`
+		SELECT trade_id FROM Trades
+		WHERE trade_id = $1 AND (proposer_id = $2 OR recipient_id = $2)
+		FOR UPDATE
+	`, tradeID, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrTradeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return loadTrade(tx, tradeID)
+}
+
+// awaitingResponse reports whether the trade is an open offer waiting on the
+// user.
+func awaitingResponse(trade *models.Trade, userID int) bool {
+	open := trade.Status == models.TradeProposed || trade.Status == models.TradeCountered
+	return open && trade.AwaitingUserID != nil && *trade.AwaitingUserID == userID
+}
+
+func GetTrade(userID int, tradeID int) (*models.Trade, error) {
+	trade, err := loadTrade(database.DB, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := tradeSides(trade, userID); err != nil {
+		return nil, err
+	}
+	return trade, nil
+}
+
+// GetTradesByUserID lists the trades a user is a party to, most recently
+// active first, optionally only those in one state.
+func GetTradesByUserID(userID int, status string) ([]models.Trade, error) {
+	if status != "" && !validTradeStatus(status) {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidTrade, status)
+	}
+
+	tradeIDs, err := scanIDs(database.DB.Query(`
+		SELECT trade_id FROM Trades
+		WHERE (proposer_id = $1 OR recipient_id = $1) AND ($2 = '' OR status = $2)
+		ORDER BY updated_at DESC, trade_id DESC
+	`, userID, status))
+	if err != nil {
+		log.Printf("Error querying trades for user %d: %v", userID, err)
+		return nil, err
+	}
+
+	trades := []models.Trade{}
+	for _, tradeID := range tradeIDs {
+		trade, err := loadTrade(database.DB, tradeID)
+		if err != nil {
+			return nil, err
+		}
+		trades = append(trades, *trade)
+	}
+	return trades, nil
+}
+
+func validTradeStatus(status string) bool {
+	switch status {
+	case models.TradeProposed, models.TradeCountered, models.TradeAccepted,
+		models.TradeDeclined, models.TradeCompleted, models.TradeCancelled:
+		return true
+	}
+	return false
+}
+
+// normalizeTradeOffer validates an offer, defaulting quantities to one and
+// rounding cash to cents.
+func normalizeTradeOffer(offer *models.TradeOffer) error {
+	if len(offer.Give)+len(offer.Receive) == 0 {
+		return fmt.Errorf("%w: the trade must include at least one copy", ErrInvalidTrade)
+	}
+	if len(offer.Give)+len(offer.Receive) > MaxTradeItems {
+		return fmt.Errorf("%w: at most %d copies can be traded at once", ErrInvalidTrade, MaxTradeItems)
+	}
+
+	seen := make(map[int]bool)
+	for _, items := range [][]models.TradeItemRequest{offer.Give, offer.Receive} {
+		for i := range items {
+			if items[i].Quantity == 0 {
+				items[i].Quantity = 1
+			}
+			if items[i].Quantity < 0 {
+				return fmt.Errorf("%w: quantity must be positive", ErrInvalidTrade)
+			}
+			if seen[items[i].UserItemID] {
+				return fmt.Errorf("%w: copy %d is listed more than once", ErrInvalidTrade, items[i].UserItemID)
+			}
+			seen[items[i].UserItemID] = true
+		}
+	}
+
+	if math.IsNaN(offer.Cash) || math.Abs(offer.Cash) > maxTradeCash {
+		return fmt.Errorf("%w: cash must be a number below %.2f", ErrInvalidTrade, maxTradeCash)
+	}
+	offer.Cash = math.Round(offer.Cash*100) / 100
+
+	offer.Message = strings.TrimSpace(offer.Message)
+	if utf8.RuneCountInString(offer.Message) > 1000 {
+		return fmt.Errorf("%w: message must be at most 1000 characters", ErrInvalidTrade)
+	}
+	return nil
+}
+
+// saveTradeItems adds copies given by owner to a trade, checking the owner
+// holds them in the quantities offered.
+func saveTradeItems(tx *sql.Tx, tradeID int, ownerID int, items []models.TradeItemRequest) error {
+	for _, item := range items {
+		result, err := tx.Exec(`
+			INSERT INTO TradeItems (trade_id, user_item_id, owner_id, item_id, grade, condition, language, finish, quantity)
+			SELECT $1, ui.user_item_id, c.user_id, ui.item_id, ui.grade, ui.condition, ui.language, ui.finish, $4
+			FROM UserItems ui
+			JOIN Collections c ON ui.collection_id = c.collection_id
+			WHERE ui.user_item_id = $2 AND c.user_id = $3 AND ui.quantity >= $4
+			AND c.deleted_at IS NULL AND ui.deleted_at IS NULL
+		`, tradeID, item.UserItemID, ownerID, item.Quantity)
+		if err != nil {
+			log.Printf("Error adding copy %d to trade %d: %v", item.UserItemID, tradeID, err)
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("%w: copy %d isn't held by user %d in that quantity", ErrInvalidTrade, item.UserItemID, ownerID)
+		}
+	}
+	return nil
+}
+
+// checkTradeItems confirms every copy in a trade is still held by the party
+// giving it, in the quantity offered.
+func checkTradeItems(tx *sql.Tx, trade *models.Trade) error {
+	for _, side := range []*models.TradeSide{&trade.Proposer, &trade.Recipient} {
+		for _, item := range side.Items {
+			var available bool
+			err := tx.QueryRow(`
+				SELECT EXISTS (
+					SELECT 1 FROM UserItems ui
+					JOIN Collections c ON ui.collection_id = c.collection_id
+					WHERE ui.user_item_id = $1 AND c.user_id = $2 AND ui.quantity >= $3
+					AND c.deleted_at IS NULL AND ui.deleted_at IS NULL
+				)
+			`, item.UserItemID, side.UserID, item.Quantity).Scan(&available)
+			if err != nil {
+				return err
+			}
+			if !available {
+				return fmt.Errorf("%w: copy %d", ErrTradeUnavailable, item.UserItemID)
+			}
+		}
+	}
+	return nil
+}
+
+// tradeCollection checks a collection the user will receive copies into.
+func tradeCollection(tx *sql.Tx, userID int, collectionID *int, receiving bool) error {
+	if collectionID == nil {
+		if receiving {
+			return fmt.Errorf("%w: collection_id is required to receive copies", ErrInvalidTrade)
+		}
+		return nil
+	}
+	return lockCollection(tx, strconv.Itoa(userID), *collectionID)
+}
+
+// ProposeTrade offers another user, named by username, an exchange of copies.
+func ProposeTrade(userID int, offer models.TradeOffer) (*models.Trade, error) {
+	if err := normalizeTradeOffer(&offer); err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var recipientID int
+	err = tx.QueryRow(`
+		SELECT user_id FROM Users WHERE LOWER(username) = LOWER($1) AND COALESCE(is_active, TRUE)
+	`, strings.TrimSpace(offer.Recipient)).Scan(&recipientID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, offer.Recipient)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if recipientID == userID {
+		return nil, fmt.Errorf("%w: you can't trade with yourself", ErrInvalidTrade)
+	}
+	if err := tradeCollection(tx, userID, offer.CollectionID, len(offer.Receive) > 0); err != nil {
+		return nil, err
+	}
+
+	var tradeID int
+	err = tx.QueryRow(`
+		INSERT INTO Trades (proposer_id, recipient_id, status, awaiting_user_id, cash_amount, message, proposer_collection_id)
+		VALUES ($1, $2, $3, $2, $4, NULLIF($5, ''), $6)
+		RETURNING trade_id
+	`, userID, recipientID, models.TradeProposed, offer.Cash, offer.Message, offer.CollectionID).Scan(&tradeID)
+	if err != nil {
+		log.Printf("Error creating trade for user %d: %v", userID, err)
+		return nil, err
+	}
+	if err := saveTradeItems(tx, tradeID, userID, offer.Give); err != nil {
+		return nil, err
+	}
+	if err := saveTradeItems(tx, tradeID, recipientID, offer.Receive); err != nil {
+		return nil, err
+	}
+
+	trade, err := loadTrade(tx, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("User %d proposed trade %d to user %d", userID, tradeID, recipientID)
+	notifyTrade(trade, recipientID, trade.Proposer.Username+" proposed a trade")
+	return trade, nil
+}
+
+// CounterTrade replaces the offer waiting on the user with their own, which
+// then waits on the other party.
+func CounterTrade(userID int, tradeID int, offer models.TradeOffer) (*models.Trade, error) {
+	if err := normalizeTradeOffer(&offer); err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	trade, err := lockTrade(tx, userID, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if !awaitingResponse(trade, userID) {
+		return nil, ErrTradeState
+	}
+	mine, theirs, err := tradeSides(trade, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	collectionID := mine.CollectionID
+	if offer.CollectionID != nil {
+		collectionID = offer.CollectionID
+	}
+	if err := tradeCollection(tx, userID, collectionID, len(offer.Receive) > 0); err != nil {
+		return nil, err
+	}
+
+	// cash_amount is always what the proposer pays
+	cash := offer.Cash
+	if userID != trade.Proposer.UserID {
+		cash = -cash
+	}
+	collectionColumn := "recipient_collection_id"
+	if userID == trade.Proposer.UserID {
+		collectionColumn = "proposer_collection_id"
+	}
+	_, err = tx.Exec(`
+		UPDATE Trades SET status = $1, awaiting_user_id = $2, cash_amount = $3, message = NULLIF($4, ''),
+			`+collectionColumn+` = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE trade_id = $6
+	`, models.TradeCountered, theirs.UserID, cash, offer.Message, collectionID, tradeID)
+	if err != nil {
+		log.Printf("Error countering trade %d: %v", tradeID, err)
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM TradeItems WHERE trade_id = $1`, tradeID); err != nil {
+		return nil, err
+	}
+	if err := saveTradeItems(tx, tradeID, userID, offer.Give); err != nil {
+		return nil, err
+	}
+	if err := saveTradeItems(tx, tradeID, theirs.UserID, offer.Receive); err != nil {
+		return nil, err
+	}
+
+	trade, err = loadTrade(tx, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("User %d countered trade %d", userID, tradeID)
+	notifyTrade(trade, theirs.UserID, mine.Username+" countered your trade")
+	return trade, nil
+}
+
+// AcceptTrade agrees to the offer waiting on the user. collectionID, if
+// given, is where the user's incoming copies go; it is required if they
+// receive copies and haven't chosen a collection yet.
+func AcceptTrade(userID int, tradeID int, collectionID *int) (*models.Trade, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	trade, err := lockTrade(tx, userID, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if !awaitingResponse(trade, userID) {
+		return nil, ErrTradeState
+	}
+	mine, theirs, err := tradeSides(trade, userID)
+	if err != nil {
+		return nil, err
+	}
+	if collectionID == nil {
+		collectionID = mine.CollectionID
+	}
+	if err := tradeCollection(tx, userID, collectionID, len(theirs.Items) > 0); err != nil {
+		return nil, err
+	}
+	if err := checkTradeItems(tx, trade); err != nil {
+		return nil, err
+	}
+
+	collectionColumn := "recipient_collection_id"
+	if userID == trade.Proposer.UserID {
+		collectionColumn = "proposer_collection_id"
+	}
+	_, err = tx.Exec(`
+		UPDATE Trades SET status = $1, awaiting_user_id = NULL, `+collectionColumn+` = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE trade_id = $3
+	`, models.TradeAccepted, collectionID, tradeID)
+	if err != nil {
+		log.Printf("Error accepting trade %d: %v", tradeID, err)
+		return nil, err
+	}
+
+	trade, err = loadTrade(tx, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("User %d accepted trade %d", userID, tradeID)
+	notifyTrade(trade, theirs.UserID, mine.Username+" accepted your trade")
+	return trade, nil
+}
+
+// DeclineTrade turns down the offer waiting on the user.
+func DeclineTrade(userID int, tradeID int) (*models.Trade, error) {
+	return closeTrade(userID, tradeID, models.TradeDeclined, func(trade *models.Trade) bool {
+		return awaitingResponse(trade, userID)
+	})
+}
+
+// CancelTrade withdraws the user's own open offer, or calls off an accepted
+// trade before it completes.
+func CancelTrade(userID int, tradeID int) (*models.Trade, error) {
+	return closeTrade(userID, tradeID, models.TradeCancelled, func(trade *models.Trade) bool {
+		open := trade.Status == models.TradeProposed || trade.Status == models.TradeCountered
+		return trade.Status == models.TradeAccepted || open && !awaitingResponse(trade, userID)
+	})
+}
+
+// closeTrade ends a trade with status if allowed says the user may.
+func closeTrade(userID int, tradeID int, status string, allowed func(*models.Trade) bool) (*models.Trade, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	trade, err := lockTrade(tx, userID, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed(trade) {
+		return nil, ErrTradeState
+	}
+	mine, theirs, err := tradeSides(trade, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE Trades SET status = $1, awaiting_user_id = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE trade_id = $2
+	`, status, tradeID)
+	if err != nil {
+		log.Printf("Error closing trade %d as %s: %v", tradeID, status, err)
+		return nil, err
+	}
+
+	trade, err = loadTrade(tx, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("User %d %s trade %d", userID, status, tradeID)
+	notifyTrade(trade, theirs.UserID, fmt.Sprintf("%s %s your trade", mine.Username, status))
+	return trade, nil
+}
+
+// CompleteTrade carries out an accepted trade in one transaction. Each copy
+// leaves its giver as a trade_out at its market value, with the giver's cost
+// basis, and arrives in the other party's collection as a new copy acquired
+// by trade_in at that value. If any copy is no longer available, or has no
+// market value, nothing changes hands and the trade stays accepted. Cash is recorded on the trade
+// only; paying it is up to the parties.
+func CompleteTrade(ctx context.Context, userID int, tradeID int) (*models.Trade, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	trade, err := lockTrade(tx, userID, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if trade.Status != models.TradeAccepted {
+		return nil, ErrTradeState
+	}
+
+	// Fix the values the copies change hands at
+	if _, err := tx.Exec(`UPDATE TradeItems ti SET unit_value = `+tradeItemValue+` WHERE ti.trade_id = $1`, tradeID); err != nil {
+		log.Printf("Error valuing trade %d: %v", tradeID, err)
+		return nil, err
+	}
+	if trade, err = loadTrade(tx, tradeID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	notes := fmt.Sprintf("Trade #%d", tradeID)
+	for _, sides := range [][2]*models.TradeSide{{&trade.Proposer, &trade.Recipient}, {&trade.Recipient, &trade.Proposer}} {
+		giver, receiver := sides[0], sides[1]
+		if len(giver.Items) == 0 {
+			continue
+		}
+		if err := tradeCollection(tx, receiver.UserID, receiver.CollectionID, true); err != nil {
+			return nil, err
+		}
+
+		for _, item := range giver.Items {
+			if item.UnitValue == nil {
+				return nil, fmt.Errorf("%w: copy %d", ErrTradeUnvalued, item.UserItemID)
+			}
+			unitValue := *item.UnitValue
+
+			userItemID := item.UserItemID
+			entry := models.LedgerEntry{
+				UserItemID:   &userItemID,
+				EntryType:    models.LedgerTradeOut,
+				Quantity:     item.Quantity,
+				Price:        unitValue,
+				Counterparty: receiver.Username,
+				Notes:        notes,
+				OccurredAt:   now,
+			}
+			given, err := disposeUnits(ctx, tx, strconv.Itoa(giver.UserID), &entry, models.CostBasisFIFO, nil)
+			if errors.Is(err, ErrCardNotFound) || errors.Is(err, ErrInsufficientQuantity) {
+				return nil, fmt.Errorf("%w: copy %d", ErrTradeUnavailable, item.UserItemID)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = receiveUnits(ctx, tx, receiver.UserID, *receiver.CollectionID, given, item.Quantity,
+				models.LedgerTradeIn, unitValue, giver.Username, now)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE Trades SET status = $1, awaiting_user_id = NULL, completed_at = $2, updated_at = $2
+		WHERE trade_id = $3
+	`, models.TradeCompleted, now, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if trade, err = loadTrade(tx, tradeID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing trade %d: %v", tradeID, err)
+		return nil, err
+	}
+
+	log.Printf("User %d completed trade %d", userID, tradeID)
+	mine, theirs, _ := tradeSides(trade, userID)
+	notifyTrade(trade, theirs.UserID, mine.Username+" completed your trade")
+	return trade, nil
+}
+
+// notifyTrade tells a party about a change to a trade.
+func notifyTrade(trade *models.Trade, userID int, subject string) {
+	notifyUserAsync(userID, notify.Message{
+		Event:   notify.EventTrade,
+		Subject: fmt.Sprintf("Trade #%d: %s", trade.TradeID, subject),
+		Body: fmt.Sprintf("%s gives %d copies and $%.2f (about $%.2f); %s gives %d copies and $%.2f (about $%.2f). The trade is now %s.",
+			trade.Proposer.Username, len(trade.Proposer.Items), trade.Proposer.Cash, trade.Proposer.EstimatedValue,
+			trade.Recipient.Username, len(trade.Recipient.Items), trade.Recipient.Cash, trade.Recipient.EstimatedValue,
+			trade.Status),
+		Data: map[string]interface{}{
+			"trade_id": trade.TradeID,
+			"status":   trade.Status,
+		},
+	})
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+// useTestDB points the database at TEST_DATABASE_URL, a Postgres database
+// loaded with schema.sql, skipping the test when it isn't set.
+func useTestDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		db.Close()
+	})
+}
+
+// tradeTest is two users with a collection each and a card the proposer owns
+// one copy of, all removed when the test ends.
+type tradeTest struct {
+	itemID              string
+	proposer, recipient int
+	recipientName       string
+	proposerCollection  int
+	recipientCollection int
+	userItemID          int
+}
+
+func newTradeTest(t *testing.T) *tradeTest {
+	t.Helper()
+	suffix := time.Now().UnixNano()
+	tt := &tradeTest{itemID: fmt.Sprintf("test-%d", suffix), recipientName: fmt.Sprintf("misty-%d", suffix)}
+
+	createUser := func(username string) int {
+		var userID int
+		err := database.DB.QueryRow(`
+			INSERT INTO Users (username, email, password, joined)
+			VALUES ($1, $1 || '@example.com', 'not-a-bcrypt-hash', CURRENT_TIMESTAMP)
+			RETURNING user_id
+		`, username).Scan(&userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return userID
+	}
+	createCollection := func(userID int) int {
+		var collectionID int
+		err := database.DB.QueryRow(`
+			INSERT INTO Collections (user_id, collection_name) VALUES ($1, 'Binder') RETURNING collection_id
+		`, userID).Scan(&collectionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return collectionID
+	}
+
+	if _, err := database.DB.Exec(`INSERT INTO Items (item_id, name) VALUES ($1, 'Charizard')`, tt.itemID); err != nil {
+		t.Fatal(err)
+	}
+	tt.proposer = createUser(fmt.Sprintf("ash-%d", suffix))
+	tt.recipient = createUser(tt.recipientName)
+	t.Cleanup(func() { tt.cleanup(t) })
+	tt.proposerCollection = createCollection(tt.proposer)
+	tt.recipientCollection = createCollection(tt.recipient)
+
+	err := database.DB.QueryRow(`
+		INSERT INTO UserItems (collection_id, item_id, grade, purchase_price, quantity)
+		VALUES ($1, $2, 'Ungraded', 4.00, 1)
+		RETURNING user_item_id
+	`, tt.proposerCollection, tt.itemID).Scan(&tt.userItemID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tt
+}
+
+func (tt *tradeTest) cleanup(t *testing.T) {
+	users := fmt.Sprintf("(%d, %d)", tt.proposer, tt.recipient)
+	for _, query := range []string{
+		`DELETE FROM LedgerAllocations WHERE disposal_entry_id IN (SELECT entry_id FROM LedgerEntries WHERE user_id IN ` + users + `)`,
+		`DELETE FROM LedgerEntries WHERE user_id IN ` + users,
+		`DELETE FROM Trades WHERE proposer_id IN ` + users,
+		`DELETE FROM UserItems WHERE collection_id IN (SELECT collection_id FROM Collections WHERE user_id IN ` + users + `)`,
+		`DELETE FROM Collections WHERE user_id IN ` + users,
+		`DELETE FROM Users WHERE user_id IN ` + users,
+		`DELETE FROM MarketData WHERE item_id = '` + tt.itemID + `'`,
+		`DELETE FROM Items WHERE item_id = '` + tt.itemID + `'`,
+	} {
+		if _, err := database.DB.Exec(query); err != nil {
+			t.Errorf("cleaning up: %v", err)
+		}
+	}
+}
+
+// acceptedTrade has the proposer give their copy and the recipient accept it.
+func (tt *tradeTest) acceptedTrade(t *testing.T) int {
+	t.Helper()
+	trade, err := ProposeTrade(tt.proposer, models.TradeOffer{
+		Recipient: tt.recipientName,
+		Give:      []models.TradeItemRequest{{UserItemID: tt.userItemID, Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcceptTrade(tt.recipient, trade.TradeID, &tt.recipientCollection); err != nil {
+		t.Fatal(err)
+	}
+	return trade.TradeID
+}
+
+func TestCompleteTradeUsesMarketValue(t *testing.T) {
+	useTestDB(t)
+	tt := newTradeTest(t)
+	// Fetched prices keep the value in market_value and lower-case the grade
+	_, err := database.DB.Exec(`
+		INSERT INTO MarketData (item_id, grade, market_value, last_updated) VALUES ($1, 'ungraded', 12.50, CURRENT_TIMESTAMP)
+	`, tt.itemID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trade, err := CompleteTrade(context.Background(), tt.proposer, tt.acceptedTrade(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trade.Status != models.TradeCompleted {
+		t.Errorf("status %q, want %q", trade.Status, models.TradeCompleted)
+	}
+	if value := trade.Proposer.Items[0].UnitValue; value == nil || *value != 12.50 {
+		t.Errorf("unit value %v, want 12.50", value)
+	}
+
+	var price float64
+	err = database.DB.QueryRow(`
+		SELECT price FROM LedgerEntries WHERE user_id = $1 AND item_id = $2 AND entry_type = $3
+	`, tt.recipient, tt.itemID, models.LedgerTradeIn).Scan(&price)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price != 12.50 {
+		t.Errorf("trade_in booked at %.2f, want 12.50", price)
+	}
+}
+
+func TestCompleteTradeRefusesUnvaluedCopy(t *testing.T) {
+	useTestDB(t)
+	tt := newTradeTest(t)
+	tradeID := tt.acceptedTrade(t)
+
+	if _, err := CompleteTrade(context.Background(), tt.proposer, tradeID); !errors.Is(err, ErrTradeUnvalued) {
+		t.Fatalf("got error %v, want %v", err, ErrTradeUnvalued)
+	}
+	trade, err := GetTrade(tt.proposer, tradeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trade.Status != models.TradeAccepted {
+		t.Errorf("status %q, want %q", trade.Status, models.TradeAccepted)
+	}
+	var held int
+	if err := database.DB.QueryRow(`SELECT quantity FROM UserItems WHERE user_item_id = $1`, tt.userItemID).Scan(&held); err != nil {
+		t.Fatal(err)
+	}
+	if held != 1 {
+		t.Errorf("proposer holds %d, want 1", held)
+	}
+}
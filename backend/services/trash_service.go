@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/audit"
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+// ErrNotInTrash is returned when restoring something that is not deleted or
+// does not belong to the user.
+var ErrNotInTrash = errors.New("not found in trash")
+
+// ErrCollectionDeleted is returned when restoring a copy whose collection is
+// itself in the trash.
+var ErrCollectionDeleted = errors.New("the collection is in the trash; restore it first")
+
+// GetTrashByUserID lists a user's deleted collections and the copies that were
+// deleted individually from live or deleted collections.
+func GetTrashByUserID(userID string) (*models.Trash, error) {
+	trash := &models.Trash{Collections: []models.TrashedCollection{}, Copies: []models.TrashedCopy{}}
+
+	rows, err := database.DB.Query(`
+		SELECT c.collection_id, c.collection_name, c.deleted_at,
+			(SELECT COUNT(*) FROM UserItems ui WHERE ui.collection_id = c.collection_id AND ui.deleted_at = c.deleted_at)
+		FROM Collections c
+		WHERE c.user_id = $1 AND c.deleted_at IS NOT NULL
+		ORDER BY c.deleted_at DESC
+	`, userID)
+	if err != nil {
+		log.Printf("Error querying deleted collections: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var collection models.TrashedCollection
+		if err := rows.Scan(&collection.CollectionID, &collection.CollectionName, &collection.DeletedAt, &collection.ItemCount); err != nil {
+			return nil, err
+		}
+		trash.Collections = append(trash.Collections, collection)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	copyRows, err := database.DB.Query(`
+		SELECT `+cardColumns+`, c.collection_id, c.collection_name, ui.deleted_at
+		FROM UserItems ui
+		JOIN Items i ON ui.item_id = i.item_id
+		JOIN Collections c ON ui.collection_id = c.collection_id
+		WHERE c.user_id = $1 AND ui.deleted_at IS NOT NULL
+		AND (c.deleted_at IS NULL OR ui.deleted_at <> c.deleted_at)
+		ORDER BY ui.deleted_at DESC
+	`, userID)
+	if err != nil {
+		log.Printf("Error querying deleted copies: %v", err)
+		return nil, err
+	}
+	defer copyRows.Close()
+
+	for copyRows.Next() {
+		var trashed models.TrashedCopy
+		var acquiredAt sql.NullTime
+		card := &trashed.Card
+		err := copyRows.Scan(&card.UserItemID, &card.ID, &card.Name, &card.Edition, &card.Set, &card.Image,
+			&card.Type, &card.Grade, &card.PurchasePrice, &card.Quantity,
+			&card.Condition, &card.Language, &card.Finish, &acquiredAt, &card.Notes,
+			&trashed.CollectionID, &trashed.CollectionName, &trashed.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		if acquiredAt.Valid {
+			card.AcquiredAt = &acquiredAt.Time
+		}
+		trash.Copies = append(trash.Copies, trashed)
+	}
+	return trash, copyRows.Err()
+}
+
+// RestoreCollection brings a deleted collection back together with the copies
+// that were deleted along with it.
+func RestoreCollection(ctx context.Context, userID string, collectionID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var collectionName string
+	var deletedAt time.Time
+	err = tx.QueryRow(`
+		SELECT collection_name, deleted_at
+		FROM Collections
+		WHERE collection_id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+		FOR UPDATE
+	`, collectionID, userID).Scan(&collectionName, &deletedAt)
+	if err == sql.ErrNoRows {
+		return ErrNotInTrash
+	}
+	if err != nil {
+		return err
+	}
+
+	var exists bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM Collections WHERE user_id = $1 AND collection_name = $2 AND deleted_at IS NULL)
+	`, userID, collectionName).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrCollectionExists
+	}
+
+	if _, err := tx.Exec(`UPDATE Collections SET deleted_at = NULL WHERE collection_id = $1`, collectionID); err != nil {
+		return err
+	}
+	restored, err := scanIDs(tx.Query(`
+		UPDATE UserItems SET deleted_at = NULL
+		WHERE collection_id = $1 AND deleted_at = $2
+		RETURNING user_item_id
+	`, collectionID, deletedAt))
+	if err != nil {
+		return err
+	}
+	if err := reopenCopyLots(tx, restored); err != nil {
+		return err
+	}
+	err = recordCollectionChange(ctx, tx, audit.CollectionRestore, userID, collectionID,
+		nil, &collectionAuditState{CollectionName: collectionName, UserItemIDs: restored})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Restored collection %d (%s) for user %s", collectionID, collectionName, userID)
+	return tx.Commit()
+}
+
+// RestoreCopy brings back a single deleted card or item copy.
+func RestoreCopy(ctx context.Context, userID string, userItemID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var collectionID int
+	var collectionDeleted bool
+	err = tx.QueryRow(`
+		SELECT c.collection_id, c.deleted_at IS NOT NULL
+		FROM UserItems ui
+		JOIN Collections c ON ui.collection_id = c.collection_id
+		WHERE ui.user_item_id = $1 AND c.user_id = $2 AND ui.deleted_at IS NOT NULL
+		FOR UPDATE OF ui
+	`, userItemID, userID).Scan(&collectionID, &collectionDeleted)
+	if err == sql.ErrNoRows {
+		return ErrNotInTrash
+	}
+	if err != nil {
+		return err
+	}
+	if collectionDeleted {
+		return ErrCollectionDeleted
+	}
+
+	if _, err := tx.Exec(`UPDATE UserItems SET deleted_at = NULL WHERE user_item_id = $1`, userItemID); err != nil {
+		return err
+	}
+	if err := reopenCopyLots(tx, []int{userItemID}); err != nil {
+		return err
+	}
+	card, err := getCopy(tx, userItemID)
+	if err != nil {
+		return err
+	}
+	if err := recordCopyChange(ctx, tx, audit.CopyRestore, userID, collectionID, userItemID, nil, card); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeTrash permanently deletes copies and collections that have been in the
+// trash for longer than retention. Each purged row is recorded in the audit
+// log.
+func PurgeTrash(ctx context.Context, retention time.Duration) (int64, int64, error) {
+	cutoff := time.Now().Add(-retention)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	copies, err := purgeRows(ctx, tx, audit.TargetCopy, `
+		DELETE FROM UserItems ui
+		USING Collections c
+		WHERE ui.collection_id = c.collection_id
+		AND ((ui.deleted_at IS NOT NULL AND ui.deleted_at < $1) OR (c.deleted_at IS NOT NULL AND c.deleted_at < $1))
+		RETURNING c.user_id, ui.collection_id, ui.user_item_id, ui.item_id
+	`, cutoff)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	collections, err := purgeRows(ctx, tx, audit.TargetCollection, `
+		DELETE FROM Collections
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1
+		RETURNING user_id, collection_id, collection_id, collection_name
+	`, cutoff)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return copies, collections, tx.Commit()
+}
+
+// purgeRows runs a DELETE returning the owner, collection ID, target ID and a
+// description of each row, and records each deletion in the audit log.
+func purgeRows(ctx context.Context, tx *sql.Tx, targetType string, query string, args ...interface{}) (int64, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	var purged []auditChange
+	for rows.Next() {
+		var change auditChange
+		var userID, collectionID, targetID int
+		var description string
+		if err := rows.Scan(&userID, &collectionID, &targetID, &description); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		change.UserID, change.CollectionID, change.TargetID = userID, collectionID, targetID
+		change.Action, change.TargetType = audit.TrashPurge, targetType
+		if targetType == audit.TargetCollection {
+			change.Before = collectionAuditState{CollectionName: description}
+		} else {
+			change.Before = map[string]string{"item_id": description}
+		}
+		purged = append(purged, change)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, change := range purged {
+		if err := recordAudit(ctx, tx, change); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(purged)), nil
+}
+
+// StartTrashPurgeJob runs PurgeTrash every interval in the background.
+func StartTrashPurgeJob(retention time.Duration, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for ; ; <-ticker.C {
+			copies, collections, err := PurgeTrash(context.Background(), retention)
+			if err != nil {
+				log.Printf("Error purging trash: %v", err)
+				continue
+			}
+			if copies > 0 || collections > 0 {
+				log.Printf("Purged %d copies and %d collections from trash", copies, collections)
+			}
+		}
+	}()
+}
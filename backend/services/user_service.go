@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+
+	"github.com/CatsMeow492/PokemonCollection/audit"
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrUserExists is returned when a username or email is taken by another
+// user.
+var ErrUserExists = errors.New("username or email already exists")
+
+// ErrInvalidProfile is wrapped by validation errors for profile and
+// preference updates.
+var ErrInvalidProfile = errors.New("invalid profile")
+
+// ErrIncorrectPassword is returned when the current password given for a
+// password change doesn't match.
+var ErrIncorrectPassword = errors.New("current password is incorrect")
+
+// MinPasswordLength is the shortest password accepted by password changes.
+const MinPasswordLength = 8
+
+func GetProfile(userID string) (*models.Profile, error) {
+	var profile models.Profile
+	var lastLogin sql.NullTime
+	err := database.DB.QueryRow(`
+		SELECT u.user_id, u.username, COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), u.email,
+			COALESCE(u.profile_picture, ''), u.joined, u.last_login, COALESCE(u.is_subscribed, FALSE),
+			COALESCE(p.default_currency, $2), COALESCE(c.collection_name, ''), COALESCE(p.price_source, $3),
+			COALESCE(p.public_profile, FALSE)
+		FROM Users u
+		LEFT JOIN UserPreferences p ON p.user_id = u.user_id
+		LEFT JOIN Collections c ON c.collection_id = p.default_collection_id AND c.deleted_at IS NULL
+		WHERE u.user_id = $1
+	`, userID, models.DefaultCurrency, models.PriceSourceEbay).Scan(&profile.ID, &profile.Username, &profile.FirstName, &profile.LastName,
+		&profile.Email, &profile.ProfilePicture, &profile.Joined, &lastLogin, &profile.IsSubscribed,
+		&profile.Preferences.DefaultCurrency, &profile.Preferences.DefaultCollection, &profile.Preferences.PriceSource,
+		&profile.Preferences.PublicProfile)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		log.Printf("Error querying profile for user %s: %v", userID, err)
+		return nil, err
+	}
+	if lastLogin.Valid {
+		profile.LastLogin = &lastLogin.Time
+	}
+	return &profile, nil
+}
+
+// UpdateProfile applies a partial update to a user's profile fields and
+// preferences in one transaction and returns the updated profile. A new
+// email address has to be verified again.
+func UpdateProfile(ctx context.Context, userID string, update models.ProfileUpdate) (*models.Profile, error) {
+	if err := normalizeProfileUpdate(&update); err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var userKey int
+	var before userAuditState
+	err = tx.QueryRow(`
+		SELECT user_id, username, COALESCE(first_name, ''), COALESCE(last_name, ''), email, COALESCE(profile_picture, '')
+		FROM Users WHERE user_id = $1 FOR UPDATE
+	`, userID).Scan(&userKey, &before.Username, &before.FirstName, &before.LastName, &before.Email, &before.ProfilePicture)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	emailChanged := update.Email != nil && !strings.EqualFold(*update.Email, before.Email)
+
+	if update.Username != nil || update.Email != nil {
+		var taken bool
+		err = tx.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM Users
+				WHERE user_id <> $1 AND ((username = $2 AND $2 <> '') OR (LOWER(email) = LOWER($3) AND $3 <> ''))
+			)
+		`, userID, stringOrEmpty(update.Username), stringOrEmpty(update.Email)).Scan(&taken)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, ErrUserExists
+		}
+	}
+
+	after := userAuditState{Preferences: update.Preferences}
+	err = tx.QueryRow(`
+		UPDATE Users SET
+			username = COALESCE($2, username),
+			first_name = COALESCE($3, first_name),
+			last_name = COALESCE($4, last_name),
+			email = COALESCE($5, email),
+			profile_picture = COALESCE($6, profile_picture),
+			email_verified = COALESCE(email_verified, FALSE) AND NOT $7
+		WHERE user_id = $1
+		RETURNING username, COALESCE(first_name, ''), COALESCE(last_name, ''), email, COALESCE(profile_picture, '')
+	`, userID, update.Username, update.FirstName, update.LastName, update.Email, update.ProfilePicture, emailChanged).Scan(
+		&after.Username, &after.FirstName, &after.LastName, &after.Email, &after.ProfilePicture)
+	if err != nil {
+		log.Printf("Error updating profile for user %s: %v", userID, err)
+		return nil, err
+	}
+
+	// Links sent to the old address must not verify the new one
+	if emailChanged {
+		_, err = tx.Exec(`
+			UPDATE UserTokens SET used_at = CURRENT_TIMESTAMP
+			WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+		`, userID, tokenVerifyEmail)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if prefs := update.Preferences; prefs != nil {
+		var defaultCollectionID sql.NullInt64
+		if prefs.DefaultCollection != nil && *prefs.DefaultCollection != "" {
+			err = tx.QueryRow(`
+				SELECT collection_id FROM Collections
+				WHERE user_id = $1 AND collection_name = $2 AND deleted_at IS NULL
+			`, userID, *prefs.DefaultCollection).Scan(&defaultCollectionID)
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("%w: default_collection: %s", ErrCollectionNotFound, *prefs.DefaultCollection)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// A nil default_collection keeps the current one; an empty one clears it
+		_, err = tx.Exec(`
+			INSERT INTO UserPreferences (user_id, default_currency, default_collection_id, price_source, public_profile)
+			VALUES ($1, COALESCE($2, $6), $3, COALESCE($4, $7), COALESCE($5, FALSE))
+			ON CONFLICT (user_id) DO UPDATE SET
+				default_currency = COALESCE($2, UserPreferences.default_currency),
+				default_collection_id = CASE WHEN $8 THEN $3 ELSE UserPreferences.default_collection_id END,
+				price_source = COALESCE($4, UserPreferences.price_source),
+				public_profile = COALESCE($5, UserPreferences.public_profile),
+				updated_at = CURRENT_TIMESTAMP
+		`, userID, prefs.DefaultCurrency, defaultCollectionID, prefs.PriceSource, prefs.PublicProfile,
+			models.DefaultCurrency, models.PriceSourceEbay, prefs.DefaultCollection != nil)
+		if err != nil {
+			log.Printf("Error updating preferences for user %s: %v", userID, err)
+			return nil, err
+		}
+	}
+
+	if err := recordUserChange(ctx, tx, audit.UserUpdate, userKey, &before, &after); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Updated profile for user %s", userID)
+	if emailChanged {
+		if err := SendVerificationEmail(userKey); err != nil {
+			log.Printf("Error sending verification email to user %s: %v", userID, err)
+		}
+	}
+	return GetProfile(userID)
+}
+
+// normalizeProfileUpdate trims and validates the fields being changed.
+func normalizeProfileUpdate(update *models.ProfileUpdate) error {
+	for _, field := range []*string{update.Username, update.FirstName, update.LastName, update.Email, update.ProfilePicture} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+	if update.Username != nil && *update.Username == "" {
+		return fmt.Errorf("%w: username can't be empty", ErrInvalidProfile)
+	}
+	if update.Email != nil {
+		address, err := mail.ParseAddress(*update.Email)
+		if err != nil || address.Address != *update.Email {
+			return fmt.Errorf("%w: invalid email %q", ErrInvalidProfile, *update.Email)
+		}
+	}
+
+	prefs := update.Preferences
+	if prefs == nil {
+		return nil
+	}
+	if prefs.DefaultCurrency != nil {
+		currency := strings.ToUpper(strings.TrimSpace(*prefs.DefaultCurrency))
+		if !containsString(models.Currencies, currency) {
+			return fmt.Errorf("%w: default_currency must be one of %v", ErrInvalidProfile, models.Currencies)
+		}
+		prefs.DefaultCurrency = &currency
+	}
+	if prefs.PriceSource != nil {
+		source := strings.ToLower(strings.TrimSpace(*prefs.PriceSource))
+		if source != models.PriceSourceEbay && source != models.PriceSourceTCGplayer {
+			return fmt.Errorf("%w: price_source must be %s or %s", ErrInvalidProfile, models.PriceSourceEbay, models.PriceSourceTCGplayer)
+		}
+		prefs.PriceSource = &source
+	}
+	if prefs.DefaultCollection != nil {
+		name := strings.TrimSpace(*prefs.DefaultCollection)
+		prefs.DefaultCollection = &name
+	}
+	return nil
+}
+
+// ChangePassword replaces a user's password after checking their current
+// one.
+func ChangePassword(ctx context.Context, userID string, currentPassword string, newPassword string) error {
+	if len(newPassword) < MinPasswordLength {
+		return fmt.Errorf("%w: password must be at least %d characters", ErrInvalidProfile, MinPasswordLength)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userKey int
+	var hash string
+	err = tx.QueryRow(`SELECT user_id, password FROM Users WHERE user_id = $1 FOR UPDATE`, userID).Scan(&userKey, &hash)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(currentPassword)); err != nil {
+		return ErrIncorrectPassword
+	}
+
+	newHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE Users SET password = $1 WHERE user_id = $2`, string(newHash), userID); err != nil {
+		log.Printf("Error updating password for user %s: %v", userID, err)
+		return err
+	}
+	// Sessions started with the old password shouldn't outlive it
+	if err := revokeAllSessions(tx, userID); err != nil {
+		log.Printf("Error revoking sessions for user %s: %v", userID, err)
+		return err
+	}
+	if err := recordUserChange(ctx, tx, audit.UserPassword, userKey, nil, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Changed password for user %s", userID)
+	return nil
+}
+
+func stringOrEmpty(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/CatsMeow492/PokemonCollection/database"
+	"github.com/CatsMeow492/PokemonCollection/models"
+)
+
+// ErrInvalidWant is wrapped by validation errors for want list requests.
+var ErrInvalidWant = errors.New("invalid want")
+
+var ErrWantNotFound = errors.New("want not found")
+
+var ErrAlertNotFound = errors.New("alert not found")
+
+const wantColumns = `w.want_id, w.item_id, i.name, COALESCE(i.edition, ''), COALESCE(i.image, ''), COALESCE(w.grade, ''),
+	COALESCE(w.condition, ''), COALESCE(w.language, ''), COALESCE(w.finish, ''), w.max_price, COALESCE(w.notes, ''), w.created_at`
+
+func scanWant(row rowScanner) (models.Want, error) {
+	var want models.Want
+	err := row.Scan(&want.WantID, &want.ItemID, &want.Name, &want.Edition, &want.Image, &want.Grade,
+		&want.Condition, &want.Language, &want.Finish, &want.MaxPrice, &want.Notes, &want.CreatedAt)
+	return want, err
+}
+
+func GetWantsByUserID(userID string) ([]models.Want, error) {
+	rows, err := database.DB.Query(`
+		SELECT `+wantColumns+`
+		FROM WantList w
+		JOIN Items i ON w.item_id = i.item_id
+		WHERE w.user_id = $1
+		ORDER BY w.created_at, w.want_id
+	`, userID)
+	if err != nil {
+		log.Printf("Error querying want list for user %s: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	wants := []models.Want{}
+	for rows.Next() {
+		want, err := scanWant(rows)
+		if err != nil {
+			return nil, err
+		}
+		wants = append(wants, want)
+	}
+	return wants, rows.Err()
+}
+
+// AddWant puts a catalog card on a user's want list. The card is looked up in
+// the TCG API so it can be priced before anyone owns it.
+func AddWant(apiKey string, userID string, want models.Want) (*models.Want, error) {
+	if want.ItemID == "" {
+		return nil, fmt.Errorf("%w: item_id is required", ErrInvalidWant)
+	}
+	if want.MaxPrice <= 0 {
+		return nil, fmt.Errorf("%w: max_price must be positive", ErrInvalidWant)
+	}
+	if err := normalizeWant(&want); err != nil {
+		return nil, err
+	}
+
+	card, err := FetchCatalogCard(apiKey, want.ItemID)
+	if err != nil {
+		log.Printf("Error looking up wanted card %s: %v", want.ItemID, err)
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Make sure the card exists in Items without overwriting owned details
+	_, err = tx.Exec(`
+		INSERT INTO Items (item_id, name, edition, set, image, type)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (item_id) DO NOTHING
+	`, card.ID, card.Name, card.Edition, card.Set, card.Image, card.Type)
+	if err != nil {
+		log.Printf("Error inserting wanted item: %v", err)
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO WantList (user_id, item_id, grade, condition, language, finish, max_price, notes)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7, NULLIF($8, ''))
+		RETURNING want_id, created_at
+	`, userID, card.ID, want.Grade, want.Condition, want.Language, want.Finish, want.MaxPrice, want.Notes).Scan(&want.WantID, &want.CreatedAt)
+	if err != nil {
+		log.Printf("Error inserting want: %v", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		return nil, err
+	}
+
+	want.ItemID, want.Name, want.Edition, want.Image = card.ID, card.Name, card.Edition, card.Image
+	log.Printf("Added want %d for %s at or below %.2f for user %s", want.WantID, want.ItemID, want.MaxPrice, userID)
+	return &want, nil
+}
+
+// normalizeWant validates a want's market filters. Unlike owned copies, an
+// empty language means any language rather than English.
+func normalizeWant(want *models.Want) error {
+	language := want.Language
+	condition, _, finish, err := models.NormalizeRawAttributes(want.Condition, "", want.Finish)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWant, err)
+	}
+	if strings.TrimSpace(language) != "" {
+		var ok bool
+		if language, ok = models.NormalizeLanguage(language); !ok {
+			return fmt.Errorf("%w: unknown language: %q", ErrInvalidWant, want.Language)
+		}
+	}
+	want.Condition, want.Language, want.Finish = condition, language, finish
+	want.Grade = strings.TrimSpace(want.Grade)
+	return nil
+}
+
+func UpdateWantMaxPrice(userID string, wantID int, maxPrice float64) error {
+	if maxPrice <= 0 {
+		return fmt.Errorf("%w: max_price must be positive", ErrInvalidWant)
+	}
+	result, err := database.DB.Exec(`UPDATE WantList SET max_price = $1 WHERE want_id = $2 AND user_id = $3`, maxPrice, wantID, userID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return ErrWantNotFound
+	}
+	return nil
+}
+
+// RemoveWant deletes a want along with its alerts.
+func RemoveWant(userID string, wantID int) error {
+	result, err := database.DB.Exec(`DELETE FROM WantList WHERE want_id = $1 AND user_id = $2`, wantID, userID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return ErrWantNotFound
+	}
+	return nil
+}
+
+// evaluateWants records an alert for every want the new market price meets.
+// A want is not alerted again while it has an undismissed alert at the same
+// or a lower price. Users are notified of new alerts in the background.
+func evaluateWants(query MarketPriceQuery, price float64) ([]models.PriceAlert, error) {
+	if query.ID == "" || price <= 0 {
+		return nil, nil
+	}
+
+	rows, err := database.DB.Query(`
+		INSERT INTO PriceAlerts (want_id, user_id, item_id, price, max_price)
+		SELECT w.want_id, w.user_id, w.item_id, $6, w.max_price
+		FROM WantList w
+		WHERE w.item_id = $1
+		AND (w.grade IS NULL OR LOWER(w.grade) = LOWER($2))
+		AND (w.condition IS NULL OR w.condition = $3)
+		AND (w.language IS NULL OR w.language = $4)
+		AND (w.finish IS NULL OR w.finish = $5)
+		AND w.max_price >= $6
+		AND NOT EXISTS (
+			SELECT 1 FROM PriceAlerts a
+			WHERE a.want_id = w.want_id AND a.dismissed_at IS NULL AND a.price <= $6
+		)
+		RETURNING alert_id, want_id, user_id, item_id, price, max_price, triggered_at
+	`, query.ID, query.Grade, query.Condition, query.Language, query.Finish, price)
+	if err != nil {
+		log.Printf("Error evaluating wants for %s: %v", query.ID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []models.PriceAlert
+	for rows.Next() {
+		alert := models.PriceAlert{Name: query.Name, Grade: query.Grade}
+		if err := rows.Scan(&alert.AlertID, &alert.WantID, &alert.UserID, &alert.ItemID, &alert.Price, &alert.MaxPrice, &alert.TriggeredAt); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, alert := range alerts {
+		log.Printf("Price alert %d: %s at %.2f meets want %d (max %.2f) for user %d", alert.AlertID, alert.ItemID, alert.Price, alert.WantID, alert.MaxPrice, alert.UserID)
+	}
+	notifyPriceAlerts(alerts)
+	return alerts, nil
+}
+
+// GetAlertsByUserID returns a user's alerts, newest first. Dismissed alerts
+// are left out unless includeDismissed is set.
+func GetAlertsByUserID(userID string, includeDismissed bool) ([]models.PriceAlert, error) {
+	rows, err := database.DB.Query(`
+		SELECT a.alert_id, a.want_id, a.user_id, a.item_id, i.name, COALESCE(w.grade, ''), a.price, a.max_price, a.triggered_at, a.dismissed_at
+		FROM PriceAlerts a
+		JOIN WantList w ON a.want_id = w.want_id
+		JOIN Items i ON a.item_id = i.item_id
+		WHERE a.user_id = $1 AND ($2 OR a.dismissed_at IS NULL)
+		ORDER BY a.triggered_at DESC, a.alert_id DESC
+	`, userID, includeDismissed)
+	if err != nil {
+		log.Printf("Error querying alerts for user %s: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []models.PriceAlert{}
+	for rows.Next() {
+		var alert models.PriceAlert
+		var dismissedAt sql.NullTime
+		if err := rows.Scan(&alert.AlertID, &alert.WantID, &alert.UserID, &alert.ItemID, &alert.Name, &alert.Grade,
+			&alert.Price, &alert.MaxPrice, &alert.TriggeredAt, &dismissedAt); err != nil {
+			return nil, err
+		}
+		if dismissedAt.Valid {
+			alert.DismissedAt = &dismissedAt.Time
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
+
+func DismissAlert(userID string, alertID int) error {
+	result, err := database.DB.Exec(`
+		UPDATE PriceAlerts SET dismissed_at = CURRENT_TIMESTAMP
+		WHERE alert_id = $1 AND user_id = $2 AND dismissed_at IS NULL
+	`, alertID, userID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return ErrAlertNotFound
+	}
+	return nil
+}
+
+// RefreshWantedPrices refreshes the market price of every distinct market on
+// any want list. FetchAndStoreMarketPrice only goes to the market for prices
+// older than a day, and evaluates wants whenever it does.
+func RefreshWantedPrices() error {
+	rows, err := database.DB.Query(`
+		SELECT DISTINCT w.item_id, i.name, COALESCE(i.edition, ''), COALESCE(w.grade, ''),
+			COALESCE(w.condition, ''), COALESCE(w.language, ''), COALESCE(w.finish, '')
+		FROM WantList w
+		JOIN Items i ON w.item_id = i.item_id
+	`)
+	if err != nil {
+		return err
+	}
+
+	var queries []MarketPriceQuery
+	for rows.Next() {
+		var query MarketPriceQuery
+		if err := rows.Scan(&query.ID, &query.Name, &query.Edition, &query.Grade, &query.Condition, &query.Language, &query.Finish); err != nil {
+			rows.Close()
+			return err
+		}
+		queries = append(queries, wantMarketQuery(query))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, query := range queries {
+		if _, err := FetchAndStoreMarketPrice(query); err != nil {
+			log.Printf("Error refreshing market price for wanted card %s: %v", query.ID, err)
+		}
+	}
+	return nil
+}
+
+// wantMarketQuery fills in the market defaults for filters a want leaves open:
+// ungraded, English, and no condition for slabs, as the market price handler
+// does.
+func wantMarketQuery(query MarketPriceQuery) MarketPriceQuery {
+	if query.Grade == "" {
+		query.Grade = "ungraded"
+	}
+	if query.Language == "" {
+		query.Language = models.DefaultLanguage
+	}
+	if strings.ToLower(query.Grade) != "ungraded" {
+		query.Condition = ""
+	}
+	return query
+}
+
+// StartWantRefreshJob runs RefreshWantedPrices every interval in the
+// background.
+func StartWantRefreshJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := RefreshWantedPrices(); err != nil {
+				log.Printf("Error refreshing wanted prices: %v", err)
+			}
+		}
+	}()
+}
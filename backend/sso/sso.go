@@ -0,0 +1,238 @@
+// Package sso signs users in with external OpenID Connect providers using
+// the authorization code flow with PKCE.
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrUnknownProvider is returned for provider names that aren't configured.
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// ErrInvalidCallback is returned when a provider's callback can't be trusted:
+// the code can't be redeemed, or the ID token is invalid or was issued for a
+// different sign-in.
+var ErrInvalidCallback = errors.New("invalid sign-in callback")
+
+// DefaultScopes are requested when a provider doesn't configure its own.
+var DefaultScopes = []string{oidc.ScopeOpenID, "email", "profile"}
+
+// Config configures one provider. Name is used in URLs; ClientSecret may be
+// empty for public clients, which rely on PKCE alone.
+type Config struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Identity is what a provider vouches for about the user who signed in.
+type Identity struct {
+	Provider          string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	GivenName         string
+	FamilyName        string
+	PreferredUsername string
+}
+
+// AuthRequest holds the per-sign-in secrets that must survive from the
+// redirect to the provider until its callback.
+type AuthRequest struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// NewAuthRequest generates a fresh state, nonce and PKCE verifier.
+func NewAuthRequest() (AuthRequest, error) {
+	state, err := randomString()
+	if err != nil {
+		return AuthRequest{}, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return AuthRequest{}, err
+	}
+	return AuthRequest{State: state, Nonce: nonce, Verifier: oauth2.GenerateVerifier()}, nil
+}
+
+func randomString() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Provider is one configured identity provider. Its discovery document is
+// fetched on first use so the API starts even while a provider is down.
+type Provider struct {
+	Config
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+}
+
+func (p *Provider) discover(ctx context.Context) (*oidc.Provider, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider == nil {
+		provider, err := oidc.NewProvider(ctx, p.Issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("discovering %s: %w", p.Name, err)
+		}
+		p.provider = provider
+		p.verifier = provider.Verifier(&oidc.Config{ClientID: p.ClientID})
+	}
+	return p.provider, p.verifier, nil
+}
+
+func (p *Provider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  p.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.Scopes,
+	}
+}
+
+// AuthCodeURL returns the provider URL to send the browser to.
+func (p *Provider) AuthCodeURL(ctx context.Context, req AuthRequest) (string, error) {
+	provider, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return p.oauth2Config(provider).AuthCodeURL(req.State, oidc.Nonce(req.Nonce), oauth2.S256ChallengeOption(req.Verifier)), nil
+}
+
+// Exchange redeems the code from the provider's callback and verifies the ID
+// token it returns against req.
+func (p *Provider) Exchange(ctx context.Context, req AuthRequest, code string) (*Identity, error) {
+	provider, verifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(req.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: exchanging code: %v", ErrInvalidCallback, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: no id_token in token response", ErrInvalidCallback)
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCallback, err)
+	}
+	if idToken.Nonce != req.Nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidCallback)
+	}
+
+	var claims struct {
+		Email             string   `json:"email"`
+		EmailVerified     flexBool `json:"email_verified"`
+		Name              string   `json:"name"`
+		GivenName         string   `json:"given_name"`
+		FamilyName        string   `json:"family_name"`
+		PreferredUsername string   `json:"preferred_username"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCallback, err)
+	}
+	return &Identity{
+		Provider:          p.Name,
+		Subject:           idToken.Subject,
+		Email:             claims.Email,
+		EmailVerified:     bool(claims.EmailVerified),
+		Name:              claims.Name,
+		GivenName:         claims.GivenName,
+		FamilyName:        claims.FamilyName,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+// flexBool accepts email_verified as a boolean or, as some providers send
+// it, the string "true".
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case bool:
+		*b = flexBool(v)
+	case string:
+		*b = v == "true"
+	}
+	return nil
+}
+
+// ProviderInfo is what the login page needs to offer a provider.
+type ProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+// Providers holds the configured providers by name.
+type Providers map[string]*Provider
+
+// NewProviders checks each config and fills in defaults.
+func NewProviders(configs []Config) (Providers, error) {
+	providers := Providers{}
+	for _, config := range configs {
+		if config.Name == "" || config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+			return nil, fmt.Errorf("provider %q: name, issuer, client ID and redirect URL are required", config.Name)
+		}
+		if _, ok := providers[config.Name]; ok {
+			return nil, fmt.Errorf("provider %q is configured twice", config.Name)
+		}
+		if config.DisplayName == "" {
+			config.DisplayName = config.Name
+		}
+		if len(config.Scopes) == 0 {
+			config.Scopes = DefaultScopes
+		}
+		providers[config.Name] = &Provider{Config: config}
+	}
+	return providers, nil
+}
+
+// Get returns a configured provider by name.
+func (ps Providers) Get(name string) (*Provider, error) {
+	provider, ok := ps[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, name)
+	}
+	return provider, nil
+}
+
+// List describes the configured providers, sorted by name.
+func (ps Providers) List() []ProviderInfo {
+	infos := make([]ProviderInfo, 0, len(ps))
+	for _, provider := range ps {
+		infos = append(infos, ProviderInfo{Name: provider.Name, DisplayName: provider.DisplayName})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
@@ -297,13 +297,13 @@ export const loginUser = async (username, password) => {
 };
 
 export const updateUserProfile = async (newUsername, newProfilePicture) => {
-    const response = await fetch(`${API_BASE_URL}/api/update-profile`, {
-        method: 'PUT',
+    const response = await fetch(`${API_BASE_URL}/api/users/${localStorage.getItem('id')}`, {
+        method: 'PATCH',
         headers: {
             'Content-Type': 'application/json',
             'Authorization': `Bearer ${localStorage.getItem('token')}`,
         },
-        body: JSON.stringify({ username: newUsername, profilePicture: newProfilePicture }),
+        body: JSON.stringify({ username: newUsername, profile_picture: newProfilePicture }),
     });
 
     if (!response.ok) {